@@ -0,0 +1,259 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+const adminPageSize = 25
+
+type adminPage struct {
+	Admin     AdminRow
+	Filter    adminFilter
+	Events    []EventRow
+	Users     []adminRow
+	Total     int
+	Page      int
+	Pages     int
+	PrevQuery string
+	NextQuery string
+	ErrorMsg  string
+
+	// Filters query for export links, empty when admin cannot export.
+	ExportQuery string
+}
+
+// adminRow is single registration in admin table together with information
+// whether currently logged in admin can modify it.
+type adminRow struct {
+	UserRow
+	CanEdit bool
+}
+
+// adminFilter holds raw values of registrations filter form.
+type adminFilter struct {
+	Event     string
+	Confirmed string
+	Drinks    string
+	From      string
+	To        string
+	Search    string
+}
+
+// RegistrationUI returns registration timestamp formatted for the UI.
+func (u UserRow) RegistrationUI() string {
+	return ToStringUI(FromStringMust(u.RegistrationTs).In(CurrentTz()))
+}
+
+// NicknameOrEmpty returns nickname or empty string when it's not set.
+func (u UserRow) NicknameOrEmpty() string {
+	if u.Nickname == nil {
+		return ""
+	}
+	return *u.Nickname
+}
+
+// AdminHandler renders admin dashboard with registrations table.
+func (o *Owner) AdminHandler(w http.ResponseWriter, r *http.Request) {
+	p := o.adminRegistrations(r)
+	events, eErr := ListEvents(o.db)
+	if eErr != nil {
+		o.logger.Error("Cannot list events", "err", eErr.Error())
+	}
+	p.Events = events
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	renderErr := o.tmpl.Render(w, "admin", p)
+	if renderErr != nil {
+		o.logger.Error("Cannot render <admin>", "err", renderErr.Error())
+	}
+}
+
+// AdminRegistrationsHandler renders only registrations table. It's used by
+// htmx when filters or page are changed.
+func (o *Owner) AdminRegistrationsHandler(w http.ResponseWriter, r *http.Request) {
+	p := o.adminRegistrations(r)
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	renderErr := o.tmpl.Render(w, "admin-registrations", p)
+	if renderErr != nil {
+		o.logger.Error("Cannot render <admin-registrations>", "err",
+			renderErr.Error())
+	}
+}
+
+// AdminActionHandler handles changes of single registration. Updated table
+// row is rendered in response, or nothing when the row was deleted.
+func (o *Owner) AdminActionHandler(w http.ResponseWriter, r *http.Request) {
+	action := r.PathValue("action")
+	slug := r.FormValue("event")
+	email := r.FormValue("email")
+	userDb, uErr := UserByEmail(o.db, slug, email)
+	if uErr == ErrUserNotFound {
+		http.Error(w, "Registration not found", http.StatusNotFound)
+		return
+	}
+	if uErr != nil {
+		o.logger.Error("Cannot read user", "event", slug, "email", email,
+			"err", uErr.Error())
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	var aErr error
+	switch action {
+	case "confirm":
+		aErr = SetUserConfirmed(o.db, slug, email, true)
+	case "unconfirm":
+		aErr = SetUserConfirmed(o.db, slug, email, false)
+	case "nickname":
+		aErr = UpdateUserNickname(o.db, slug, email, r.FormValue("nickname"))
+	case "delete":
+		aErr = DeleteUser(o.db, slug, email)
+	default:
+		http.Error(w, "Unknown action", http.StatusBadRequest)
+		return
+	}
+	if aErr != nil {
+		o.logger.Error("Admin action failed", "action", action, "event", slug,
+			"email", email, "err", aErr.Error())
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	admin, _ := AdminFromContext(r.Context())
+	o.logger.Info("Admin action", "admin", admin.Username, "action", action,
+		"event", slug, "email", email)
+
+	if action == "delete" || (action == "confirm" && userDb.Spot == SpotWaitlist) {
+		event, eErr := EventBySlug(o.db, slug)
+		if eErr == nil {
+			o.promoteFromWaitlist(event)
+		}
+	}
+	if action == "delete" {
+		return
+	}
+	updated, uErr := UserByEmail(o.db, slug, email)
+	if uErr != nil {
+		o.logger.Error("Cannot read updated user", "event", slug, "email",
+			email, "err", uErr.Error())
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	renderErr := o.tmpl.Render(w, "admin-row", adminRow{updated, true})
+	if renderErr != nil {
+		o.logger.Error("Cannot render <admin-row>", "err", renderErr.Error())
+	}
+}
+
+func (o *Owner) adminRegistrations(r *http.Request) adminPage {
+	q := r.URL.Query()
+	f := adminFilterFromQuery(q)
+	pageNum, _ := strconv.Atoi(q.Get("page"))
+	pageNum = max(pageNum, 1)
+
+	admin, _ := AdminFromContext(r.Context())
+	p := adminPage{Admin: admin, Filter: f, Page: pageNum}
+	filter, fErr := f.userFilter()
+	if fErr != nil {
+		p.ErrorMsg = fErr.Error()
+		return p
+	}
+	filter.Limit = adminPageSize
+	filter.Offset = (pageNum - 1) * adminPageSize
+	users, total, sErr := SearchUsers(o.db, filter)
+	if sErr != nil {
+		o.logger.Error("Cannot search users", "filter", filter, "err",
+			sErr.Error())
+		p.ErrorMsg = "Cannot read registrations."
+		return p
+	}
+	p.Users = make([]adminRow, len(users))
+	for idx, user := range users {
+		p.Users[idx] = adminRow{user, admin.Can(PermEditRegistrations)}
+	}
+	p.Total = total
+	p.Pages = max((total+adminPageSize-1)/adminPageSize, 1)
+	if pageNum > 1 {
+		p.PrevQuery = f.query(pageNum - 1)
+	}
+	if pageNum < p.Pages {
+		p.NextQuery = f.query(pageNum + 1)
+	}
+	if admin.Can(PermExport) {
+		p.ExportQuery = f.values().Encode()
+	}
+	return p
+}
+
+func adminFilterFromQuery(q url.Values) adminFilter {
+	return adminFilter{
+		Event:     q.Get("event"),
+		Confirmed: q.Get("confirmed"),
+		Drinks:    q.Get("drinks"),
+		From:      q.Get("from"),
+		To:        q.Get("to"),
+		Search:    q.Get("q"),
+	}
+}
+
+func (f adminFilter) userFilter() (UserFilter, error) {
+	filter := UserFilter{
+		EventSlug: f.Event,
+		Search:    f.Search,
+	}
+	var err error
+	if filter.Confirmed, err = parseYesNo(f.Confirmed); err != nil {
+		return filter, err
+	}
+	if filter.Drinks, err = parseYesNo(f.Drinks); err != nil {
+		return filter, err
+	}
+	for _, d := range []string{f.From, f.To} {
+		if d == "" {
+			continue
+		}
+		if _, pErr := time.Parse(DateFormat, d); pErr != nil {
+			return filter, fmt.Errorf("incorrect date %q, expected format YYYY-MM-DD", d)
+		}
+	}
+	filter.RegisteredFrom = f.From
+	filter.RegisteredTo = f.To
+	return filter, nil
+}
+
+func (f adminFilter) values() url.Values {
+	v := url.Values{}
+	v.Set("event", f.Event)
+	v.Set("confirmed", f.Confirmed)
+	v.Set("drinks", f.Drinks)
+	v.Set("from", f.From)
+	v.Set("to", f.To)
+	v.Set("q", f.Search)
+	return v
+}
+
+func (f adminFilter) query(page int) string {
+	v := f.values()
+	v.Set("page", strconv.Itoa(page))
+	return v.Encode()
+}
+
+// parseYesNo parses optional boolean filter value. Empty string means no
+// filter.
+func parseYesNo(value string) (*bool, error) {
+	var b bool
+	switch value {
+	case "":
+		return nil, nil
+	case "yes":
+		b = true
+	case "no":
+		b = false
+	default:
+		return nil, fmt.Errorf("incorrect filter value %q, expected yes or no",
+			value)
+	}
+	return &b, nil
+}
@@ -0,0 +1,512 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	RoleOwner       = "owner"
+	RoleCoOrganizer = "co-organizer"
+	RoleDoorStaff   = "door-staff"
+
+	PermViewRegistrations = "view-registrations"
+	PermEditRegistrations = "edit-registrations"
+	PermExport            = "export"
+
+	sessionCookieName = "ppacerff_session"
+	sessionTTL        = 12 * time.Hour
+	bcryptCost        = 12
+	minPasswordLength = 12
+)
+
+var (
+	ErrAdminNotFound      = errors.New("admin account not found")
+	ErrInvalidCredentials = errors.New("invalid username or password")
+	ErrSessionNotFound    = errors.New("session not found or expired")
+)
+
+// rolePermissions defines what each admin role is allowed to do. Door staff
+// can only look people up on the attendee list at the venue, they cannot
+// change or export it.
+var rolePermissions = map[string][]string{
+	RoleOwner:       {PermViewRegistrations, PermEditRegistrations, PermExport},
+	RoleCoOrganizer: {PermViewRegistrations, PermEditRegistrations, PermExport},
+	RoleDoorStaff:   {PermViewRegistrations},
+}
+
+type AdminRow struct {
+	Username     string
+	PasswordHash string
+	Role         string
+	CreatedTs    string
+	TotpSecret   string
+	TotpEnabled  int
+	TotpLastStep int64
+}
+
+// Can returns true when admin role grants given permission.
+func (a AdminRow) Can(permission string) bool {
+	for _, p := range rolePermissions[a.Role] {
+		if p == permission {
+			return true
+		}
+	}
+	return false
+}
+
+type adminCtxKey struct{}
+
+// AdminFromContext returns admin account of authenticated request.
+func AdminFromContext(ctx context.Context) (AdminRow, bool) {
+	admin, ok := ctx.Value(adminCtxKey{}).(AdminRow)
+	return admin, ok
+}
+
+func isValidRole(role string) bool {
+	_, exists := rolePermissions[role]
+	return exists
+}
+
+// CreateAdmin stores new admin account with bcrypt hash of given password.
+func CreateAdmin(db *SqliteDB, username, password, role string) error {
+	if !isValidRole(role) {
+		return fmt.Errorf("incorrect role %q", role)
+	}
+	hash, hErr := hashPassword(password)
+	if hErr != nil {
+		return hErr
+	}
+	_, iErr := db.Exec(insertAdminQuery(), username, hash, role,
+		ToString(time.Now()))
+	return iErr
+}
+
+// SetAdminPassword changes password of given admin and logs them out of all
+// sessions, including pending 2FA challenges, so whoever knew the old
+// password loses access.
+func SetAdminPassword(db *SqliteDB, username, password string) error {
+	hash, hErr := hashPassword(password)
+	if hErr != nil {
+		return hErr
+	}
+	return db.WithTx(func(tx *sql.Tx) error {
+		res, uErr := tx.Exec(updateAdminPasswordQuery(), hash, username)
+		if uErr != nil {
+			return uErr
+		}
+		rows, rErr := res.RowsAffected()
+		if rErr != nil {
+			return fmt.Errorf("cannot get number of rows affected: %w", rErr)
+		}
+		if rows == 0 {
+			return ErrAdminNotFound
+		}
+		if _, dErr := tx.Exec(deleteAdminSessionsQuery(), username); dErr != nil {
+			return dErr
+		}
+		_, dErr := tx.Exec(deleteAdminChallengesQuery(), username)
+		return dErr
+	})
+}
+
+func DeleteAdmin(db *SqliteDB, username string) error {
+	if _, dErr := db.Exec(deleteAdminSessionsQuery(), username); dErr != nil {
+		return dErr
+	}
+	return execOnAdmin(db, deleteAdminQuery(), username)
+}
+
+func AdminByUsername(db *SqliteDB, username string) (AdminRow, error) {
+	row := db.QueryRow(readAdminQuery(), username)
+	admin, scanErr := parseAdminRow(row)
+	if scanErr == sql.ErrNoRows {
+		return AdminRow{}, ErrAdminNotFound
+	}
+	if scanErr != nil {
+		return AdminRow{}, fmt.Errorf("cannot read admin %s: %w", username,
+			scanErr)
+	}
+	return admin, nil
+}
+
+func ListAdmins(db *SqliteDB) ([]AdminRow, error) {
+	rows, qErr := db.Query(readAdminsQuery())
+	if qErr != nil {
+		return nil, fmt.Errorf("cannot query admins: %w", qErr)
+	}
+	defer rows.Close()
+	admins := make([]AdminRow, 0)
+	for rows.Next() {
+		admin, scanErr := parseAdminRow(rows)
+		if scanErr != nil {
+			return nil, fmt.Errorf("error while scanning adminRow: %w",
+				scanErr)
+		}
+		admins = append(admins, admin)
+	}
+	return admins, rows.Err()
+}
+
+// Authenticate checks admin credentials. In case of unknown username
+// password is still compared against a dummy hash, so response time does not
+// reveal which accounts exist.
+func Authenticate(db *SqliteDB, username, password string) (AdminRow, error) {
+	admin, aErr := AdminByUsername(db, username)
+	if aErr == ErrAdminNotFound {
+		bcrypt.CompareHashAndPassword(dummyPasswordHash(), []byte(password))
+		return AdminRow{}, ErrInvalidCredentials
+	}
+	if aErr != nil {
+		return AdminRow{}, aErr
+	}
+	cErr := bcrypt.CompareHashAndPassword([]byte(admin.PasswordHash),
+		[]byte(password))
+	if cErr != nil {
+		return AdminRow{}, ErrInvalidCredentials
+	}
+	return admin, nil
+}
+
+// NewSession creates server-side session for given admin and returns session
+// token for the cookie. Only SHA-256 hash of the token is stored.
+func NewSession(db *SqliteDB, username string) (string, time.Time, error) {
+	token, tErr := randomToken(32)
+	if tErr != nil {
+		return "", time.Time{}, tErr
+	}
+	now := time.Now()
+	expires := now.Add(sessionTTL)
+	_, iErr := db.Exec(insertSessionQuery(), hashToken(token), username,
+		ToString(now), ToString(expires))
+	if iErr != nil {
+		return "", time.Time{}, fmt.Errorf("cannot insert session: %w", iErr)
+	}
+	return token, expires, nil
+}
+
+// AdminBySession returns admin for given non-expired session token.
+func AdminBySession(db *SqliteDB, token string) (AdminRow, error) {
+	var expiresTs string
+	row := db.QueryRow(readAdminBySessionQuery(), hashToken(token))
+	var admin AdminRow
+	scanErr := row.Scan(&admin.Username, &admin.PasswordHash, &admin.Role,
+		&admin.CreatedTs, &admin.TotpSecret, &admin.TotpEnabled,
+		&admin.TotpLastStep, &expiresTs)
+	if scanErr == sql.ErrNoRows {
+		return AdminRow{}, ErrSessionNotFound
+	}
+	if scanErr != nil {
+		return AdminRow{}, fmt.Errorf("cannot read session: %w", scanErr)
+	}
+	if !time.Now().Before(FromStringMust(expiresTs)) {
+		DeleteSession(db, token)
+		return AdminRow{}, ErrSessionNotFound
+	}
+	return admin, nil
+}
+
+func DeleteSession(db *SqliteDB, token string) error {
+	_, dErr := db.Exec(deleteSessionQuery(), hashToken(token))
+	return dErr
+}
+
+// RequireAdmin wraps handler with session authentication and checks that
+// logged in admin has given permission. Unauthenticated requests are
+// redirected to the login page.
+func (o *Owner) RequireAdmin(permission string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		cookie, cErr := r.Cookie(sessionCookieName)
+		if cErr != nil {
+			http.Redirect(w, r, "/admin/login", http.StatusSeeOther)
+			return
+		}
+		admin, sErr := AdminBySession(o.db, cookie.Value)
+		if sErr == ErrSessionNotFound {
+			http.Redirect(w, r, "/admin/login", http.StatusSeeOther)
+			return
+		}
+		if sErr != nil {
+			o.logger.Error("Cannot read admin session", "err", sErr.Error())
+			http.Error(w, "Internal server error",
+				http.StatusInternalServerError)
+			return
+		}
+		if !admin.Can(permission) {
+			o.logger.Warn("Admin permission denied", "username",
+				admin.Username, "role", admin.Role, "permission", permission)
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+		ctx := context.WithValue(r.Context(), adminCtxKey{}, admin)
+		next(w, r.WithContext(ctx))
+	}
+}
+
+// LoginHandler renders login form on GET and authenticates admin on POST.
+func (o *Owner) LoginHandler(w http.ResponseWriter, r *http.Request) {
+	var p adminPage
+	if r.Method == http.MethodPost {
+		username := r.FormValue("username")
+		admin, aErr := Authenticate(o.db, username, r.FormValue("password"))
+		if aErr == nil && admin.TotpEnabled == 1 {
+			o.startTotpChallenge(w, r, admin)
+			return
+		}
+		if aErr == nil {
+			o.startSession(w, r, admin)
+			return
+		}
+		if aErr != ErrInvalidCredentials {
+			o.logger.Error("Cannot authenticate admin", "username", username,
+				"err", aErr.Error())
+		}
+		o.logger.Warn("Failed admin login", "username", username)
+		p.ErrorMsg = "Invalid username or password."
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	renderErr := o.tmpl.Render(w, "admin-login", p)
+	if renderErr != nil {
+		o.logger.Error("Cannot render <admin-login>", "err", renderErr.Error())
+	}
+}
+
+// LogoutHandler deletes current session and its cookie.
+func (o *Owner) LogoutHandler(w http.ResponseWriter, r *http.Request) {
+	if cookie, cErr := r.Cookie(sessionCookieName); cErr == nil {
+		if dErr := DeleteSession(o.db, cookie.Value); dErr != nil {
+			o.logger.Error("Cannot delete session", "err", dErr.Error())
+		}
+	}
+	http.SetCookie(w, sessionCookie("", -1))
+	http.Redirect(w, r, "/admin/login", http.StatusSeeOther)
+}
+
+func (o *Owner) startSession(w http.ResponseWriter, r *http.Request, admin AdminRow) {
+	token, _, sErr := NewSession(o.db, admin.Username)
+	if sErr != nil {
+		o.logger.Error("Cannot create session", "username", admin.Username,
+			"err", sErr.Error())
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	o.logger.Info("Admin logged in", "username", admin.Username)
+	http.SetCookie(w, sessionCookie(token, int(sessionTTL.Seconds())))
+	http.Redirect(w, r, "/admin", http.StatusSeeOther)
+}
+
+// sessionCookie returns admin session cookie. SameSite=Strict keeps the
+// cookie away from cross-site requests, which protects admin forms against
+// CSRF.
+func sessionCookie(token string, maxAge int) *http.Cookie {
+	return &http.Cookie{
+		Name:     sessionCookieName,
+		Value:    token,
+		Path:     "/admin",
+		MaxAge:   maxAge,
+		Secure:   true,
+		HttpOnly: true,
+		SameSite: http.SameSiteStrictMode,
+	}
+}
+
+func hashPassword(password string) (string, error) {
+	if len(password) < minPasswordLength {
+		return "", fmt.Errorf("password has to be at least %d characters long",
+			minPasswordLength)
+	}
+	hash, hErr := bcrypt.GenerateFromPassword([]byte(password), bcryptCost)
+	if hErr != nil {
+		return "", fmt.Errorf("cannot hash password: %w", hErr)
+	}
+	return string(hash), nil
+}
+
+// Hash of random password used to keep Authenticate timing uniform.
+var dummyPasswordHash = sync.OnceValue(func() []byte {
+	hash, _ := bcrypt.GenerateFromPassword(
+		[]byte("ppacerFF-dummy-password"), bcryptCost,
+	)
+	return hash
+})
+
+func randomToken(nBytes int) (string, error) {
+	buf := make([]byte, nBytes)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("cannot generate random token: %w", err)
+	}
+	return hex.EncodeToString(buf), nil
+}
+
+func hashToken(token string) string {
+	hash := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(hash[:])
+}
+
+func execOnAdmin(db *SqliteDB, query string, args ...any) error {
+	res, eErr := db.Exec(query, args...)
+	if eErr != nil {
+		return eErr
+	}
+	rows, rErr := res.RowsAffected()
+	if rErr != nil {
+		return fmt.Errorf("cannot get number of rows affected: %w", rErr)
+	}
+	if rows == 0 {
+		return ErrAdminNotFound
+	}
+	return nil
+}
+
+func parseAdminRow(row rowScanner) (AdminRow, error) {
+	var a AdminRow
+	scanErr := row.Scan(&a.Username, &a.PasswordHash, &a.Role, &a.CreatedTs,
+		&a.TotpSecret, &a.TotpEnabled, &a.TotpLastStep)
+	return a, scanErr
+}
+
+func readAdminQuery() string {
+	return `
+	SELECT
+		Username,
+		PasswordHash,
+		Role,
+		CreatedTs,
+		TotpSecret,
+		TotpEnabled,
+		TotpLastStep
+	FROM
+		admins
+	WHERE
+		Username = ?
+`
+}
+
+func readAdminsQuery() string {
+	return `
+	SELECT
+		Username,
+		PasswordHash,
+		Role,
+		CreatedTs,
+		TotpSecret,
+		TotpEnabled,
+		TotpLastStep
+	FROM
+		admins
+	ORDER BY
+		Username
+`
+}
+
+func insertAdminQuery() string {
+	return `
+	INSERT INTO admins(Username, PasswordHash, Role, CreatedTs)
+	VALUES (?,?,?,?)
+	`
+}
+
+func updateAdminPasswordQuery() string {
+	return `
+	UPDATE
+		admins
+	SET
+		PasswordHash = ?
+	WHERE
+		Username = ?
+`
+}
+
+func deleteAdminQuery() string {
+	return `
+	DELETE FROM
+		admins
+	WHERE
+		Username = ?
+`
+}
+
+func readAdminBySessionQuery() string {
+	return `
+	SELECT
+		a.Username,
+		a.PasswordHash,
+		a.Role,
+		a.CreatedTs,
+		a.TotpSecret,
+		a.TotpEnabled,
+		a.TotpLastStep,
+		s.ExpiresTs
+	FROM
+		admin_sessions s
+	INNER JOIN
+		admins a ON a.Username = s.Username
+	WHERE
+		s.TokenHash = ?
+`
+}
+
+func insertSessionQuery() string {
+	return `
+	INSERT INTO admin_sessions(TokenHash, Username, CreatedTs, ExpiresTs)
+	VALUES (?,?,?,?)
+	`
+}
+
+func deleteSessionQuery() string {
+	return `
+	DELETE FROM
+		admin_sessions
+	WHERE
+		TokenHash = ?
+`
+}
+
+func deleteAdminSessionsQuery() string {
+	return `
+	DELETE FROM
+		admin_sessions
+	WHERE
+		Username = ?
+`
+}
+
+func sqliteCreateAdminsTable() string {
+	return `
+		CREATE TABLE IF NOT EXISTS admins (
+			Username     TEXT NOT NULL,
+			PasswordHash TEXT NOT NULL,
+			Role         TEXT NOT NULL,
+			CreatedTs    TEXT NOT NULL,
+			TotpSecret   TEXT NOT NULL DEFAULT '',
+			TotpEnabled  INT NOT NULL DEFAULT 0,
+			TotpLastStep INT NOT NULL DEFAULT 0,
+			TotpFailures INT NOT NULL DEFAULT 0,
+
+			PRIMARY KEY (Username)
+		);
+`
+}
+
+func sqliteCreateAdminSessionsTable() string {
+	return `
+		CREATE TABLE IF NOT EXISTS admin_sessions (
+			TokenHash TEXT NOT NULL,
+			Username  TEXT NOT NULL,
+			CreatedTs TEXT NOT NULL,
+			ExpiresTs TEXT NOT NULL,
+
+			PRIMARY KEY (TokenHash)
+		);
+`
+}
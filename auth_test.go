@@ -0,0 +1,116 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestAuthenticateAndSession(t *testing.T) {
+	db := newTestDb(t)
+	const password = "correct horse battery"
+	if cErr := CreateAdmin(db, "door", password, RoleDoorStaff); cErr != nil {
+		t.Fatalf("Cannot create admin: %s", cErr.Error())
+	}
+	if cErr := CreateAdmin(db, "short", "pass", RoleOwner); cErr == nil {
+		t.Error("Expected error for too short password")
+	}
+
+	if _, aErr := Authenticate(db, "door", "wrong password!"); aErr != ErrInvalidCredentials {
+		t.Errorf("Expected ErrInvalidCredentials for wrong password, got: %v",
+			aErr)
+	}
+	if _, aErr := Authenticate(db, "nobody", password); aErr != ErrInvalidCredentials {
+		t.Errorf("Expected ErrInvalidCredentials for unknown user, got: %v",
+			aErr)
+	}
+	admin, aErr := Authenticate(db, "door", password)
+	if aErr != nil {
+		t.Fatalf("Cannot authenticate: %s", aErr.Error())
+	}
+
+	token, _, sErr := NewSession(db, admin.Username)
+	if sErr != nil {
+		t.Fatalf("Cannot create session: %s", sErr.Error())
+	}
+	fromSession, sErr := AdminBySession(db, token)
+	if sErr != nil || fromSession.Username != "door" {
+		t.Fatalf("Expected session of door, got %+v, %v", fromSession, sErr)
+	}
+	if dErr := DeleteSession(db, token); dErr != nil {
+		t.Fatalf("Cannot delete session: %s", dErr.Error())
+	}
+	if _, sErr := AdminBySession(db, token); sErr != ErrSessionNotFound {
+		t.Errorf("Expected ErrSessionNotFound after logout, got: %v", sErr)
+	}
+}
+
+func TestSetAdminPasswordLogsOut(t *testing.T) {
+	db := newTestDb(t)
+	if cErr := CreateAdmin(db, "owner", "old password 123", RoleOwner); cErr != nil {
+		t.Fatalf("Cannot create admin: %s", cErr.Error())
+	}
+	session, _, sErr := NewSession(db, "owner")
+	if sErr != nil {
+		t.Fatalf("Cannot create session: %s", sErr.Error())
+	}
+	challenge, cErr := NewLoginChallenge(db, "owner")
+	if cErr != nil {
+		t.Fatalf("Cannot create login challenge: %s", cErr.Error())
+	}
+
+	if pErr := SetAdminPassword(db, "owner", "new password 123"); pErr != nil {
+		t.Fatalf("Cannot set password: %s", pErr.Error())
+	}
+	if _, aErr := Authenticate(db, "owner", "new password 123"); aErr != nil {
+		t.Errorf("Cannot authenticate with new password: %s", aErr.Error())
+	}
+	if _, sErr := AdminBySession(db, session); sErr != ErrSessionNotFound {
+		t.Errorf("Expected ErrSessionNotFound after password change, got: %v",
+			sErr)
+	}
+	if _, _, aErr := AdminByChallenge(db, challenge); aErr != ErrSessionNotFound {
+		t.Errorf("Expected ErrSessionNotFound for pending challenge, got: %v",
+			aErr)
+	}
+	if pErr := SetAdminPassword(db, "nobody", "new password 123"); pErr != ErrAdminNotFound {
+		t.Errorf("Expected ErrAdminNotFound, got: %v", pErr)
+	}
+}
+
+func TestRequireAdminRoles(t *testing.T) {
+	db := newTestDb(t)
+	o := &Owner{db: db, logger: defaultLogger()}
+	if cErr := CreateAdmin(db, "door", "door staff password", RoleDoorStaff); cErr != nil {
+		t.Fatalf("Cannot create admin: %s", cErr.Error())
+	}
+	token, _, sErr := NewSession(db, "door")
+	if sErr != nil {
+		t.Fatalf("Cannot create session: %s", sErr.Error())
+	}
+	ok := func(w http.ResponseWriter, _ *http.Request) {}
+
+	data := []struct {
+		permission string
+		cookie     string
+		expected   int
+	}{
+		{PermViewRegistrations, token, http.StatusOK},
+		{PermExport, token, http.StatusForbidden},
+		{PermEditRegistrations, token, http.StatusForbidden},
+		{PermViewRegistrations, "", http.StatusSeeOther},
+		{PermViewRegistrations, "forged", http.StatusSeeOther},
+	}
+	for _, d := range data {
+		r := httptest.NewRequest("GET", "/admin", nil)
+		if d.cookie != "" {
+			r.AddCookie(&http.Cookie{Name: sessionCookieName, Value: d.cookie})
+		}
+		w := httptest.NewRecorder()
+		o.RequireAdmin(d.permission, ok)(w, r)
+		if w.Code != d.expected {
+			t.Errorf("Expected status %d for %s (cookie %q), got %d",
+				d.expected, d.permission, d.cookie, w.Code)
+		}
+	}
+}
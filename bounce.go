@@ -0,0 +1,304 @@
+package main
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/mail"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+)
+
+const (
+	SuppressionBounce    = "bounce"
+	SuppressionComplaint = "complaint"
+
+	bounceWebhookMaxBody = 1 << 20
+)
+
+var snsHostPattern = regexp.MustCompile(`^sns\.[a-z0-9-]+\.amazonaws\.com(\.cn)?$`)
+
+// BounceEvent is a single address reported as undeliverable.
+type BounceEvent struct {
+	Email   string
+	Reason  string
+	Details string
+}
+
+// snsEnvelope is a message delivered by Amazon SNS HTTP subscription.
+type snsEnvelope struct {
+	Type         string
+	Message      string
+	SubscribeURL string
+}
+
+// sesNotification is Amazon SES bounce or complaint notification. SNS
+// notifications use notificationType and event publishing uses eventType.
+type sesNotification struct {
+	NotificationType string `json:"notificationType"`
+	EventType        string `json:"eventType"`
+	Bounce           *struct {
+		BounceType        string `json:"bounceType"`
+		BounceSubType     string `json:"bounceSubType"`
+		BouncedRecipients []struct {
+			EmailAddress   string `json:"emailAddress"`
+			DiagnosticCode string `json:"diagnosticCode"`
+		} `json:"bouncedRecipients"`
+	} `json:"bounce"`
+	Complaint *struct {
+		ComplaintFeedbackType string `json:"complaintFeedbackType"`
+		ComplainedRecipients  []struct {
+			EmailAddress string `json:"emailAddress"`
+		} `json:"complainedRecipients"`
+	} `json:"complaint"`
+}
+
+// genericBounce is a simple format for other providers or manual reports.
+type genericBounce struct {
+	Type   string `json:"type"`
+	Email  string `json:"email"`
+	Reason string `json:"reason"`
+}
+
+// ParseBounceNotification parses SNS envelope with SES notification, bare
+// SES notification or generic {"type": "bounce|complaint", "email": "...",
+// "reason": "..."} JSON. Transient bounces are ignored. For SNS subscription
+// confirmation, the URL which has to be visited is returned.
+func ParseBounceNotification(body []byte) ([]BounceEvent, string, error) {
+	var envelope snsEnvelope
+	if err := json.Unmarshal(body, &envelope); err != nil {
+		return nil, "", fmt.Errorf("incorrect JSON: %w", err)
+	}
+	switch envelope.Type {
+	case "SubscriptionConfirmation":
+		return nil, envelope.SubscribeURL, nil
+	case "UnsubscribeConfirmation":
+		return nil, "", nil
+	case "Notification":
+		body = []byte(envelope.Message)
+	}
+
+	var ses sesNotification
+	if err := json.Unmarshal(body, &ses); err != nil {
+		return nil, "", fmt.Errorf("incorrect notification JSON: %w", err)
+	}
+	kind := ses.NotificationType
+	if kind == "" {
+		kind = ses.EventType
+	}
+	var events []BounceEvent
+	switch {
+	case kind == "Bounce" && ses.Bounce != nil:
+		if ses.Bounce.BounceType != "Permanent" {
+			return nil, "", nil
+		}
+		for _, r := range ses.Bounce.BouncedRecipients {
+			details := ses.Bounce.BounceSubType
+			if r.DiagnosticCode != "" {
+				details += ": " + r.DiagnosticCode
+			}
+			events = append(events, BounceEvent{r.EmailAddress,
+				SuppressionBounce, details})
+		}
+		return events, "", nil
+	case kind == "Complaint" && ses.Complaint != nil:
+		for _, r := range ses.Complaint.ComplainedRecipients {
+			events = append(events, BounceEvent{r.EmailAddress,
+				SuppressionComplaint, ses.Complaint.ComplaintFeedbackType})
+		}
+		return events, "", nil
+	case kind != "":
+		// Deliveries, opens and other SES events are not interesting.
+		return nil, "", nil
+	}
+
+	var generic genericBounce
+	if err := json.Unmarshal(body, &generic); err != nil {
+		return nil, "", fmt.Errorf("incorrect notification JSON: %w", err)
+	}
+	reason := strings.ToLower(generic.Type)
+	if reason != SuppressionBounce && reason != SuppressionComplaint {
+		return nil, "", fmt.Errorf("unknown notification type %q", generic.Type)
+	}
+	if generic.Email == "" {
+		return nil, "", errors.New("notification has no email")
+	}
+	return []BounceEvent{{generic.Email, reason, generic.Reason}}, "", nil
+}
+
+// SuppressEmail puts address on the suppression list and flags its
+// registrations as undeliverable. It returns false when the address has
+// already been suppressed.
+func SuppressEmail(db *SqliteDB, event BounceEvent) (bool, error) {
+	email := suppressedAddress(event.Email)
+	key := EmailKey(email)
+	res, iErr := db.Exec(insertSuppressionQuery(), email, key, event.Reason,
+		event.Details, ToString(time.Now()))
+	if iErr != nil {
+		return false, fmt.Errorf("cannot suppress %s: %w", email, iErr)
+	}
+	_, uErr := db.Exec(flagUndeliverableQuery(), key, key, key)
+	if uErr != nil {
+		return false, fmt.Errorf("cannot flag registrations of %s: %w", email,
+			uErr)
+	}
+	added, _ := res.RowsAffected()
+	return added > 0, nil
+}
+
+// IsSuppressed tells whether given address is on the suppression list. Address
+// can include display name. Addresses are compared by EmailKey.
+func IsSuppressed(db *SqliteDB, email string) (bool, error) {
+	var suppressed bool
+	qErr := db.QueryRow(isSuppressedQuery(), EmailKey(suppressedAddress(email))).
+		Scan(&suppressed)
+	if qErr != nil {
+		return false, fmt.Errorf("cannot read suppression list: %w", qErr)
+	}
+	return suppressed, nil
+}
+
+// suppressedAddress returns bare address from address which can include
+// display name.
+func suppressedAddress(email string) string {
+	if addr, err := mail.ParseAddress(email); err == nil {
+		email = addr.Address
+	}
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+// BounceWebhookHandler receives bounce and complaint notifications. Reported
+// addresses are put on the suppression list, so no more emails are sent to
+// them, and organizers are notified.
+func (o *Owner) BounceWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	if o.bounceWebhookToken == "" {
+		http.NotFound(w, r)
+		return
+	}
+	token := r.URL.Query().Get("token")
+	if bearer, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok {
+		token = bearer
+	}
+	if subtle.ConstantTimeCompare([]byte(token), []byte(o.bounceWebhookToken)) != 1 {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	body, rErr := io.ReadAll(http.MaxBytesReader(w, r.Body,
+		bounceWebhookMaxBody))
+	if rErr != nil {
+		http.Error(w, "Cannot read body", http.StatusBadRequest)
+		return
+	}
+	events, subscribeUrl, pErr := ParseBounceNotification(body)
+	if pErr != nil {
+		o.logger.Warn("Incorrect bounce notification", "err", pErr.Error())
+		http.Error(w, pErr.Error(), http.StatusBadRequest)
+		return
+	}
+	if subscribeUrl != "" {
+		if cErr := confirmSnsSubscription(subscribeUrl); cErr != nil {
+			o.logger.Error("Cannot confirm SNS subscription", "err",
+				cErr.Error())
+			http.Error(w, "Cannot confirm subscription",
+				http.StatusBadGateway)
+			return
+		}
+		o.logger.Info("SNS subscription confirmed")
+	}
+	for _, event := range events {
+		added, sErr := SuppressEmail(o.db, event)
+		if sErr != nil {
+			o.logger.Error("Cannot suppress email", "email", event.Email,
+				"err", sErr.Error())
+			http.Error(w, "Internal server error",
+				http.StatusInternalServerError)
+			return
+		}
+		if !added {
+			continue
+		}
+		o.logger.Warn("Email suppressed", "email", event.Email, "reason",
+			event.Reason, "details", event.Details)
+		o.notifier.Send(
+			fmt.Sprintf("[ppacerFF] Email [%s] is undeliverable (%s): %s",
+				event.Email, event.Reason, event.Details),
+		)
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// confirmSnsSubscription visits SubscribeURL of SNS subscription
+// confirmation. Only SNS endpoints are allowed, so the webhook cannot be used
+// to make requests to arbitrary hosts.
+func confirmSnsSubscription(subscribeUrl string) error {
+	u, pErr := url.Parse(subscribeUrl)
+	if pErr != nil {
+		return pErr
+	}
+	if u.Scheme != "https" || !snsHostPattern.MatchString(u.Hostname()) {
+		return fmt.Errorf("unexpected SNS subscribe URL host %q", u.Host)
+	}
+	client := &http.Client{Timeout: notifierTimeout}
+	resp, err := client.Get(u.String())
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("expected 200 status from %s, got: %d", u.Host,
+			resp.StatusCode)
+	}
+	return nil
+}
+
+func insertSuppressionQuery() string {
+	return `
+	INSERT INTO email_suppressions(Email, EmailKey, Reason, Details, CreatedTs)
+	VALUES (?,?,?,?,?)
+	ON CONFLICT DO NOTHING
+`
+}
+
+func flagUndeliverableQuery() string {
+	return `
+	UPDATE
+		users
+	SET
+		Undeliverable = 1
+	WHERE
+			EmailKey = ?
+		-- Near-duplicates which are not resolved yet, see EmailDuplicates.
+		OR substr(EmailKey, 1, length(?) + 1) = ? || '#'
+`
+}
+
+func isSuppressedQuery() string {
+	return `
+	SELECT EXISTS (SELECT 1 FROM email_suppressions WHERE EmailKey = ?)
+`
+}
+
+func sqliteCreateEmailSuppressionsTable() string {
+	return `
+		CREATE TABLE IF NOT EXISTS email_suppressions (
+			Email     TEXT NOT NULL,
+			EmailKey  TEXT NOT NULL,
+			Reason    TEXT NOT NULL,
+			Details   TEXT NOT NULL,
+			CreatedTs TEXT NOT NULL,
+			PRIMARY KEY (Email)
+		);
+`
+}
+
+func sqliteCreateEmailSuppressionsKeyIndex() string {
+	return `
+		CREATE UNIQUE INDEX IF NOT EXISTS email_suppressions_key
+		ON email_suppressions (EmailKey);
+`
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseBounceNotification(t *testing.T) {
+	sesBounce := `{"notificationType":"Bounce","bounce":{"bounceType":"Permanent",
+		"bounceSubType":"General","bouncedRecipients":[{"emailAddress":"Typo@gmial.com",
+		"diagnosticCode":"550 5.1.1 user unknown"}]}}`
+	snsMessage, _ := json.Marshal(map[string]string{
+		"Type": "Notification", "Message": sesBounce,
+	})
+	data := map[string][]BounceEvent{
+		string(snsMessage): {{"Typo@gmial.com", SuppressionBounce,
+			"General: 550 5.1.1 user unknown"}},
+		`{"eventType":"Complaint","complaint":{"complaintFeedbackType":"abuse",
+			"complainedRecipients":[{"emailAddress":"a@x.com"}]}}`: {{"a@x.com",
+			SuppressionComplaint, "abuse"}},
+		`{"notificationType":"Bounce","bounce":{"bounceType":"Transient",
+			"bouncedRecipients":[{"emailAddress":"a@x.com"}]}}`: nil,
+		`{"type":"bounce","email":"b@x.com","reason":"mailbox full"}`: {{"b@x.com",
+			SuppressionBounce, "mailbox full"}},
+	}
+	for body, expected := range data {
+		events, _, err := ParseBounceNotification([]byte(body))
+		if err != nil {
+			t.Errorf("Cannot parse %s: %s", body, err.Error())
+			continue
+		}
+		if len(events) != len(expected) {
+			t.Errorf("Expected %v for %s, got %v", expected, body, events)
+			continue
+		}
+		for idx := range events {
+			if events[idx] != expected[idx] {
+				t.Errorf("Expected %v, got %v", expected[idx], events[idx])
+			}
+		}
+	}
+
+	_, subscribeUrl, _ := ParseBounceNotification([]byte(
+		`{"Type":"SubscriptionConfirmation","SubscribeURL":"https://sns.eu-central-1.amazonaws.com/?Action=ConfirmSubscription"}`))
+	if !strings.HasPrefix(subscribeUrl, "https://sns.eu-central-1") {
+		t.Errorf("Expected subscribe URL, got %q", subscribeUrl)
+	}
+	if _, _, err := ParseBounceNotification([]byte(`{"type":"unknown"}`)); err == nil {
+		t.Error("Expected error for unknown notification type")
+	}
+}
+
+func TestConfirmSnsSubscriptionRejectsOtherHosts(t *testing.T) {
+	for _, u := range []string{"http://sns.eu-central-1.amazonaws.com/",
+		"https://169.254.169.254/latest", "https://sns.evil.com/"} {
+		if err := confirmSnsSubscription(u); err == nil {
+			t.Errorf("Expected %s to be rejected", u)
+		}
+	}
+}
+
+func TestBounceWebhook(t *testing.T) {
+	db := newTestDb(t)
+	user := User{EventSlug: defaultEventSlug, Email: "typo@gmial.com",
+		Spot: SpotAttendee}
+	if iErr := InsertNewUser(db, user); iErr != nil {
+		t.Fatalf("Cannot insert user: %s", iErr.Error())
+	}
+	notifier := &fakeNotifier{}
+	o := &Owner{db: db, logger: defaultLogger(), notifier: notifier,
+		bounceWebhookToken: "secret"}
+
+	body := `{"type":"bounce","email":"Typo@gmial.com","reason":"user unknown"}`
+	for _, token := range []string{"", "wrong"} {
+		req := httptest.NewRequest(http.MethodPost, "/webhooks/email?token="+token,
+			strings.NewReader(body))
+		rec := httptest.NewRecorder()
+		o.BounceWebhookHandler(rec, req)
+		if rec.Code != http.StatusUnauthorized {
+			t.Errorf("Expected 401 for token %q, got %d", token, rec.Code)
+		}
+	}
+	for i := 0; i < 2; i++ {
+		req := httptest.NewRequest(http.MethodPost, "/webhooks/email",
+			strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer secret")
+		rec := httptest.NewRecorder()
+		o.BounceWebhookHandler(rec, req)
+		if rec.Code != http.StatusNoContent {
+			t.Fatalf("Expected 204, got %d: %s", rec.Code, rec.Body.String())
+		}
+	}
+	if len(notifier.messages) != 1 {
+		t.Errorf("Expected single alert, got %v", notifier.messages)
+	}
+	flagged, _ := UserByEmail(db, defaultEventSlug, user.Email)
+	if flagged.Undeliverable != 1 {
+		t.Errorf("Expected registration to be flagged, got %+v", flagged)
+	}
+
+	// Registration with suppressed address is flagged right away.
+	user.EventSlug = "other"
+	InsertNewUser(db, user)
+	if other, _ := UserByEmail(db, "other", user.Email); other.Undeliverable != 1 {
+		t.Errorf("Expected new registration to be flagged, got %+v", other)
+	}
+
+	// Outbox skips suppressed recipients.
+	o.queueEmail(EmailMessage{To: "Typo <typo@gmial.com>", Subject: "Hi"})
+	o.queueEmail(EmailMessage{To: "ok@x.com", Subject: "Hi"})
+	var sent []string
+	o.processOutbox(func(msg OutboxMessage) error {
+		sent = append(sent, msg.To)
+		return nil
+	}, time.Now())
+	if len(sent) != 1 || sent[0] != "ok@x.com" {
+		t.Errorf("Expected only ok@x.com to be sent, got %v", sent)
+	}
+	if suppressed, _ := OutboxMessagesByStatus(db, OutboxSuppressed); len(suppressed) != 1 {
+		t.Errorf("Expected one suppressed message, got %d", len(suppressed))
+	}
+}
+
+func TestSuppressionMatchesEmailKey(t *testing.T) {
+	db := newTestDb(t)
+	user := User{EventSlug: defaultEventSlug, Email: "Ala@xn--bcher-kva.de"}
+	if iErr := InsertNewUser(db, user); iErr != nil {
+		t.Fatalf("Cannot insert user: %s", iErr.Error())
+	}
+	added, sErr := SuppressEmail(db, BounceEvent{"ala@Bücher.de",
+		SuppressionBounce, "no such user"})
+	if sErr != nil || !added {
+		t.Fatalf("Expected address to be suppressed, got %v, %v", added, sErr)
+	}
+	if added, _ := SuppressEmail(db, BounceEvent{"ALA@bücher.de",
+		SuppressionBounce, "no such user"}); added {
+		t.Error("Expected address with the same key not to be added again")
+	}
+	if suppressed, _ := IsSuppressed(db, "Ala <ala@XN--BCHER-KVA.de>"); !suppressed {
+		t.Error("Expected address with the same key to be suppressed")
+	}
+	if flagged, _ := UserByEmail(db, defaultEventSlug, user.Email); flagged.Undeliverable != 1 {
+		t.Errorf("Expected registration to be flagged, got %+v", flagged)
+	}
+}
+
+func TestMigrateEmailSuppressionKeys(t *testing.T) {
+	db := newTestDb(t)
+	stmts := []string{
+		`DROP INDEX email_suppressions_key;`,
+		`ALTER TABLE email_suppressions DROP COLUMN EmailKey;`,
+		`INSERT INTO email_suppressions(Email, Reason, Details, CreatedTs)
+		VALUES ('ala@x.com', 'bounce', '', ''), ('Ala@X.com', 'bounce', '', '')`,
+	}
+	for _, stmt := range stmts {
+		if _, err := db.Exec(stmt); err != nil {
+			t.Fatalf("Cannot execute %s: %s", stmt, err.Error())
+		}
+	}
+	if mErr := db.WithTx(migrateEmailSuppressionKeys); mErr != nil {
+		t.Fatalf("Cannot migrate database: %s", mErr.Error())
+	}
+	var count int
+	db.QueryRow(`SELECT COUNT(*) FROM email_suppressions`).Scan(&count)
+	if count != 1 {
+		t.Errorf("Expected single suppression per key, got %d", count)
+	}
+	if suppressed, _ := IsSuppressed(db, "ALA@x.com"); !suppressed {
+		t.Error("Expected migrated address to be suppressed")
+	}
+}
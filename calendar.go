@@ -0,0 +1,71 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+)
+
+const calendarContentType = "text/calendar; charset=utf-8"
+
+// CalendarHandler serves iCalendar feed with all published events.
+func (o *Owner) CalendarHandler(w http.ResponseWriter, r *http.Request) {
+	events, eErr := ListEvents(o.db)
+	if eErr != nil {
+		o.logger.Error("Cannot list events", "err", eErr.Error())
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	published := make([]EventRow, 0, len(events))
+	for _, event := range events {
+		if event.Status == EventStatusPublished {
+			published = append(published, event)
+		}
+	}
+	o.writeCalendar(w, "ppacerFF events", published)
+}
+
+// AttendeeCalendarHandler serves private iCalendar feed with events the
+// attendee has a spot at. The feed is identified by any of their calendar
+// tokens. Manage tokens from links sent before calendar tokens were
+// introduced are accepted until they expire.
+func (o *Owner) AttendeeCalendarHandler(w http.ResponseWriter, r *http.Request) {
+	token, tErr := LookupToken(o.db, r.PathValue("token"), TokenCalendar,
+		time.Now())
+	if tErr == ErrTokenNotFound {
+		token, tErr = LookupToken(o.db, r.PathValue("token"), TokenManage,
+			time.Now())
+	}
+	if tErr == ErrTokenNotFound || tErr == ErrTokenExpired {
+		http.Error(w, "Calendar not found", http.StatusNotFound)
+		return
+	}
+	if tErr != nil {
+		o.logger.Error("Cannot read calendar token", "err", tErr.Error())
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	events, eErr := AttendeeEvents(o.db, token.Email)
+	if eErr != nil {
+		o.logger.Error("Cannot read attendee events", "email", token.Email,
+			"err", eErr.Error())
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	o.writeCalendar(w, "My ppacerFF events", events)
+}
+
+func (o *Owner) writeCalendar(w http.ResponseWriter, name string, events []EventRow) {
+	w.Header().Set("Content-Type", calendarContentType)
+	w.Header().Set("Cache-Control", "no-cache")
+	_, wErr := w.Write(EventsCalendar(name, events, CurrentTz(), time.Now()))
+	if wErr != nil {
+		o.logger.Error("Cannot write calendar", "err", wErr.Error())
+	}
+}
+
+// attendeeCalendarUrl returns URL of private calendar feed for given calendar
+// token.
+func attendeeCalendarUrl(token string) string {
+	return fmt.Sprintf("%s/calendar/%s", appBaseUrl, token)
+}
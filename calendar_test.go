@@ -0,0 +1,96 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCalendarFeeds(t *testing.T) {
+	db := newTestDb(t)
+	start := time.Date(2030, time.May, 10, 18, 0, 0, 0, time.UTC)
+	for _, e := range []EventRow{
+		{Slug: "meetup", Title: "Meetup", Status: EventStatusPublished},
+		{Slug: "secret", Title: "Secret", Status: EventStatusDraft},
+	} {
+		e.StartTs = ToString(start)
+		e.EndTs = ToString(start.Add(time.Hour))
+		if iErr := InsertEvent(db, e); iErr != nil {
+			t.Fatalf("Cannot insert event: %s", iErr.Error())
+		}
+	}
+	users := []User{
+		{EventSlug: defaultEventSlug, Email: "Ala@X.com", Spot: SpotAttendee},
+		{EventSlug: "meetup", Email: "ala@x.com", Spot: SpotWaitlist},
+		{EventSlug: "secret", Email: "ala@x.com", Spot: SpotAttendee},
+	}
+	for _, u := range users {
+		if iErr := InsertNewUser(db, u); iErr != nil {
+			t.Fatalf("Cannot insert user: %s", iErr.Error())
+		}
+	}
+	token, _ := IssueCalendarToken(db, "ala@x.com")
+	expired, _ := IssueToken(db, defaultEventSlug, "ala@x.com", TokenManage,
+		time.Now().Add(-time.Hour))
+	o := &Owner{db: db, logger: defaultLogger()}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /events.ics", o.CalendarHandler)
+	mux.HandleFunc("GET /calendar/{token}", o.AttendeeCalendarHandler)
+
+	get := func(path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+		return w
+	}
+
+	public := get("/events.ics")
+	body := public.Body.String()
+	if !strings.HasPrefix(public.Header().Get("Content-Type"), "text/calendar") {
+		t.Errorf("Unexpected content type %s", public.Header().Get("Content-Type"))
+	}
+	if !strings.Contains(body, "UID:meetup@") ||
+		!strings.Contains(body, "UID:"+defaultEventSlug+"@") {
+		t.Errorf("Expected published events in public feed:\n%s", body)
+	}
+	if strings.Contains(body, "UID:secret@") {
+		t.Errorf("Draft event should not be in public feed:\n%s", body)
+	}
+
+	// Calendar token doesn't expire, so cleanup keeps it.
+	if _, dErr := DeleteExpiredTokens(db, time.Now().AddDate(10, 0, 0)); dErr != nil {
+		t.Fatalf("Cannot delete expired tokens: %s", dErr.Error())
+	}
+	legacy, _ := IssueToken(db, "meetup", "ala@x.com", TokenManage,
+		time.Now().Add(time.Hour))
+
+	// Private feed contains only visible events with a spot, registrations
+	// are matched by EmailKey.
+	private := get("/calendar/" + token).Body.String()
+	if !strings.Contains(private, "UID:"+defaultEventSlug+"@") {
+		t.Errorf("Expected attended event in private feed:\n%s", private)
+	}
+	if strings.Contains(private, "UID:meetup@") ||
+		strings.Contains(private, "UID:secret@") {
+		t.Errorf("Unexpected events in private feed:\n%s", private)
+	}
+
+	if code := get("/calendar/" + legacy).Code; code != http.StatusOK {
+		t.Errorf("Expected legacy manage token to serve feed, got %d", code)
+	}
+	if code := get("/calendar/unknown").Code; code != http.StatusNotFound {
+		t.Errorf("Expected 404 for unknown token, got %d", code)
+	}
+	if code := get("/calendar/" + expired).Code; code != http.StatusNotFound {
+		t.Errorf("Expected 404 for expired token, got %d", code)
+	}
+
+	revoked, rErr := RevokeCalendarTokens(db, "ALA@x.com")
+	if rErr != nil || revoked != 1 {
+		t.Fatalf("Expected 1 revoked token, got %d (%v)", revoked, rErr)
+	}
+	if code := get("/calendar/" + token).Code; code != http.StatusNotFound {
+		t.Errorf("Expected 404 for revoked token, got %d", code)
+	}
+}
@@ -0,0 +1,435 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+const cliTimeFormat = "2006-01-02 15:04"
+
+// runCommand runs ppacerFF subcommand instead of starting HTTP server. It
+// returns process exit code.
+func runCommand(cfg Config, args []string) int {
+	commands := map[string]func(Config, []string) error{
+		"admin":      adminCommand,
+		"calendar":   calendarCommand,
+		"config":     configCommand,
+		"duplicates": duplicatesCommand,
+		"event":      eventCommand,
+		"export":     exportCommand,
+		"import":     importCommand,
+	}
+	cmd, exists := commands[args[0]]
+	if !exists {
+		fmt.Fprintf(os.Stderr, "Unknown command %q. Available commands: %s\n",
+			args[0], strings.Join(mapKeys(commands), ", "))
+		return 2
+	}
+	if err := cmd(cfg, args[1:]); err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %s\n", args[0], err.Error())
+		return 1
+	}
+	return 0
+}
+
+func eventCommand(cfg Config, args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("expected subcommand: add, list, status or update")
+	}
+	db, dbErr := NewSqliteClient(cfg.Database, defaultLogger())
+	if dbErr != nil {
+		return dbErr
+	}
+	defer db.Close()
+
+	switch args[0] {
+	case "add":
+		return eventAddCommand(db, args[1:])
+	case "list":
+		events, lErr := ListEvents(db)
+		if lErr != nil {
+			return lErr
+		}
+		for _, e := range events {
+			fmt.Printf("%-24s %-10s %s  %s\n", e.Slug, e.Status,
+				e.Start().In(CurrentTz()).Format(cliTimeFormat), e.Title)
+		}
+		return nil
+	case "status":
+		fs := flag.NewFlagSet("event status", flag.ContinueOnError)
+		slug := fs.String("slug", "", "Event slug")
+		status := fs.String("status", "", "New status (draft, published, archived)")
+		if err := fs.Parse(args[1:]); err != nil {
+			return err
+		}
+		if !isValidEventStatus(*status) {
+			return fmt.Errorf("incorrect status %q", *status)
+		}
+		return UpdateEventStatus(db, *slug, *status)
+	case "update":
+		return eventUpdateCommand(cfg, db, args[1:])
+	}
+	return fmt.Errorf("unknown subcommand %q", args[0])
+}
+
+func eventAddCommand(db *SqliteDB, args []string) error {
+	fs := flag.NewFlagSet("event add", flag.ContinueOnError)
+	slug := fs.String("slug", "", "Event slug used in URLs")
+	title := fs.String("title", "", "Event title")
+	start := fs.String("start", "", "Start time ("+cliTimeFormat+")")
+	duration := fs.Duration("duration", 2*time.Hour, "Event duration")
+	venue := fs.String("venue", "", "Event venue")
+	capacity := fs.Int("capacity", 0, "Maximum number of attendees (0 means unlimited)")
+	descFile := fs.String("description", "", "Path to HTML file with event description")
+	status := fs.String("status", EventStatusDraft, "Event status (draft, published, archived)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *slug == "" || *title == "" || *start == "" {
+		return fmt.Errorf("-slug, -title and -start are required")
+	}
+	if !isValidEventStatus(*status) {
+		return fmt.Errorf("incorrect status %q", *status)
+	}
+	startTs, pErr := time.ParseInLocation(cliTimeFormat, *start, CurrentTz())
+	if pErr != nil {
+		return fmt.Errorf("cannot parse start time: %w", pErr)
+	}
+	var description []byte
+	if *descFile != "" {
+		var rErr error
+		description, rErr = os.ReadFile(*descFile)
+		if rErr != nil {
+			return fmt.Errorf("cannot read description: %w", rErr)
+		}
+	}
+	return InsertEvent(db, EventRow{
+		Slug:        *slug,
+		Title:       *title,
+		StartTs:     ToString(startTs),
+		EndTs:       ToString(startTs.Add(*duration)),
+		Venue:       *venue,
+		Description: string(description),
+		Status:      *status,
+		Capacity:    *capacity,
+	})
+}
+
+// eventUpdateCommand reschedules the event or changes its venue. With -notify
+// flag confirmed attendees get updated calendar invite.
+func eventUpdateCommand(cfg Config, db *SqliteDB, args []string) error {
+	fs := flag.NewFlagSet("event update", flag.ContinueOnError)
+	slug := fs.String("slug", "", "Event slug")
+	start := fs.String("start", "", "New start time ("+cliTimeFormat+")")
+	duration := fs.Duration("duration", 0, "New event duration")
+	venue := fs.String("venue", "", "New event venue")
+	notify := fs.Bool("notify", false, "Email updated invite to confirmed attendees")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	event, eErr := EventBySlug(db, *slug)
+	if eErr != nil {
+		return eErr
+	}
+	startTs, endTs := event.Start(), event.End()
+	if *start != "" {
+		var pErr error
+		startTs, pErr = time.ParseInLocation(cliTimeFormat, *start, CurrentTz())
+		if pErr != nil {
+			return fmt.Errorf("cannot parse start time: %w", pErr)
+		}
+		endTs = startTs.Add(event.End().Sub(event.Start()))
+	}
+	if *duration > 0 {
+		endTs = startTs.Add(*duration)
+	}
+	if *venue == "" {
+		*venue = event.Venue
+	}
+	if uErr := UpdateEventSchedule(db, event.Slug, startTs, endTs, *venue); uErr != nil {
+		return uErr
+	}
+	if !*notify {
+		return nil
+	}
+	updated, rErr := EventBySlug(db, event.Slug)
+	if rErr != nil {
+		return rErr
+	}
+	emails, eErr := newEmailTemplates(cfg.Email.TemplatesDir)
+	if eErr != nil {
+		return eErr
+	}
+	// Emails are queued in the outbox and sent by the running server.
+	owner := &Owner{db: db, logger: defaultLogger(), emails: emails}
+	return owner.sendEventUpdate(updated)
+}
+
+// adminCommand manages admin accounts. Passwords are read from standard input,
+// so they don't end up in shell history.
+func adminCommand(cfg Config, args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("expected subcommand: add, list, passwd, reset-2fa or delete")
+	}
+	db, dbErr := NewSqliteClient(cfg.Database, defaultLogger())
+	if dbErr != nil {
+		return dbErr
+	}
+	defer db.Close()
+
+	fs := flag.NewFlagSet("admin "+args[0], flag.ContinueOnError)
+	username := fs.String("username", "", "Admin username")
+	role := fs.String("role", RoleCoOrganizer,
+		"Admin role (owner, co-organizer, door-staff)")
+	if err := fs.Parse(args[1:]); err != nil {
+		return err
+	}
+	if args[0] != "list" && *username == "" {
+		return fmt.Errorf("-username is required")
+	}
+
+	switch args[0] {
+	case "add":
+		password, pErr := readPassword()
+		if pErr != nil {
+			return pErr
+		}
+		return CreateAdmin(db, *username, password, *role)
+	case "passwd":
+		password, pErr := readPassword()
+		if pErr != nil {
+			return pErr
+		}
+		return SetAdminPassword(db, *username, password)
+	case "reset-2fa":
+		return ResetTotp(db, *username)
+	case "delete":
+		return DeleteAdmin(db, *username)
+	case "list":
+		admins, lErr := ListAdmins(db)
+		if lErr != nil {
+			return lErr
+		}
+		for _, a := range admins {
+			fmt.Printf("%-24s %s\n", a.Username, a.Role)
+		}
+		return nil
+	}
+	return fmt.Errorf("unknown subcommand %q", args[0])
+}
+
+func readPassword() (string, error) {
+	fmt.Fprint(os.Stderr, "Password: ")
+	line, rErr := bufio.NewReader(os.Stdin).ReadString('\n')
+	if rErr != nil && rErr != io.EOF {
+		return "", fmt.Errorf("cannot read password: %w", rErr)
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+// exportCommand writes registrations to standard output or to a file.
+func exportCommand(cfg Config, args []string) error {
+	fs := flag.NewFlagSet("export", flag.ContinueOnError)
+	format := fs.String("format", ExportCSV, "Output format (csv, jsonl, xlsx)")
+	columns := fs.String("columns", "", "Comma-separated list of columns: "+
+		strings.Join(exportColumnNames(), ","))
+	event := fs.String("event", "", "Export only registrations for given event")
+	confirmed := fs.String("confirmed", "", "Filter by confirmation (yes, no)")
+	drinks := fs.String("drinks", "", "Filter by drinks (yes, no)")
+	tz := fs.String("tz", "", "Timezone for timestamps, e.g. Europe/Warsaw")
+	output := fs.String("o", "", "Output file (default: standard output)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	opts, oErr := parseExportOptions(*format, *columns, *tz)
+	if oErr != nil {
+		return oErr
+	}
+	f := adminFilter{Event: *event, Confirmed: *confirmed, Drinks: *drinks}
+	filter, fErr := f.userFilter()
+	if fErr != nil {
+		return fErr
+	}
+	opts.Filter = filter
+
+	db, dbErr := NewSqliteClient(cfg.Database, defaultLogger())
+	if dbErr != nil {
+		return dbErr
+	}
+	defer db.Close()
+
+	var out io.Writer = os.Stdout
+	if *output != "" {
+		file, cErr := os.Create(*output)
+		if cErr != nil {
+			return cErr
+		}
+		defer file.Close()
+		out = file
+	}
+	return ExportUsers(out, db, opts)
+}
+
+func importCommand(cfg Config, args []string) error {
+	fs := flag.NewFlagSet("import", flag.ContinueOnError)
+	event := fs.String("event", defaultEventSlug, "Event slug")
+	file := fs.String("file", "", "CSV file with email, nickname and drinks columns")
+	confirmation := fs.String("confirmation", ImportUnconfirmed,
+		"What to do with imported registrations (unconfirmed, preconfirmed, email)")
+	dryRun := fs.Bool("dry-run", false, "Only validate the file and print report")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *file == "" {
+		return fmt.Errorf("-file is required")
+	}
+	in, oErr := os.Open(*file)
+	if oErr != nil {
+		return oErr
+	}
+	defer in.Close()
+
+	logger := defaultLogger()
+	db, dbErr := NewSqliteClient(cfg.Database, logger)
+	if dbErr != nil {
+		return dbErr
+	}
+	defer db.Close()
+
+	emails, eErr := newEmailTemplates(cfg.Email.TemplatesDir)
+	if eErr != nil {
+		return eErr
+	}
+	// Confirmation emails are queued in the outbox and sent by the running
+	// server. Capacity alerts are only logged.
+	owner := &Owner{db: db, logger: logger, emails: emails,
+		notifier: LogNotifier{logger: logger}}
+	report, iErr := owner.ImportUsers(in, ImportOptions{
+		EventSlug:    *event,
+		Confirmation: *confirmation,
+		DryRun:       *dryRun,
+	})
+	if iErr != nil {
+		return iErr
+	}
+	for _, row := range report.Rows {
+		fmt.Printf("%5d  %-10s %-9s %-40s %s\n", row.Line, row.Status, row.Spot,
+			row.Email, row.Message)
+	}
+	verb := "imported"
+	if report.DryRun {
+		verb = "would be imported"
+	}
+	fmt.Printf("%d rows %s, %d duplicates, %d invalid\n", report.Imported,
+		verb, report.Duplicates, report.Invalid)
+	return nil
+}
+
+// duplicatesCommand lists near-duplicate registrations found when EmailKey
+// was introduced and deletes the ones which are not needed. Freed spot is
+// offered to the waitlist and the email is sent by the running server.
+func duplicatesCommand(cfg Config, args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("expected subcommand: list or delete")
+	}
+	logger := defaultLogger()
+	db, dbErr := NewSqliteClient(cfg.Database, logger)
+	if dbErr != nil {
+		return dbErr
+	}
+	defer db.Close()
+
+	switch args[0] {
+	case "list":
+		duplicates, dErr := EmailDuplicates(db)
+		if dErr != nil {
+			return dErr
+		}
+		for _, d := range duplicates {
+			fmt.Printf("%-24s %-40s duplicate of %s\n", d.EventSlug, d.Email,
+				d.DuplicateOf)
+		}
+		fmt.Printf("%d near-duplicate registrations\n", len(duplicates))
+		return nil
+	case "delete":
+		fs := flag.NewFlagSet("duplicates delete", flag.ContinueOnError)
+		slug := fs.String("event", defaultEventSlug, "Event slug")
+		email := fs.String("email", "", "Exact email of registration to delete")
+		if err := fs.Parse(args[1:]); err != nil {
+			return err
+		}
+		event, eErr := EventBySlug(db, *slug)
+		if eErr != nil {
+			return eErr
+		}
+		if dErr := DeleteUser(db, event.Slug, *email); dErr != nil {
+			return fmt.Errorf("cannot delete registration %q: %w", *email, dErr)
+		}
+		emails, tmplErr := newEmailTemplates(cfg.Email.TemplatesDir)
+		if tmplErr != nil {
+			return tmplErr
+		}
+		owner := &Owner{db: db, logger: logger, emails: emails,
+			notifier: LogNotifier{logger: logger}}
+		owner.promoteFromWaitlist(event)
+		fmt.Printf("Registration %s for %s deleted\n", *email, event.Slug)
+		return nil
+	}
+	return fmt.Errorf("unknown subcommand %q", args[0])
+}
+
+// calendarCommand revokes private calendar feed links of a person, e.g. when
+// a link leaked. New link is sent with the next attendance confirmation.
+func calendarCommand(cfg Config, args []string) error {
+	if len(args) == 0 || args[0] != "revoke" {
+		return fmt.Errorf("expected subcommand: revoke")
+	}
+	fs := flag.NewFlagSet("calendar revoke", flag.ContinueOnError)
+	email := fs.String("email", "", "Email of the attendee")
+	if err := fs.Parse(args[1:]); err != nil {
+		return err
+	}
+	if *email == "" {
+		return fmt.Errorf("email is required")
+	}
+	db, dbErr := NewSqliteClient(cfg.Database, defaultLogger())
+	if dbErr != nil {
+		return dbErr
+	}
+	defer db.Close()
+
+	revoked, rErr := RevokeCalendarTokens(db, *email)
+	if rErr != nil {
+		return rErr
+	}
+	fmt.Printf("%d calendar links of %s revoked\n", revoked, *email)
+	return nil
+}
+
+// configCommand prints effective configuration, after applying config file,
+// environment variables and flags, with secrets redacted.
+func configCommand(cfg Config, args []string) error {
+	if len(args) != 1 || args[0] != "print" {
+		return fmt.Errorf("expected subcommand: print")
+	}
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetEscapeHTML(false)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(cfg.Redacted())
+}
+
+func mapKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,555 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"net/mail"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// Environment variables overriding settings from the config file. Empty
+// variable is treated as not set.
+const (
+	// Configuration file (TOML, YAML or JSON, by extension). It can also be
+	// given by -config flag.
+	PPACER_FF_ENV_CONFIG    = "PPACER_FF_CONFIG"
+	PPACER_FF_ENV_PORT      = "PPACER_FF_PORT"
+	PPACER_FF_ENV_BASE_URL  = "PPACER_FF_BASE_URL"
+	PPACER_FF_ENV_TIMEZONE  = "PPACER_FF_TIMEZONE"
+	PPACER_FF_ENV_LOG_LEVEL = "PPACER_FF_LOG_LEVEL"
+
+	PPACER_FF_ENV_DB_PATH    = "PPACER_FF_DB_PATH"
+	PPACER_FF_ENV_DB_OPTIONS = "PPACER_FF_DB_OPTIONS"
+
+	PPACER_FF_ENV_EMAIL_FROM = "PPACER_FF_EMAIL_FROM"
+	// Email backend: smtp (default), sendmail, file or http.
+	PPACER_FF_ENV_MAILER        = "PPACER_FF_MAILER"
+	PPACER_FF_ENV_SENDMAIL_PATH = "PPACER_FF_SENDMAIL_PATH"
+	PPACER_FF_ENV_MAIL_DIR      = "PPACER_FF_MAIL_DIR"
+	PPACER_FF_ENV_MAIL_API_URL  = "PPACER_FF_MAIL_API_URL"
+	PPACER_FF_ENV_MAIL_API_KEY  = "PPACER_FF_MAIL_API_KEY"
+	// SMTP connection security: auto (default), starttls or implicit. In auto
+	// mode implicit TLS is used on port 465 and STARTTLS on any other port.
+	PPACER_FF_ENV_SMTP_TLS = "PPACER_FF_SMTP_TLS"
+	// PEM bundle with additional CA certificates trusted for SMTP server, for
+	// example for self-hosted relays.
+	PPACER_FF_ENV_SMTP_CA_FILE      = "PPACER_FF_SMTP_CA_FILE"
+	PPACER_FF_ENV_EMAIL_SECRET_NAME = "PPACER_FF_EMAIL_SECRET_NAME"
+	// Directory with email templates which take precedence over embedded
+	// ones. Files are read on each render, so they can be edited without
+	// restarting the server.
+	PPACER_FF_ENV_EMAIL_TEMPLATES_DIR = "PPACER_FF_EMAIL_TEMPLATES_DIR"
+	// DKIM selector. Signing is enabled when it's set. Private key is read
+	// from email secrets (dkimPrivateKey field, PEM encoded RSA or Ed25519
+	// key).
+	PPACER_FF_ENV_DKIM_SELECTOR = "PPACER_FF_DKIM_SELECTOR"
+	// DKIM signing domain, by default domain of the sender address.
+	PPACER_FF_ENV_DKIM_DOMAIN = "PPACER_FF_DKIM_DOMAIN"
+	// Colon separated list of signed headers.
+	PPACER_FF_ENV_DKIM_HEADERS = "PPACER_FF_DKIM_HEADERS"
+	// Shared secret for bounce webhook. It's expected as token query parameter
+	// (SNS subscriptions cannot set headers) or as bearer token. When it's not
+	// set, the webhook is disabled.
+	PPACER_FF_ENV_BOUNCE_WEBHOOK_TOKEN = "PPACER_FF_BOUNCE_WEBHOOK_TOKEN"
+
+	// Secrets backend: aws (default), env, file or dir.
+	PPACER_FF_ENV_SECRETS = "PPACER_FF_SECRETS"
+	// JSON or YAML file with secrets for file backend.
+	PPACER_FF_ENV_SECRETS_FILE = "PPACER_FF_SECRETS_FILE"
+	// Directory with mounted secret files for dir backend.
+	PPACER_FF_ENV_SECRETS_DIR = "PPACER_FF_SECRETS_DIR"
+	// How long secrets are cached before they are read again, so rotated
+	// secrets are picked up without restart.
+	PPACER_FF_ENV_SECRETS_TTL = "PPACER_FF_SECRETS_TTL"
+	PPACER_FF_ENV_AWS_REGION  = "PPACER_FF_AWS_REGION"
+
+	// Comma-separated list of notifiers which should receive organizer
+	// alerts: telegram, slack, discord, matrix, webhook. "none" disables
+	// alerts.
+	PPACER_FF_ENV_NOTIFIERS            = "PPACER_FF_NOTIFIERS"
+	PPACER_FF_ENV_TELEGRAM_API_URL     = "PPACER_FF_TELEGRAM_API_URL"
+	PPACER_FF_ENV_TELEGRAM_SECRET_NAME = "PPACER_FF_TELEGRAM_SECRET_NAME"
+	PPACER_FF_ENV_SLACK_WEBHOOK_URL    = "PPACER_FF_SLACK_WEBHOOK_URL"
+	PPACER_FF_ENV_DISCORD_WEBHOOK      = "PPACER_FF_DISCORD_WEBHOOK_URL"
+	PPACER_FF_ENV_MATRIX_HOMESERVER    = "PPACER_FF_MATRIX_HOMESERVER_URL"
+	PPACER_FF_ENV_MATRIX_TOKEN         = "PPACER_FF_MATRIX_ACCESS_TOKEN"
+	PPACER_FF_ENV_MATRIX_ROOM_ID       = "PPACER_FF_MATRIX_ROOM_ID"
+	PPACER_FF_ENV_WEBHOOK_URL          = "PPACER_FF_WEBHOOK_URL"
+	PPACER_FF_ENV_WEBHOOK_AUTH_TOKEN   = "PPACER_FF_WEBHOOK_AUTH_TOKEN"
+
+	// Comma-separated registration ages after which unconfirmed people get
+	// confirmation reminder, like "24h,72h". "none" disables reminders.
+	PPACER_FF_ENV_CONFIRM_REMINDERS = "PPACER_FF_CONFIRM_REMINDERS"
+	// Hour (0-23) after which daily summary of unconfirmed registrations is
+	// sent to organizers.
+	PPACER_FF_ENV_SUMMARY_HOUR = "PPACER_FF_SUMMARY_HOUR"
+)
+
+const (
+	defaultPort          = 7272
+	defaultBaseUrl       = "https://ff.ppacer.org"
+	defaultLogLevel      = "WARN"
+	defaultDbFilePath    = "ppacer_ff.db"
+	defaultSqliteOptions = "cache=shared&mode=rwc&_journal_mode=WAL"
+	defaultFrom          = "info@dskrzypiec.dev"
+	defaultSummaryHour   = 9
+
+	redactedValue = "<redacted>"
+)
+
+// Config is the application configuration. Settings are applied in order:
+// defaults, config file, environment variables and command line flags.
+type Config struct {
+	// Dev enables development mode, see devConfig.
+	Dev      bool   `json:"dev"`
+	Port     int    `json:"port"`
+	BaseUrl  string `json:"base_url"`
+	Timezone string `json:"timezone"`
+	LogLevel string `json:"log_level"`
+
+	Database  DatabaseConfig  `json:"database"`
+	Email     EmailConfig     `json:"email"`
+	Secrets   SecretsConfig   `json:"secrets"`
+	Notifiers NotifiersConfig `json:"notifiers"`
+	Reminders RemindersConfig `json:"reminders"`
+}
+
+type DatabaseConfig struct {
+	Path string `json:"path"`
+	// Options are SQLite connection string parameters.
+	Options string `json:"options"`
+}
+
+type EmailConfig struct {
+	From   string `json:"from"`
+	Mailer string `json:"mailer"`
+
+	SendmailPath string `json:"sendmail_path"`
+	MailDir      string `json:"mail_dir"`
+	ApiUrl       string `json:"api_url"`
+	ApiKey       string `json:"api_key"`
+	SmtpTLS      string `json:"smtp_tls"`
+	SmtpCAFile   string `json:"smtp_ca_file"`
+
+	// SecretName is the name of secret with SMTP credentials and DKIM key.
+	SecretName   string   `json:"secret_name"`
+	TemplatesDir string   `json:"templates_dir"`
+	DKIMSelector string   `json:"dkim_selector"`
+	DKIMDomain   string   `json:"dkim_domain"`
+	DKIMHeaders  []string `json:"dkim_headers"`
+
+	BounceWebhookToken string `json:"bounce_webhook_token"`
+}
+
+type SecretsConfig struct {
+	Backend   string   `json:"backend"`
+	File      string   `json:"file"`
+	Dir       string   `json:"dir"`
+	TTL       Duration `json:"ttl"`
+	AwsRegion string   `json:"aws_region"`
+}
+
+type NotifiersConfig struct {
+	Enabled []string `json:"enabled"`
+
+	TelegramApiUrl     string `json:"telegram_api_url"`
+	TelegramSecretName string `json:"telegram_secret_name"`
+	SlackWebhookUrl    string `json:"slack_webhook_url"`
+	DiscordWebhookUrl  string `json:"discord_webhook_url"`
+	MatrixHomeserver   string `json:"matrix_homeserver_url"`
+	MatrixAccessToken  string `json:"matrix_access_token"`
+	MatrixRoomId       string `json:"matrix_room_id"`
+	WebhookUrl         string `json:"webhook_url"`
+	WebhookAuthToken   string `json:"webhook_auth_token"`
+}
+
+type RemindersConfig struct {
+	// ConfirmAfter lists registration ages, in ascending order, after which
+	// unconfirmed people get a reminder. Its length is the maximum number of
+	// reminders per person.
+	ConfirmAfter []Duration `json:"confirm_after"`
+	// SummaryHour is the hour after which daily summary of unconfirmed
+	// registrations is sent.
+	SummaryHour int `json:"summary_hour"`
+}
+
+// Duration is time.Duration written in config files as string, like "10m".
+type Duration struct {
+	time.Duration
+}
+
+func (d Duration) MarshalText() ([]byte, error) {
+	return []byte(d.String()), nil
+}
+
+func (d *Duration) UnmarshalText(text []byte) error {
+	value, err := time.ParseDuration(string(text))
+	if err != nil {
+		return err
+	}
+	d.Duration = value
+	return nil
+}
+
+// DefaultConfig returns configuration used when nothing is overridden.
+func DefaultConfig() Config {
+	return Config{
+		Port:     defaultPort,
+		BaseUrl:  defaultBaseUrl,
+		Timezone: eventsTimezone,
+		LogLevel: defaultLogLevel,
+		Database: DatabaseConfig{
+			Path:    defaultDbFilePath,
+			Options: defaultSqliteOptions,
+		},
+		Email: EmailConfig{
+			From:         defaultFrom,
+			Mailer:       "smtp",
+			SendmailPath: defaultSendmailPath,
+			SmtpTLS:      SMTPTLSAuto,
+			SecretName:   emailSecretName,
+			DKIMHeaders:  strings.Split(dkimDefaultHeaders, ":"),
+		},
+		Secrets: SecretsConfig{
+			Backend:   "aws",
+			TTL:       Duration{defaultSecretTTL},
+			AwsRegion: defaultAwsRegion,
+		},
+		Notifiers: NotifiersConfig{
+			Enabled:            []string{"telegram"},
+			TelegramApiUrl:     telegramApiUrl,
+			TelegramSecretName: telegramSecretName,
+		},
+		Reminders: RemindersConfig{
+			ConfirmAfter: []Duration{{24 * time.Hour}, {72 * time.Hour}},
+			SummaryHour:  defaultSummaryHour,
+		},
+	}
+}
+
+// LoadConfig parses command line flags and builds configuration from
+// defaults, config file given by -config flag or PPACER_FF_ENV_CONFIG,
+// environment variables and flags. Resulting configuration is validated.
+// Arguments after flags are available in fs.Args().
+func LoadConfig(fs *flag.FlagSet, args []string) (Config, error) {
+	cfg := DefaultConfig()
+	configPath := fs.String("config", os.Getenv(PPACER_FF_ENV_CONFIG),
+		"Configuration file (TOML, YAML or JSON)")
+	dev := fs.Bool("dev", cfg.Dev,
+		"Development mode: throwaway database with sample data, emails captured at /dev/mail")
+	port := fs.Int("port", cfg.Port, "Port for HTTP server")
+	dbPath := fs.String("db", cfg.Database.Path, "SQLite database file")
+	baseUrl := fs.String("base-url", cfg.BaseUrl,
+		"Public URL of the application, used in emails")
+	logLevel := fs.String("log-level", cfg.LogLevel,
+		"Log level: DEBUG, INFO, WARN or ERROR")
+	if err := fs.Parse(args); err != nil {
+		return cfg, err
+	}
+
+	if *configPath != "" {
+		if err := cfg.loadFile(*configPath); err != nil {
+			return cfg, err
+		}
+	}
+	if err := cfg.applyEnv(); err != nil {
+		return cfg, err
+	}
+	// Only flags given explicitly override other sources.
+	fs.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "dev":
+			cfg.Dev = *dev
+		case "port":
+			cfg.Port = *port
+		case "db":
+			cfg.Database.Path = *dbPath
+		case "base-url":
+			cfg.BaseUrl = *baseUrl
+		case "log-level":
+			cfg.LogLevel = *logLevel
+		}
+	})
+	cfg.BaseUrl = strings.TrimRight(cfg.BaseUrl, "/")
+	return cfg, cfg.Validate()
+}
+
+// loadFile reads config file on top of current settings. Format is chosen by
+// file extension. Unknown keys are reported, so typos don't go unnoticed.
+func (c *Config) loadFile(path string) error {
+	content, rErr := os.ReadFile(path)
+	if rErr != nil {
+		return fmt.Errorf("cannot read config file: %w", rErr)
+	}
+	// TOML and YAML are converted into JSON, so a single set of struct tags
+	// describes all formats.
+	var raw map[string]any
+	var pErr error
+	switch ext := strings.ToLower(filepath.Ext(path)); ext {
+	case ".toml":
+		_, pErr = toml.Decode(string(content), &raw)
+	case ".yaml", ".yml":
+		pErr = yaml.Unmarshal(content, &raw)
+	case ".json":
+	default:
+		return fmt.Errorf("unsupported config file extension %q, expected .toml, .yaml or .json",
+			ext)
+	}
+	if pErr != nil {
+		return fmt.Errorf("cannot parse config file %s: %w", path, pErr)
+	}
+	if raw != nil {
+		var mErr error
+		if content, mErr = json.Marshal(raw); mErr != nil {
+			return fmt.Errorf("cannot parse config file %s: %w", path, mErr)
+		}
+	}
+	decoder := json.NewDecoder(bytes.NewReader(content))
+	decoder.DisallowUnknownFields()
+	if dErr := decoder.Decode(c); dErr != nil {
+		return fmt.Errorf("cannot parse config file %s: %w", path, dErr)
+	}
+	return nil
+}
+
+// applyEnv overrides settings by PPACER_FF_ENV_* variables.
+func (c *Config) applyEnv() error {
+	stringSettings := map[string]*string{
+		PPACER_FF_ENV_BASE_URL:             &c.BaseUrl,
+		PPACER_FF_ENV_TIMEZONE:             &c.Timezone,
+		PPACER_FF_ENV_LOG_LEVEL:            &c.LogLevel,
+		PPACER_FF_ENV_DB_PATH:              &c.Database.Path,
+		PPACER_FF_ENV_DB_OPTIONS:           &c.Database.Options,
+		PPACER_FF_ENV_EMAIL_FROM:           &c.Email.From,
+		PPACER_FF_ENV_MAILER:               &c.Email.Mailer,
+		PPACER_FF_ENV_SENDMAIL_PATH:        &c.Email.SendmailPath,
+		PPACER_FF_ENV_MAIL_DIR:             &c.Email.MailDir,
+		PPACER_FF_ENV_MAIL_API_URL:         &c.Email.ApiUrl,
+		PPACER_FF_ENV_MAIL_API_KEY:         &c.Email.ApiKey,
+		PPACER_FF_ENV_SMTP_TLS:             &c.Email.SmtpTLS,
+		PPACER_FF_ENV_SMTP_CA_FILE:         &c.Email.SmtpCAFile,
+		PPACER_FF_ENV_EMAIL_SECRET_NAME:    &c.Email.SecretName,
+		PPACER_FF_ENV_EMAIL_TEMPLATES_DIR:  &c.Email.TemplatesDir,
+		PPACER_FF_ENV_DKIM_SELECTOR:        &c.Email.DKIMSelector,
+		PPACER_FF_ENV_DKIM_DOMAIN:          &c.Email.DKIMDomain,
+		PPACER_FF_ENV_BOUNCE_WEBHOOK_TOKEN: &c.Email.BounceWebhookToken,
+		PPACER_FF_ENV_SECRETS:              &c.Secrets.Backend,
+		PPACER_FF_ENV_SECRETS_FILE:         &c.Secrets.File,
+		PPACER_FF_ENV_SECRETS_DIR:          &c.Secrets.Dir,
+		PPACER_FF_ENV_AWS_REGION:           &c.Secrets.AwsRegion,
+		PPACER_FF_ENV_TELEGRAM_API_URL:     &c.Notifiers.TelegramApiUrl,
+		PPACER_FF_ENV_TELEGRAM_SECRET_NAME: &c.Notifiers.TelegramSecretName,
+		PPACER_FF_ENV_SLACK_WEBHOOK_URL:    &c.Notifiers.SlackWebhookUrl,
+		PPACER_FF_ENV_DISCORD_WEBHOOK:      &c.Notifiers.DiscordWebhookUrl,
+		PPACER_FF_ENV_MATRIX_HOMESERVER:    &c.Notifiers.MatrixHomeserver,
+		PPACER_FF_ENV_MATRIX_TOKEN:         &c.Notifiers.MatrixAccessToken,
+		PPACER_FF_ENV_MATRIX_ROOM_ID:       &c.Notifiers.MatrixRoomId,
+		PPACER_FF_ENV_WEBHOOK_URL:          &c.Notifiers.WebhookUrl,
+		PPACER_FF_ENV_WEBHOOK_AUTH_TOKEN:   &c.Notifiers.WebhookAuthToken,
+	}
+	for name, setting := range stringSettings {
+		if value := os.Getenv(name); value != "" {
+			*setting = value
+		}
+	}
+
+	if value := os.Getenv(PPACER_FF_ENV_PORT); value != "" {
+		port, err := strconv.Atoi(value)
+		if err != nil {
+			return fmt.Errorf("incorrect %s: %w", PPACER_FF_ENV_PORT, err)
+		}
+		c.Port = port
+	}
+	if value := os.Getenv(PPACER_FF_ENV_SECRETS_TTL); value != "" {
+		if err := c.Secrets.TTL.UnmarshalText([]byte(value)); err != nil {
+			return fmt.Errorf("incorrect %s: %w", PPACER_FF_ENV_SECRETS_TTL,
+				err)
+		}
+	}
+	if value := os.Getenv(PPACER_FF_ENV_CONFIRM_REMINDERS); value == "none" {
+		c.Reminders.ConfirmAfter = nil
+	} else if value != "" {
+		c.Reminders.ConfirmAfter = nil
+		for _, age := range strings.Split(value, ",") {
+			var d Duration
+			if err := d.UnmarshalText([]byte(strings.TrimSpace(age))); err != nil {
+				return fmt.Errorf("incorrect %s: %w",
+					PPACER_FF_ENV_CONFIRM_REMINDERS, err)
+			}
+			c.Reminders.ConfirmAfter = append(c.Reminders.ConfirmAfter, d)
+		}
+	}
+	if value := os.Getenv(PPACER_FF_ENV_SUMMARY_HOUR); value != "" {
+		hour, err := strconv.Atoi(value)
+		if err != nil {
+			return fmt.Errorf("incorrect %s: %w", PPACER_FF_ENV_SUMMARY_HOUR,
+				err)
+		}
+		c.Reminders.SummaryHour = hour
+	}
+	if value := os.Getenv(PPACER_FF_ENV_DKIM_HEADERS); value != "" {
+		c.Email.DKIMHeaders = strings.Split(value, ":")
+	}
+	if value := os.Getenv(PPACER_FF_ENV_NOTIFIERS); value == "none" {
+		c.Notifiers.Enabled = nil
+	} else if value != "" {
+		c.Notifiers.Enabled = nil
+		for _, name := range strings.Split(value, ",") {
+			c.Notifiers.Enabled = append(c.Notifiers.Enabled,
+				strings.TrimSpace(name))
+		}
+	}
+	return nil
+}
+
+// Validate checks whether configuration is complete and consistent. All
+// problems are reported at once.
+func (c Config) Validate() error {
+	var errs []error
+	check := func(ok bool, format string, args ...any) {
+		if !ok {
+			errs = append(errs, fmt.Errorf(format, args...))
+		}
+	}
+	oneOf := func(setting, value string, allowed ...string) {
+		check(slices.Contains(allowed, value), "%s %q is not one of: %s",
+			setting, value, strings.Join(allowed, ", "))
+	}
+
+	check(c.Port > 0 && c.Port < 65536, "port %d is out of range", c.Port)
+	u, uErr := url.Parse(c.BaseUrl)
+	check(uErr == nil && (u.Scheme == "http" || u.Scheme == "https") &&
+		u.Host != "", "base_url %q is not an absolute http(s) URL", c.BaseUrl)
+	_, tzErr := time.LoadLocation(c.Timezone)
+	check(tzErr == nil, "unknown timezone %q", c.Timezone)
+	_, lErr := parseLogLevel(c.LogLevel)
+	check(lErr == nil, "%v", lErr)
+	check(c.Database.Path != "", "database.path is required")
+
+	addr, aErr := mail.ParseAddress(c.Email.From)
+	check(aErr == nil && addr.Name == "",
+		"email.from %q is not a plain email address", c.Email.From)
+	oneOf("email.mailer", c.Email.Mailer, "smtp", "sendmail", "file", "http")
+	oneOf("email.smtp_tls", c.Email.SmtpTLS, SMTPTLSAuto, SMTPTLSStartTLS,
+		SMTPTLSImplicit)
+	switch c.Email.Mailer {
+	case "sendmail":
+		check(c.Email.SendmailPath != "", "sendmail mailer requires email.sendmail_path")
+	case "file":
+		check(c.Email.MailDir != "", "file mailer requires email.mail_dir")
+	case "http":
+		check(c.Email.ApiUrl != "", "http mailer requires email.api_url")
+		check(c.Email.DKIMSelector == "",
+			"http mailer does not sign messages, configure DKIM at the email provider instead")
+	}
+	check(c.Email.DKIMSelector == "" || len(c.Email.DKIMHeaders) > 0,
+		"email.dkim_headers cannot be empty")
+
+	oneOf("secrets.backend", c.Secrets.Backend, "aws", "env", "file", "dir")
+	switch c.Secrets.Backend {
+	case "aws":
+		check(c.Secrets.AwsRegion != "", "aws secrets require secrets.aws_region")
+	case "file":
+		check(c.Secrets.File != "", "file secrets require secrets.file")
+	case "dir":
+		check(c.Secrets.Dir != "", "dir secrets require secrets.dir")
+	}
+	check(c.Secrets.TTL.Duration > 0, "secrets.ttl must be positive")
+
+	n := c.Notifiers
+	for _, name := range n.Enabled {
+		oneOf("notifier", name, "telegram", "slack", "discord", "matrix",
+			"webhook")
+		switch name {
+		case "telegram":
+			check(n.TelegramApiUrl != "" && n.TelegramSecretName != "",
+				"telegram notifier requires notifiers.telegram_api_url and notifiers.telegram_secret_name")
+		case "slack":
+			check(n.SlackWebhookUrl != "",
+				"slack notifier requires notifiers.slack_webhook_url")
+		case "discord":
+			check(n.DiscordWebhookUrl != "",
+				"discord notifier requires notifiers.discord_webhook_url")
+		case "matrix":
+			check(n.MatrixHomeserver != "" && n.MatrixAccessToken != "" &&
+				n.MatrixRoomId != "",
+				"matrix notifier requires notifiers.matrix_homeserver_url, notifiers.matrix_access_token and notifiers.matrix_room_id")
+		case "webhook":
+			check(n.WebhookUrl != "",
+				"webhook notifier requires notifiers.webhook_url")
+		}
+	}
+
+	for idx, after := range c.Reminders.ConfirmAfter {
+		check(after.Duration > 0 &&
+			(idx == 0 || after.Duration > c.Reminders.ConfirmAfter[idx-1].Duration),
+			"reminders.confirm_after must be positive and in ascending order")
+	}
+	check(c.Reminders.SummaryHour >= 0 && c.Reminders.SummaryHour < 24,
+		"reminders.summary_hour %d is out of range", c.Reminders.SummaryHour)
+	return errors.Join(errs...)
+}
+
+// Redacted returns copy of the configuration with secrets replaced, so it can
+// be printed or logged. Webhook URLs are secrets as well, since anyone who
+// knows them can post messages.
+func (c Config) Redacted() Config {
+	secrets := []*string{
+		&c.Email.ApiKey,
+		&c.Email.BounceWebhookToken,
+		&c.Notifiers.SlackWebhookUrl,
+		&c.Notifiers.DiscordWebhookUrl,
+		&c.Notifiers.MatrixAccessToken,
+		&c.Notifiers.WebhookUrl,
+		&c.Notifiers.WebhookAuthToken,
+	}
+	for _, secret := range secrets {
+		if *secret != "" {
+			*secret = redactedValue
+		}
+	}
+	return c
+}
+
+// applyConfig sets package-level settings used by code without access to
+// Owner, like email and calendar builders.
+func applyConfig(cfg Config) error {
+	if err := SetTimezone(cfg.Timezone); err != nil {
+		return err
+	}
+	level, lErr := parseLogLevel(cfg.LogLevel)
+	if lErr != nil {
+		return lErr
+	}
+	logLevel = level
+	appBaseUrl = cfg.BaseUrl
+	from = cfg.Email.From
+	return nil
+}
+
+func parseLogLevel(level string) (slog.Level, error) {
+	switch strings.ToUpper(level) {
+	case "DEBUG":
+		return slog.LevelDebug, nil
+	case "INFO":
+		return slog.LevelInfo, nil
+	case "WARN":
+		return slog.LevelWarn, nil
+	case "ERROR":
+		return slog.LevelError, nil
+	}
+	return slog.LevelWarn, fmt.Errorf("unknown log level %q", level)
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func loadTestConfig(t *testing.T, args ...string) (Config, error) {
+	t.Helper()
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	return LoadConfig(fs, args)
+}
+
+func TestLoadConfigFormats(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"ppacer.toml": `
+base_url = "https://example.com/"
+[database]
+path = "/data/ff.db"
+[secrets]
+backend = "env"
+ttl = "1m"
+[notifiers]
+enabled = ["slack"]
+slack_webhook_url = "https://hooks.slack.com/x"
+`,
+		"ppacer.yaml": `
+base_url: https://example.com/
+database:
+  path: /data/ff.db
+secrets:
+  backend: env
+  ttl: 1m
+notifiers:
+  enabled: [slack]
+  slack_webhook_url: https://hooks.slack.com/x
+`,
+		"ppacer.json": `{
+  "base_url": "https://example.com/",
+  "database": {"path": "/data/ff.db"},
+  "secrets": {"backend": "env", "ttl": "1m"},
+  "notifiers": {"enabled": ["slack"], "slack_webhook_url": "https://hooks.slack.com/x"}
+}`,
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		os.WriteFile(path, []byte(content), 0o600)
+		cfg, err := loadTestConfig(t, "-config", path)
+		if err != nil {
+			t.Errorf("Cannot load %s: %s", name, err.Error())
+			continue
+		}
+		if cfg.BaseUrl != "https://example.com" || cfg.Database.Path != "/data/ff.db" ||
+			cfg.Secrets.TTL.Duration != time.Minute ||
+			len(cfg.Notifiers.Enabled) != 1 || cfg.Notifiers.Enabled[0] != "slack" {
+			t.Errorf("Unexpected config from %s: %+v", name, cfg)
+		}
+		// Settings missing in the file keep defaults.
+		if cfg.Port != defaultPort || cfg.Database.Options != defaultSqliteOptions ||
+			cfg.Email.From != defaultFrom {
+			t.Errorf("Expected defaults for settings missing in %s, got %+v",
+				name, cfg)
+		}
+	}
+
+	typo := filepath.Join(dir, "typo.yaml")
+	os.WriteFile(typo, []byte("databse:\n  path: x.db\n"), 0o600)
+	if _, err := loadTestConfig(t, "-config", typo); err == nil {
+		t.Error("Expected error for unknown key")
+	}
+}
+
+func TestLoadConfigOverrides(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "ppacer.toml")
+	os.WriteFile(path, []byte(`
+port = 8000
+log_level = "INFO"
+[database]
+path = "file.db"
+`), 0o600)
+	t.Setenv(PPACER_FF_ENV_CONFIG, path)
+	t.Setenv(PPACER_FF_ENV_PORT, "9000")
+	t.Setenv(PPACER_FF_ENV_DB_PATH, "env.db")
+	t.Setenv(PPACER_FF_ENV_NOTIFIERS, "none")
+	t.Setenv(PPACER_FF_ENV_SECRETS, "env")
+
+	cfg, err := loadTestConfig(t, "-db", "flag.db", "event", "list")
+	if err != nil {
+		t.Fatalf("Cannot load config: %s", err.Error())
+	}
+	if cfg.LogLevel != "INFO" {
+		t.Errorf("Expected log level from file, got %s", cfg.LogLevel)
+	}
+	if cfg.Port != 9000 {
+		t.Errorf("Expected port from environment, got %d", cfg.Port)
+	}
+	if cfg.Database.Path != "flag.db" {
+		t.Errorf("Expected database path from flag, got %s", cfg.Database.Path)
+	}
+	if len(cfg.Notifiers.Enabled) != 0 {
+		t.Errorf("Expected notifiers to be disabled, got %v",
+			cfg.Notifiers.Enabled)
+	}
+}
+
+func TestConfigValidate(t *testing.T) {
+	if err := DefaultConfig().Validate(); err != nil {
+		t.Fatalf("Expected default config to be valid, got: %s", err.Error())
+	}
+	data := map[string]func(*Config){
+		"port":      func(c *Config) { c.Port = 0 },
+		"base_url":  func(c *Config) { c.BaseUrl = "ff.ppacer.org" },
+		"timezone":  func(c *Config) { c.Timezone = "Mars/Olympus" },
+		"log level": func(c *Config) { c.LogLevel = "LOUD" },
+		"from":      func(c *Config) { c.Email.From = "ppacer <info@x.com>" },
+		"mailer":    func(c *Config) { c.Email.Mailer = "pigeon" },
+		"mail_dir":  func(c *Config) { c.Email.Mailer = "file" },
+		"api_url":   func(c *Config) { c.Email.Mailer = "http" },
+		"secrets":   func(c *Config) { c.Secrets.Backend = "vault" },
+		"ttl":       func(c *Config) { c.Secrets.TTL = Duration{} },
+		"matrix":    func(c *Config) { c.Notifiers.Enabled = []string{"matrix"} },
+		"reminders": func(c *Config) {
+			c.Reminders.ConfirmAfter = []Duration{{time.Hour}, {time.Minute}}
+		},
+		"summary_hour": func(c *Config) { c.Reminders.SummaryHour = 24 },
+	}
+	for name, modify := range data {
+		cfg := DefaultConfig()
+		modify(&cfg)
+		if err := cfg.Validate(); err == nil {
+			t.Errorf("Expected validation error for %s", name)
+		}
+	}
+}
+
+func TestConfigRedacted(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.Email.ApiKey = "key"
+	cfg.Notifiers.MatrixAccessToken = "token"
+	cfg.Notifiers.SlackWebhookUrl = "https://hooks.slack.com/services/T0/B0/slacksecret"
+	cfg.Notifiers.DiscordWebhookUrl = "https://discord.com/api/webhooks/1/discordsecret"
+	cfg.Notifiers.WebhookUrl = "https://example.com/hook/webhooksecret"
+	out, _ := json.Marshal(cfg.Redacted())
+	for _, secret := range []string{`"key"`, `"token"`, "slacksecret",
+		"discordsecret", "webhooksecret"} {
+		if strings.Contains(string(out), secret) {
+			t.Errorf("Expected %s to be redacted in %s", secret, out)
+		}
+	}
+	if cfg.Email.ApiKey != "key" {
+		t.Error("Expected original config to be left intact")
+	}
+}
@@ -16,78 +16,53 @@ import (
 	_ "modernc.org/sqlite"
 )
 
-const PPACER_FF_ENV_LOG_LEVEL = "PPACER_FF_LOG_LEVEL"
-
 var (
-	ErrUserNotFound  = errors.New("user not found in database")
-	ErrUserNotUnique = errors.New("more than single user with given email")
+	ErrUserNotFound = errors.New("user not found in database")
+	ErrUserExists   = errors.New("user with given email is already registered")
+
+	ErrUserAlreadyConfirmed = errors.New("user has already been confirmed")
 )
 
 type UserRow struct {
+	EventSlug      string
 	Email          string
 	Nickname       *string
-	Hash           string
 	RegistrationTs string
 	Drinks         int
 	Confirmed      int
 	ConfirmationTs string
-}
-
-func UserByEmail(db *SqliteDB, email string) (UserRow, error) {
-	rows, qErr := db.Query(readUserByEmailQuery(), email)
-	if qErr != nil {
-		return UserRow{}, fmt.Errorf("cannot query user by email: %w", qErr)
-	}
-	defer rows.Close()
-	rowsN := 0
-	var userRow UserRow
-	var scanErr error
+	Spot           string
+	WaitlistPos    int
+	OfferExpiresTs string
 
-	for rows.Next() {
-		rowsN += 1
-		userRow, scanErr = parseUserRow(rows)
-		if scanErr != nil {
-			return userRow, fmt.Errorf("error while scanning userRow: %w",
-				scanErr)
-		}
-	}
-	if rowsN == 0 {
-		return UserRow{}, ErrUserNotFound
-	}
-	if rowsN != 1 {
-		return UserRow{}, ErrUserNotUnique
-	}
-	return userRow, nil
+	// Undeliverable is set when email to the address bounced or recipient
+	// marked it as spam.
+	Undeliverable int
 }
 
-func UserByHash(db *SqliteDB, hash string) (UserRow, error) {
-	rows, qErr := db.Query(readUserByHashQuery(), hash)
-	if qErr != nil {
-		return UserRow{}, fmt.Errorf("cannot query user by hash: %w", qErr)
-	}
-	defer rows.Close()
-	rowsN := 0
-	var userRow UserRow
-	var scanErr error
+// UserByEmail returns registration for the event. Emails are compared by
+// EmailKey, but registration with exactly the same address is preferred.
+func UserByEmail(db *SqliteDB, eventSlug, email string) (UserRow, error) {
+	return userByEmail(db, eventSlug, email)
+}
 
-	for rows.Next() {
-		rowsN += 1
-		userRow, scanErr = parseUserRow(rows)
-		if scanErr != nil {
-			return userRow, fmt.Errorf("error while scanning userRow: %w",
-				scanErr)
-		}
-	}
-	if rowsN == 0 {
+func userByEmail(db sqlQueryer, eventSlug, email string) (UserRow, error) {
+	row := db.QueryRow(readUserByEmailQuery(), eventSlug, email,
+		EmailKey(email), email)
+	userRow, scanErr := parseUserRow(row)
+	if scanErr == sql.ErrNoRows {
 		return UserRow{}, ErrUserNotFound
 	}
-	if rowsN != 1 {
-		return UserRow{}, ErrUserNotUnique
+	if scanErr != nil {
+		return UserRow{}, fmt.Errorf("error while scanning userRow: %w",
+			scanErr)
 	}
 	return userRow, nil
 }
 
-func InsertNewUser(db *SqliteDB, user User) error {
+// InsertNewUser inserts registration. ErrUserExists is returned when the
+// same email, compared by EmailKey, is already registered for the event.
+func InsertNewUser(db sqlExecer, user User) error {
 	confirmed := 0
 	drinks := 0
 	if user.Confirmed {
@@ -96,93 +71,278 @@ func InsertNewUser(db *SqliteDB, user User) error {
 	if user.Drinks {
 		drinks = 1
 	}
-	_, iErr := db.Exec(
+	res, iErr := db.Exec(
 		insertNewUserQuery(),
-		user.Email, user.Nickname, user.Hash, ToString(user.RegistrationTs),
-		drinks, confirmed, ToString(user.ConfirmationTs),
+		user.EventSlug, user.Email, EmailKey(user.Email), user.Nickname,
+		ToString(user.RegistrationTs), drinks, confirmed,
+		ToString(user.ConfirmationTs), user.Spot, user.WaitlistPos,
+		EmailKey(user.Email),
 	)
 	if iErr != nil {
 		return iErr
 	}
+	rows, rErr := res.RowsAffected()
+	if rErr != nil {
+		return fmt.Errorf("cannot get number of rows affected: %w", rErr)
+	}
+	if rows == 0 {
+		return ErrUserExists
+	}
 	return nil
 }
 
-func ConfirmUser(db *SqliteDB, email, hash string) error {
+// RegisterUser registers user for the event in single transaction. Spot is
+// assigned based on the event capacity. When the email is already registered
+// for the event, existing registration is returned and created is false.
+func RegisterUser(db *SqliteDB, event EventRow, user User) (UserRow, bool, error) {
+	var userRow UserRow
+	created := false
+	txErr := db.WithTx(func(tx *sql.Tx) error {
+		existing, uErr := userByEmail(tx, event.Slug, user.Email)
+		if uErr == nil {
+			userRow = existing
+			return nil
+		}
+		if uErr != ErrUserNotFound {
+			return uErr
+		}
+		spot, waitlistPos, sErr := newRegistrationSpot(tx, event)
+		if sErr != nil {
+			return fmt.Errorf("cannot determine spot: %w", sErr)
+		}
+		user.EventSlug = event.Slug
+		user.Spot = spot
+		user.WaitlistPos = waitlistPos
+		iErr := InsertNewUser(tx, user)
+		if iErr != nil && iErr != ErrUserExists {
+			return iErr
+		}
+		created = iErr == nil
+		var rErr error
+		userRow, rErr = userByEmail(tx, event.Slug, user.Email)
+		return rErr
+	})
+	return userRow, created, txErr
+}
+
+// ConfirmUser marks registration as confirmed. ErrUserAlreadyConfirmed is
+// returned when it has been confirmed before and ErrUserNotFound when the
+// registration doesn't exist, for example it was cancelled in the meantime.
+func ConfirmUser(db *SqliteDB, eventSlug, email string) error {
 	now := ToString(time.Now())
-	stats, iErr := db.Exec(confirmUserQuery(), now, email, hash)
-	if iErr != nil {
-		return iErr
+	return db.WithTx(func(tx *sql.Tx) error {
+		stats, iErr := tx.Exec(confirmUserQuery(), now, eventSlug, email)
+		if iErr != nil {
+			return iErr
+		}
+		rows, rErr := stats.RowsAffected()
+		if rErr != nil {
+			return fmt.Errorf("cannot get number of rows affected: %w", rErr)
+		}
+		if rows > 1 {
+			return fmt.Errorf("updated more than single user for event=%s and email=%s: %d",
+				eventSlug, email, rows)
+		}
+		if rows == 1 {
+			return nil
+		}
+		var exists int
+		qErr := tx.QueryRow(countUserQuery(), eventSlug, email).Scan(&exists)
+		if qErr != nil {
+			return fmt.Errorf("cannot check if user exists: %w", qErr)
+		}
+		if exists == 0 {
+			return ErrUserNotFound
+		}
+		return ErrUserAlreadyConfirmed
+	})
+}
+
+// UserFilter describes subset of registrations. Zero value matches all
+// registrations across all events.
+type UserFilter struct {
+	EventSlug string
+	Confirmed *bool
+	Drinks    *bool
+
+	// Registration date range in DateFormat, both ends inclusive.
+	RegisteredFrom string
+	RegisteredTo   string
+
+	// Case-insensitive substring of email or nickname.
+	Search string
+
+	// Pagination. Limit equal to zero means no limit.
+	Limit  int
+	Offset int
+}
+
+// SearchUsers returns registrations matching given filter ordered by
+// registration timestamp and total number of matching rows regardless of
+// pagination.
+func SearchUsers(db *SqliteDB, filter UserFilter) ([]UserRow, int, error) {
+	where, args := filter.whereClause()
+	var total int
+	cErr := db.QueryRow("SELECT COUNT(*) FROM users WHERE "+where, args...).
+		Scan(&total)
+	if cErr != nil {
+		return nil, 0, fmt.Errorf("cannot count users: %w", cErr)
 	}
-	rows, rErr := stats.RowsAffected()
-	if rErr != nil {
-		return fmt.Errorf("cannot get number of rows affected: %w", rErr)
+	query := selectUsersQuery(where + " ORDER BY RegistrationTs, Email")
+	if filter.Limit > 0 {
+		query += fmt.Sprintf(" LIMIT %d OFFSET %d", filter.Limit,
+			filter.Offset)
 	}
-	if rows != 1 {
-		return fmt.Errorf("updated more than single user for email=%s and hash=%s: %d",
-			email, hash, rows)
+	rows, qErr := db.Query(query, args...)
+	if qErr != nil {
+		return nil, 0, fmt.Errorf("cannot search users: %w", qErr)
 	}
-	return nil
+	defer rows.Close()
+	users := make([]UserRow, 0)
+	for rows.Next() {
+		user, scanErr := parseUserRow(rows)
+		if scanErr != nil {
+			return nil, 0, fmt.Errorf("error while scanning userRow: %w",
+				scanErr)
+		}
+		users = append(users, user)
+	}
+	return users, total, rows.Err()
+}
+
+// ForEachUser streams registrations matching given filter, ordered by
+// registration timestamp, into given function. Iteration stops on the first
+// error returned by fn.
+func ForEachUser(db *SqliteDB, filter UserFilter, fn func(UserRow) error) error {
+	where, args := filter.whereClause()
+	rows, qErr := db.Query(
+		selectUsersQuery(where+" ORDER BY RegistrationTs, Email"), args...,
+	)
+	if qErr != nil {
+		return fmt.Errorf("cannot query users: %w", qErr)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		user, scanErr := parseUserRow(rows)
+		if scanErr != nil {
+			return fmt.Errorf("error while scanning userRow: %w", scanErr)
+		}
+		if err := fn(user); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+func (f UserFilter) whereClause() (string, []any) {
+	conds := []string{"1=1"}
+	args := make([]any, 0)
+	if f.EventSlug != "" {
+		conds = append(conds, "EventSlug = ?")
+		args = append(args, f.EventSlug)
+	}
+	if f.Confirmed != nil {
+		conds = append(conds, "Confirmed = ?")
+		args = append(args, boolToInt(*f.Confirmed))
+	}
+	if f.Drinks != nil {
+		conds = append(conds, "Drinks = ?")
+		args = append(args, boolToInt(*f.Drinks))
+	}
+	if f.RegisteredFrom != "" {
+		conds = append(conds, "substr(RegistrationTs, 1, 10) >= ?")
+		args = append(args, f.RegisteredFrom)
+	}
+	if f.RegisteredTo != "" {
+		conds = append(conds, "substr(RegistrationTs, 1, 10) <= ?")
+		args = append(args, f.RegisteredTo)
+	}
+	if f.Search != "" {
+		conds = append(conds,
+			"(Email LIKE ? ESCAPE '\\' OR COALESCE(Nickname, '') LIKE ? ESCAPE '\\')")
+		pattern := "%" + escapeLike(f.Search) + "%"
+		args = append(args, pattern, pattern)
+	}
+	return strings.Join(conds, " AND "), args
 }
 
-func parseUserRow(rows *sql.Rows) (UserRow, error) {
-	var email, hash, regTs, confTs string
-	var nickname *string
-	var confirmed, drinks int
-	scanErr := rows.Scan(&email, &nickname, &hash, &regTs, &drinks,
-		&confirmed, &confTs)
+// SetUserConfirmed confirms or un-confirms registration. Confirmation
+// timestamp is set to the current time or cleared accordingly.
+func SetUserConfirmed(db *SqliteDB, eventSlug, email string, confirmed bool) error {
+	confTs := ""
+	if confirmed {
+		confTs = ToString(time.Now())
+	}
+	_, uErr := db.Exec(setUserConfirmedQuery(), boolToInt(confirmed), confTs,
+		eventSlug, email)
+	return uErr
+}
+
+func UpdateUserNickname(db *SqliteDB, eventSlug, email, nickname string) error {
+	_, uErr := db.Exec(updateUserNicknameQuery(), nickname, eventSlug, email)
+	return uErr
+}
+
+func boolToInt(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+func escapeLike(s string) string {
+	r := strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`)
+	return r.Replace(s)
+}
+
+func parseUserRow(row rowScanner) (UserRow, error) {
+	var u UserRow
+	scanErr := row.Scan(&u.EventSlug, &u.Email, &u.Nickname,
+		&u.RegistrationTs, &u.Drinks, &u.Confirmed, &u.ConfirmationTs, &u.Spot,
+		&u.WaitlistPos, &u.OfferExpiresTs, &u.Undeliverable)
 	if scanErr != nil {
 		return UserRow{}, scanErr
 	}
-	userRow := UserRow{
-		Email:          email,
-		Nickname:       nickname,
-		Hash:           hash,
-		RegistrationTs: regTs,
-		Drinks:         drinks,
-		Confirmed:      confirmed,
-		ConfirmationTs: confTs,
-	}
-	return userRow, nil
+	return u, nil
 }
 
-func readUserByEmailQuery() string {
+// selectUsersQuery returns SELECT query on users table which columns match
+// parseUserRow, filtered by given WHERE condition.
+func selectUsersQuery(where string) string {
 	return `
 	SELECT
+		EventSlug,
 		Email,
 		Nickname,
-		Hash,
 		RegistrationTs,
 		Drinks,
 		Confirmed,
-		ConfirmationTs
+		ConfirmationTs,
+		Spot,
+		WaitlistPos,
+		OfferExpiresTs,
+		Undeliverable
 	FROM
 		users
 	WHERE
-		Email = ?
+		` + where + `
 `
 }
 
-func readUserByHashQuery() string {
-	return `
-	SELECT
-		Email,
-		Nickname,
-		Hash,
-		RegistrationTs,
-		Drinks,
-		Confirmed,
-		ConfirmationTs
-	FROM
-		users
-	WHERE
-		Hash = ?
+func readUserByEmailQuery() string {
+	return selectUsersQuery("EventSlug = ? AND (Email = ? OR EmailKey = ?)") + `
+	ORDER BY
+		Email = ? DESC
+	LIMIT 1
 `
 }
 
 func insertNewUserQuery() string {
 	return `
-	INSERT INTO users(Email, Nickname, Hash, RegistrationTs, Drinks, Confirmed, ConfirmationTs)
-	VALUES (?,?,?,?,?,?,?)
+	INSERT INTO users(EventSlug, Email, EmailKey, Nickname, RegistrationTs, Drinks, Confirmed, ConfirmationTs, Spot, WaitlistPos, Undeliverable)
+	VALUES (?,?,?,?,?,?,?,?,?,?,
+		EXISTS (SELECT 1 FROM email_suppressions WHERE EmailKey = ?))
+	ON CONFLICT DO NOTHING
 	`
 }
 
@@ -194,17 +354,55 @@ func confirmUserQuery() string {
 		Confirmed = 1,
 		ConfirmationTs = ?
 	WHERE
-			Email = ?
-		AND Hash = ?
+			EventSlug = ?
+		AND Email = ?
+		AND Confirmed = 0
+`
+}
+
+func countUserQuery() string {
+	return `
+	SELECT
+		COUNT(*)
+	FROM
+		users
+	WHERE
+			EventSlug = ?
+		AND Email = ?
+`
+}
+
+func setUserConfirmedQuery() string {
+	return `
+	UPDATE
+		users
+	SET
+		Confirmed = ?,
+		ConfirmationTs = ?
+	WHERE
+			EventSlug = ?
+		AND Email = ?
 `
 }
 
-func NewSqliteClient(dbFilePath string, logger *slog.Logger) (*SqliteDB, error) {
+func updateUserNicknameQuery() string {
+	return `
+	UPDATE
+		users
+	SET
+		Nickname = ?
+	WHERE
+			EventSlug = ?
+		AND Email = ?
+`
+}
+
+func NewSqliteClient(cfg DatabaseConfig, logger *slog.Logger) (*SqliteDB, error) {
 	if logger == nil {
 		logger = defaultLogger()
 	}
 	sqliteDb, err := newSqliteClientForSchema(
-		dbFilePath, logger, setupSqliteSchema,
+		cfg, logger, setupSqliteSchema,
 	)
 	if err != nil {
 		return nil, err
@@ -213,19 +411,19 @@ func NewSqliteClient(dbFilePath string, logger *slog.Logger) (*SqliteDB, error)
 }
 
 func newSqliteClientForSchema(
-	dbFilePath string, logger *slog.Logger, setupSchemaFunc func(*sql.DB) error,
+	cfg DatabaseConfig, logger *slog.Logger, setupSchemaFunc func(*sql.DB) error,
 ) (*SqliteDB, error) {
-	dbFilePathAbs, absErr := filepath.Abs(dbFilePath)
+	dbFilePathAbs, absErr := filepath.Abs(cfg.Path)
 	if absErr != nil {
 		return nil, fmt.Errorf("cannot get absolute path of database file %s: %w",
-			dbFilePath, absErr)
+			cfg.Path, absErr)
 	}
 	newDbCreated, dbFileErr := createSqliteDbIfNotExist(dbFilePathAbs)
 	if dbFileErr != nil {
 		return nil, fmt.Errorf("cannot create new empty SQLite database: %w",
 			dbFileErr)
 	}
-	connString := sqliteConnString(dbFilePathAbs)
+	connString := sqliteConnString(dbFilePathAbs, cfg.Options)
 	db, dbErr := sql.Open("sqlite", connString)
 	if dbErr != nil {
 		return nil, fmt.Errorf("cannot connect to SQLite DB (%s): %w",
@@ -238,14 +436,21 @@ func newSqliteClientForSchema(
 			return nil, fmt.Errorf("cannot setup SQLite schema for %s: %w",
 				connString, schemaErr)
 		}
+	} else {
+		migErr := migrateSqliteSchema(db, logger)
+		if migErr != nil {
+			db.Close()
+			return nil, fmt.Errorf("cannot migrate SQLite schema for %s: %w",
+				connString, migErr)
+		}
 	}
 	return &SqliteDB{dbConn: db, dbFilePath: dbFilePathAbs}, nil
 }
 
-func sqliteConnString(dbFilePath string) string {
-	// TODO: probably read from the config not only database file path but also
-	// additional arguments also.
-	options := "cache=shared&mode=rwc&_journal_mode=WAL"
+func sqliteConnString(dbFilePath, options string) string {
+	if options == "" {
+		options = defaultSqliteOptions
+	}
 	if runtime.GOOS == "windows" {
 		return fmt.Sprintf("%s?%s", dbFilePath, options)
 	}
@@ -257,7 +462,461 @@ func setupSqliteSchema(db *sql.DB) error {
 	if err != nil {
 		return err
 	}
-	return execSqlStatements(db, schemaStmts)
+	if err := execSqlStatements(db, schemaStmts); err != nil {
+		return err
+	}
+	if err := insertDefaultEvent(db); err != nil {
+		return err
+	}
+	return setSchemaVersion(db, len(sqliteMigrations()))
+}
+
+// migrateSqliteSchema brings database created by older version of ppacerFF up
+// to date. Schema version is kept in SQLite user_version pragma and each
+// migration is applied in its own transaction.
+func migrateSqliteSchema(db *sql.DB, logger *slog.Logger) error {
+	var version int
+	if err := db.QueryRow("PRAGMA user_version;").Scan(&version); err != nil {
+		return fmt.Errorf("cannot read schema version: %w", err)
+	}
+	migrations := sqliteMigrations()
+	for idx := version; idx < len(migrations); idx++ {
+		logger.Warn("Migrating database schema", "from", idx, "to", idx+1)
+		tx, txErr := db.Begin()
+		if txErr != nil {
+			return txErr
+		}
+		if err := migrations[idx](tx); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("migration %d failed: %w", idx+1, err)
+		}
+		if _, err := tx.Exec(fmt.Sprintf("PRAGMA user_version = %d;", idx+1)); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("cannot set schema version %d: %w", idx+1, err)
+		}
+		if err := tx.Commit(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func setSchemaVersion(db *sql.DB, version int) error {
+	_, err := db.Exec(fmt.Sprintf("PRAGMA user_version = %d;", version))
+	return err
+}
+
+// sqliteMigrations returns ordered list of schema migrations. Migration on
+// index i moves schema from version i to version i+1. New migrations shall
+// only be appended, and schemaStatements shall always create the newest
+// schema.
+func sqliteMigrations() []func(*sql.Tx) error {
+	return []func(*sql.Tx) error{
+		migrateUsersToEvents,
+		migrateEventCapacity,
+		migrateAdminAccounts,
+		migrateAdminTotp,
+		migrateEventSequence,
+		migrateEmailOutbox,
+		migrateEmailOutboxHtml,
+		migrateEmailSuppressions,
+		migrateRegistrationTokens,
+		migrateConfirmationReminders,
+		migrateUserEmailKey,
+		migrateEmailOutboxHeaders,
+		migrateEmailSuppressionKeys,
+		migrateAdminTotpFailures,
+	}
+}
+
+// migrateUsersToEvents adds events table and assigns all existing
+// registrations to the default event.
+func migrateUsersToEvents(tx *sql.Tx) error {
+	stmts := []string{
+		`CREATE TABLE events (
+			Slug        TEXT NOT NULL,
+			Title       TEXT NOT NULL,
+			StartTs     TEXT NOT NULL,
+			EndTs       TEXT NOT NULL,
+			Venue       TEXT NOT NULL,
+			Description TEXT NOT NULL,
+			Status      TEXT NOT NULL,
+			PRIMARY KEY (Slug)
+		);`,
+		`ALTER TABLE users RENAME TO users_v0;`,
+		`CREATE TABLE users (
+			EventSlug      TEXT NOT NULL,
+			Email          TEXT NOT NULL,
+			Nickname       TEXT NULL,
+			Hash           TEXT NOT NULL,
+			RegistrationTs TEXT NOT NULL,
+			Drinks         INT NOT NULL,
+			Confirmed      INT NOT NULL,
+			ConfirmationTs TEXT NOT NULL,
+			PRIMARY KEY (EventSlug, Email)
+		);`,
+		fmt.Sprintf(`
+		INSERT INTO users(EventSlug, Email, Nickname, Hash, RegistrationTs, Drinks, Confirmed, ConfirmationTs)
+		SELECT '%s', Email, Nickname, Hash, RegistrationTs, Drinks, Confirmed, ConfirmationTs
+		FROM users_v0;`, defaultEventSlug),
+		`DROP TABLE users_v0;`,
+	}
+	for _, stmt := range stmts {
+		if _, err := tx.Exec(stmt); err != nil {
+			return err
+		}
+	}
+	return insertDefaultEvent(tx)
+}
+
+// migrateEventCapacity adds event capacity and waitlist columns.
+func migrateEventCapacity(tx *sql.Tx) error {
+	stmts := []string{
+		`ALTER TABLE events ADD COLUMN Capacity INT NOT NULL DEFAULT 0;`,
+		`ALTER TABLE users ADD COLUMN Spot TEXT NOT NULL DEFAULT 'attendee';`,
+		`ALTER TABLE users ADD COLUMN WaitlistPos INT NOT NULL DEFAULT 0;`,
+		`ALTER TABLE users ADD COLUMN OfferExpiresTs TEXT NOT NULL DEFAULT '';`,
+	}
+	for _, stmt := range stmts {
+		if _, err := tx.Exec(stmt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// migrateAdminAccounts adds admin accounts and sessions tables.
+func migrateAdminAccounts(tx *sql.Tx) error {
+	stmts := []string{
+		`CREATE TABLE admins (
+			Username     TEXT NOT NULL,
+			PasswordHash TEXT NOT NULL,
+			Role         TEXT NOT NULL,
+			CreatedTs    TEXT NOT NULL,
+			PRIMARY KEY (Username)
+		);`,
+		`CREATE TABLE admin_sessions (
+			TokenHash TEXT NOT NULL,
+			Username  TEXT NOT NULL,
+			CreatedTs TEXT NOT NULL,
+			ExpiresTs TEXT NOT NULL,
+			PRIMARY KEY (TokenHash)
+		);`,
+	}
+	for _, stmt := range stmts {
+		if _, err := tx.Exec(stmt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// migrateAdminTotp adds TOTP two-factor authentication for admins.
+func migrateAdminTotp(tx *sql.Tx) error {
+	stmts := []string{
+		`ALTER TABLE admins ADD COLUMN TotpSecret TEXT NOT NULL DEFAULT '';`,
+		`ALTER TABLE admins ADD COLUMN TotpEnabled INT NOT NULL DEFAULT 0;`,
+		`ALTER TABLE admins ADD COLUMN TotpLastStep INT NOT NULL DEFAULT 0;`,
+		`CREATE TABLE admin_recovery_codes (
+			Username TEXT NOT NULL,
+			CodeHash TEXT NOT NULL,
+			UsedTs   TEXT NOT NULL,
+			PRIMARY KEY (Username, CodeHash)
+		);`,
+		`CREATE TABLE admin_login_challenges (
+			TokenHash TEXT NOT NULL,
+			Username  TEXT NOT NULL,
+			ExpiresTs TEXT NOT NULL,
+			Attempts  INT NOT NULL,
+			PRIMARY KEY (TokenHash)
+		);`,
+	}
+	for _, stmt := range stmts {
+		if _, err := tx.Exec(stmt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// migrateEventSequence adds iCalendar sequence number to events.
+func migrateEventSequence(tx *sql.Tx) error {
+	_, err := tx.Exec(
+		`ALTER TABLE events ADD COLUMN Sequence INT NOT NULL DEFAULT 0;`)
+	return err
+}
+
+// migrateEmailOutbox adds table for emails waiting to be sent.
+func migrateEmailOutbox(tx *sql.Tx) error {
+	stmts := []string{
+		`CREATE TABLE email_outbox (
+			Id              INTEGER PRIMARY KEY AUTOINCREMENT,
+			Recipient       TEXT NOT NULL,
+			Subject         TEXT NOT NULL,
+			Body            TEXT NOT NULL,
+			Attachments     TEXT NOT NULL,
+			Status          TEXT NOT NULL,
+			Attempts        INT NOT NULL,
+			NextAttemptUnix INT NOT NULL,
+			LastError       TEXT NOT NULL,
+			CreatedTs       TEXT NOT NULL,
+			SentTs          TEXT NOT NULL
+		);`,
+		`CREATE INDEX email_outbox_due ON email_outbox (Status, NextAttemptUnix);`,
+	}
+	for _, stmt := range stmts {
+		if _, err := tx.Exec(stmt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// migrateEmailOutboxHtml adds HTML body and inline images to email outbox.
+func migrateEmailOutboxHtml(tx *sql.Tx) error {
+	stmts := []string{
+		`ALTER TABLE email_outbox ADD COLUMN HtmlBody TEXT NOT NULL DEFAULT '';`,
+		`ALTER TABLE email_outbox ADD COLUMN Inline TEXT NOT NULL DEFAULT '';`,
+	}
+	for _, stmt := range stmts {
+		if _, err := tx.Exec(stmt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// migrateEmailSuppressions adds suppression list of undeliverable addresses.
+func migrateEmailSuppressions(tx *sql.Tx) error {
+	stmts := []string{
+		`CREATE TABLE email_suppressions (
+			Email     TEXT NOT NULL,
+			Reason    TEXT NOT NULL,
+			Details   TEXT NOT NULL,
+			CreatedTs TEXT NOT NULL,
+			PRIMARY KEY (Email)
+		);`,
+		`ALTER TABLE users ADD COLUMN Undeliverable INT NOT NULL DEFAULT 0;`,
+	}
+	for _, stmt := range stmts {
+		if _, err := tx.Exec(stmt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// migrateRegistrationTokens moves registration hashes, which used to be
+// stored in plain text, into registration_tokens table. Old links keep
+// working for legacyTokenWindow.
+func migrateRegistrationTokens(tx *sql.Tx) error {
+	stmts := []string{
+		`CREATE TABLE registration_tokens (
+			TokenHash TEXT NOT NULL,
+			Purpose   TEXT NOT NULL,
+			EventSlug TEXT NOT NULL,
+			Email     TEXT NOT NULL,
+			CreatedTs TEXT NOT NULL,
+			ExpiresAt INT NOT NULL,
+			PRIMARY KEY (TokenHash, Purpose)
+		);`,
+		`CREATE INDEX registration_tokens_user
+		ON registration_tokens (EventSlug, Email);`,
+	}
+	for _, stmt := range stmts {
+		if _, err := tx.Exec(stmt); err != nil {
+			return err
+		}
+	}
+	type legacyHash struct {
+		eventSlug, email, hash string
+	}
+	rows, qErr := tx.Query(`SELECT EventSlug, Email, Hash FROM users WHERE Hash != ''`)
+	if qErr != nil {
+		return qErr
+	}
+	var hashes []legacyHash
+	for rows.Next() {
+		var h legacyHash
+		if err := rows.Scan(&h.eventSlug, &h.email, &h.hash); err != nil {
+			rows.Close()
+			return err
+		}
+		hashes = append(hashes, h)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	now := time.Now()
+	expires := now.Add(legacyTokenWindow).Unix()
+	for _, h := range hashes {
+		// The same link used to confirm, cancel and show calendar.
+		for _, purpose := range []string{TokenConfirm, TokenManage, TokenCancel} {
+			_, iErr := tx.Exec(insertRegistrationTokenQuery(),
+				hashToken(h.hash), purpose, h.eventSlug, h.email,
+				ToString(now), expires)
+			if iErr != nil {
+				return iErr
+			}
+		}
+	}
+	_, dErr := tx.Exec(`ALTER TABLE users DROP COLUMN Hash;`)
+	return dErr
+}
+
+// migrateConfirmationReminders adds table recording confirmation reminders.
+func migrateConfirmationReminders(tx *sql.Tx) error {
+	_, err := tx.Exec(`
+		CREATE TABLE confirmation_reminders (
+			EventSlug TEXT NOT NULL,
+			Email     TEXT NOT NULL,
+			Attempt   INT NOT NULL,
+			SentTs    TEXT NOT NULL,
+			PRIMARY KEY (EventSlug, Email, Attempt)
+		);`)
+	return err
+}
+
+// migrateUserEmailKey adds normalized email used for comparison, see
+// EmailKey, and makes it unique per event. Near-duplicates registered before,
+// like Foo@x.com and foo@x.com, are kept, but all but the first one get
+// EmailKey with "#<rowid>" suffix, so they can be found by EmailDuplicates
+// and resolved by organizers.
+func migrateUserEmailKey(tx *sql.Tx) error {
+	_, aErr := tx.Exec(`ALTER TABLE users ADD COLUMN EmailKey TEXT NOT NULL DEFAULT '';`)
+	if aErr != nil {
+		return aErr
+	}
+	type userKey struct {
+		rowid     int64
+		eventSlug string
+		email     string
+	}
+	rows, qErr := tx.Query(`SELECT rowid, EventSlug, Email FROM users ORDER BY rowid`)
+	if qErr != nil {
+		return qErr
+	}
+	var users []userKey
+	for rows.Next() {
+		var u userKey
+		if err := rows.Scan(&u.rowid, &u.eventSlug, &u.email); err != nil {
+			rows.Close()
+			return err
+		}
+		users = append(users, u)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	seen := make(map[[2]string]bool)
+	for _, u := range users {
+		key := EmailKey(u.email)
+		if seen[[2]string{u.eventSlug, key}] {
+			key = fmt.Sprintf("%s%s%d", key, emailDuplicateSep, u.rowid)
+		}
+		seen[[2]string{u.eventSlug, key}] = true
+		_, uErr := tx.Exec(`UPDATE users SET EmailKey = ? WHERE rowid = ?`,
+			key, u.rowid)
+		if uErr != nil {
+			return uErr
+		}
+	}
+	_, iErr := tx.Exec(`CREATE UNIQUE INDEX users_email_key ON users (EventSlug, EmailKey);`)
+	return iErr
+}
+
+// migrateEmailOutboxHeaders adds Reply-To and List-Unsubscribe headers to
+// email outbox, so they are not lost between queueing and sending.
+func migrateEmailOutboxHeaders(tx *sql.Tx) error {
+	stmts := []string{
+		`ALTER TABLE email_outbox ADD COLUMN ReplyTo TEXT NOT NULL DEFAULT '';`,
+		`ALTER TABLE email_outbox ADD COLUMN ListUnsubscribe TEXT NOT NULL DEFAULT '';`,
+	}
+	for _, stmt := range stmts {
+		if _, err := tx.Exec(stmt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// migrateEmailSuppressionKeys adds EmailKey to suppression list, so
+// suppressed address matches registrations which differ only in case or
+// form of internationalized domain. When several suppressed addresses have
+// the same key, only the first one is kept.
+func migrateEmailSuppressionKeys(tx *sql.Tx) error {
+	_, aErr := tx.Exec(`ALTER TABLE email_suppressions ADD COLUMN EmailKey TEXT NOT NULL DEFAULT '';`)
+	if aErr != nil {
+		return aErr
+	}
+	rows, qErr := tx.Query(`SELECT rowid, Email FROM email_suppressions ORDER BY rowid`)
+	if qErr != nil {
+		return qErr
+	}
+	keys := make(map[int64]string)
+	var rowids []int64
+	for rows.Next() {
+		var rowid int64
+		var email string
+		if err := rows.Scan(&rowid, &email); err != nil {
+			rows.Close()
+			return err
+		}
+		keys[rowid] = EmailKey(email)
+		rowids = append(rowids, rowid)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	seen := make(map[string]bool)
+	for _, rowid := range rowids {
+		key := keys[rowid]
+		stmt := `UPDATE email_suppressions SET EmailKey = ? WHERE rowid = ?`
+		args := []any{key, rowid}
+		if seen[key] {
+			stmt = `DELETE FROM email_suppressions WHERE rowid = ?`
+			args = []any{rowid}
+		}
+		seen[key] = true
+		if _, err := tx.Exec(stmt, args...); err != nil {
+			return err
+		}
+	}
+	_, iErr := tx.Exec(`CREATE UNIQUE INDEX email_suppressions_key ON email_suppressions (EmailKey);`)
+	return iErr
+}
+
+// migrateAdminTotpFailures adds counter of failed 2FA attempts, which locks
+// the account regardless of how many login challenges were started.
+func migrateAdminTotpFailures(tx *sql.Tx) error {
+	_, err := tx.Exec(`ALTER TABLE admins ADD COLUMN TotpFailures INT NOT NULL DEFAULT 0;`)
+	return err
+}
+
+type sqlExecer interface {
+	Exec(query string, args ...any) (sql.Result, error)
+}
+
+type sqlQueryer interface {
+	QueryRow(query string, args ...any) *sql.Row
+}
+
+// insertDefaultEvent inserts the default event using only columns from the
+// first events schema, so it can be used in migrations as well.
+func insertDefaultEvent(db sqlExecer) error {
+	e := defaultEvent()
+	_, iErr := db.Exec(`
+		INSERT INTO events(Slug, Title, StartTs, EndTs, Venue, Description, Status)
+		VALUES (?,?,?,?,?,?,?)`,
+		e.Slug, e.Title, e.StartTs, e.EndTs, e.Venue, e.Description, e.Status,
+	)
+	return iErr
 }
 
 type SqliteDB struct {
@@ -273,6 +932,23 @@ func (s *SqliteDB) Begin() (*sql.Tx, error) {
 	return s.dbConn.Begin()
 }
 
+// WithTx runs fn in transaction. Write lock is held until the transaction
+// ends, so transactions started by this process don't interleave. The
+// transaction is committed when fn returns nil and rolled back otherwise.
+func (s *SqliteDB) WithTx(fn func(*sql.Tx) error) error {
+	s.Lock()
+	defer s.Unlock()
+	tx, txErr := s.dbConn.Begin()
+	if txErr != nil {
+		return txErr
+	}
+	if err := fn(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
 func (s *SqliteDB) Exec(query string, args ...any) (sql.Result, error) {
 	s.Lock()
 	defer s.Unlock()
@@ -361,7 +1037,20 @@ func schemaStatements(dbDriver string) ([]string, error) {
 	if dbDriver == "sqlite" || dbDriver == "sqlite3" {
 		return []string{
 			sqliteSetupWAL(),
+			sqliteCreateEventsTable(),
 			sqliteCreateUserTable(),
+			sqliteCreateAdminsTable(),
+			sqliteCreateAdminSessionsTable(),
+			sqliteCreateRecoveryCodesTable(),
+			sqliteCreateLoginChallengesTable(),
+			sqliteCreateEmailOutboxTable(),
+			sqliteCreateEmailOutboxIndex(),
+			sqliteCreateEmailSuppressionsTable(),
+			sqliteCreateEmailSuppressionsKeyIndex(),
+			sqliteCreateRegistrationTokensTable(),
+			sqliteCreateRegistrationTokensIndex(),
+			sqliteCreateConfirmationRemindersTable(),
+			sqliteCreateUsersEmailKeyIndex(),
 		}, nil
 	}
 
@@ -376,34 +1065,35 @@ func sqliteSetupWAL() string {
 func sqliteCreateUserTable() string {
 	return `
 		CREATE TABLE IF NOT EXISTS users (
+			EventSlug      TEXT NOT NULL,
 			Email          TEXT NOT NULL,
+			EmailKey       TEXT NOT NULL,
 			Nickname       TEXT NULL,
-			Hash           TEXT NOT NULL,
 			RegistrationTs TEXT NOT NULL,
 			Drinks         INT NOT NULL,
 			Confirmed      INT NOT NULL,
 			ConfirmationTs TEXT NOT NULL,
+			Spot           TEXT NOT NULL DEFAULT 'attendee',
+			WaitlistPos    INT NOT NULL DEFAULT 0,
+			OfferExpiresTs TEXT NOT NULL DEFAULT '',
+			Undeliverable  INT NOT NULL DEFAULT 0,
 
-			PRIMARY KEY (Email)
+			PRIMARY KEY (EventSlug, Email)
 		);
 `
 }
 
+func sqliteCreateUsersEmailKeyIndex() string {
+	return `
+		CREATE UNIQUE INDEX IF NOT EXISTS users_email_key
+		ON users (EventSlug, EmailKey);
+`
+}
+
+// logLevel is set from configuration by applyConfig.
+var logLevel = slog.LevelWarn
+
 func defaultLogger() *slog.Logger {
-	level := os.Getenv(PPACER_FF_ENV_LOG_LEVEL)
-	var logLevel slog.Level
-	switch level {
-	case "DEBUG":
-		logLevel = slog.LevelDebug
-	case "INFO":
-		logLevel = slog.LevelInfo
-	case "WARN":
-		logLevel = slog.LevelWarn
-	case "ERROR":
-		logLevel = slog.LevelError
-	default:
-		logLevel = slog.LevelWarn
-	}
 	opts := slog.HandlerOptions{Level: logLevel}
 	return slog.New(slog.NewTextHandler(os.Stdout, &opts))
 }
@@ -0,0 +1,263 @@
+package main
+
+import (
+	"database/sql"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestMigrateLegacyUsersToEvents(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "legacy.db")
+	legacySchema := func(db *sql.DB) error {
+		return execSqlStatements(db, []string{
+			sqliteSetupWAL(),
+			`CREATE TABLE users (
+				Email          TEXT NOT NULL,
+				Nickname       TEXT NULL,
+				Hash           TEXT NOT NULL,
+				RegistrationTs TEXT NOT NULL,
+				Drinks         INT NOT NULL,
+				Confirmed      INT NOT NULL,
+				ConfirmationTs TEXT NOT NULL,
+				PRIMARY KEY (Email)
+			);`,
+			`INSERT INTO users VALUES ('a@b.com', 'A', 'hash1', '', 1, 0, '');`,
+		})
+	}
+	legacy, lErr := newSqliteClientForSchema(DatabaseConfig{Path: dbPath}, defaultLogger(),
+		legacySchema)
+	if lErr != nil {
+		t.Fatalf("Cannot create legacy database: %s", lErr.Error())
+	}
+	legacy.Close()
+
+	db, dbErr := NewSqliteClient(DatabaseConfig{Path: dbPath}, nil)
+	if dbErr != nil {
+		t.Fatalf("Cannot open and migrate legacy database: %s", dbErr.Error())
+	}
+	defer db.Close()
+
+	// Links sent before migration keep working.
+	user, uErr := UserByToken(db, defaultEventSlug, "hash1", TokenConfirm,
+		time.Now())
+	if uErr != nil {
+		t.Fatalf("Expected migrated user, got error: %s", uErr.Error())
+	}
+	if user.Email != "a@b.com" || user.Drinks != 1 {
+		t.Errorf("Unexpected migrated user: %+v", user)
+	}
+	if _, eErr := EventBySlug(db, defaultEventSlug); eErr != nil {
+		t.Errorf("Expected default event after migration, got: %s",
+			eErr.Error())
+	}
+}
+
+func TestUsersArePerEvent(t *testing.T) {
+	db := newTestDb(t)
+	for _, slug := range []string{"meetup-1", "meetup-2"} {
+		iErr := InsertEvent(db, EventRow{
+			Slug: slug, Title: slug, Status: EventStatusPublished,
+			StartTs: ToString(time.Now()), EndTs: ToString(time.Now()),
+		})
+		if iErr != nil {
+			t.Fatalf("Cannot insert event %s: %s", slug, iErr.Error())
+		}
+		user := User{EventSlug: slug, Email: "x@y.com"}
+		if iErr := InsertNewUser(db, user); iErr != nil {
+			t.Fatalf("Cannot register the same email for %s: %s", slug,
+				iErr.Error())
+		}
+	}
+	token, _ := IssueToken(db, "meetup-2", "x@y.com", TokenConfirm,
+		time.Now().Add(time.Hour))
+	_, uErr := UserByToken(db, "meetup-1", token, TokenConfirm, time.Now())
+	if uErr != ErrTokenNotFound {
+		t.Errorf("Expected ErrTokenNotFound for token from another event, got: %v",
+			uErr)
+	}
+}
+
+func TestConfirmUser(t *testing.T) {
+	db := newTestDb(t)
+	user := User{EventSlug: defaultEventSlug, Email: "ala@x.com"}
+	if iErr := InsertNewUser(db, user); iErr != nil {
+		t.Fatalf("Cannot insert user: %s", iErr.Error())
+	}
+	if cErr := ConfirmUser(db, defaultEventSlug, user.Email); cErr != nil {
+		t.Fatalf("Cannot confirm user: %s", cErr.Error())
+	}
+	if cErr := ConfirmUser(db, defaultEventSlug, user.Email); cErr != ErrUserAlreadyConfirmed {
+		t.Errorf("Expected ErrUserAlreadyConfirmed, got: %v", cErr)
+	}
+	token, _ := IssueToken(db, defaultEventSlug, user.Email, TokenCancel,
+		time.Now().Add(time.Hour))
+	if dErr := DeleteUser(db, defaultEventSlug, user.Email); dErr != nil {
+		t.Fatalf("Cannot delete user: %s", dErr.Error())
+	}
+	// Tokens of deleted registration are revoked.
+	_, lErr := LookupToken(db, token, TokenCancel, time.Now())
+	if lErr != ErrTokenNotFound {
+		t.Errorf("Expected ErrTokenNotFound after deletion, got: %v", lErr)
+	}
+	if cErr := ConfirmUser(db, defaultEventSlug, user.Email); cErr != ErrUserNotFound {
+		t.Errorf("Expected ErrUserNotFound for deleted registration, got: %v",
+			cErr)
+	}
+}
+
+func newTestDb(t *testing.T) *SqliteDB {
+	t.Helper()
+	db, dbErr := NewSqliteClient(
+		DatabaseConfig{Path: filepath.Join(t.TempDir(), "test.db")}, nil)
+	if dbErr != nil {
+		t.Fatalf("Cannot create test database: %s", dbErr.Error())
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+func TestSearchUsersFilters(t *testing.T) {
+	db := newTestDb(t)
+	nick := "Ala_Kot"
+	users := []User{
+		{Email: "ala@x.com", Nickname: &nick, Drinks: true, Confirmed: true},
+		{Email: "bob@x.com", Drinks: true},
+		{Email: "cyd@x.com"},
+	}
+	for _, u := range users {
+		u.EventSlug = defaultEventSlug
+		u.RegistrationTs = time.Now()
+		if iErr := InsertNewUser(db, u); iErr != nil {
+			t.Fatalf("Cannot insert user: %s", iErr.Error())
+		}
+	}
+	yes := true
+	data := []struct {
+		filter   UserFilter
+		expected int
+	}{
+		{UserFilter{}, 3},
+		{UserFilter{Drinks: &yes}, 2},
+		{UserFilter{Drinks: &yes, Confirmed: &yes}, 1},
+		{UserFilter{Search: "kot"}, 1},
+		{UserFilter{Search: "a_k"}, 1},
+		{UserFilter{Search: "%"}, 0},
+		{UserFilter{EventSlug: "other"}, 0},
+		{UserFilter{Limit: 2}, 3},
+	}
+	for _, d := range data {
+		rows, total, sErr := SearchUsers(db, d.filter)
+		if sErr != nil {
+			t.Fatalf("Cannot search users for %+v: %s", d.filter, sErr.Error())
+		}
+		if total != d.expected {
+			t.Errorf("Expected %d users for %+v, got %d", d.expected, d.filter,
+				total)
+		}
+		if d.filter.Limit > 0 && len(rows) != d.filter.Limit {
+			t.Errorf("Expected page of %d rows, got %d", d.filter.Limit,
+				len(rows))
+		}
+	}
+}
+
+func TestRegisterUserConcurrently(t *testing.T) {
+	db := newTestDb(t)
+	start := time.Now().Add(24 * time.Hour)
+	event := EventRow{Slug: "meetup", Title: "Meetup",
+		Status: EventStatusPublished, StartTs: ToString(start),
+		EndTs: ToString(start.Add(time.Hour)), Capacity: 2}
+	if iErr := InsertEvent(db, event); iErr != nil {
+		t.Fatalf("Cannot insert event: %s", iErr.Error())
+	}
+	emails := []string{"Foo@Example.com", "foo@example.com", "FOO@EXAMPLE.COM",
+		"a@x.com", "b@x.com", "c@x.com"}
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	created := 0
+	for _, email := range emails {
+		wg.Add(1)
+		go func(email string) {
+			defer wg.Done()
+			_, ok, err := RegisterUser(db, event,
+				User{Email: email, RegistrationTs: time.Now()})
+			if err != nil {
+				t.Errorf("Cannot register %s: %s", email, err.Error())
+			}
+			if ok {
+				mu.Lock()
+				created++
+				mu.Unlock()
+			}
+		}(email)
+	}
+	wg.Wait()
+	if created != 4 {
+		t.Errorf("Expected 4 registrations, got %d", created)
+	}
+	taken, _ := TakenSpots(db, event.Slug)
+	if taken != event.Capacity {
+		t.Errorf("Expected %d taken spots, got %d", event.Capacity, taken)
+	}
+	if _, err := UserByEmail(db, event.Slug, "fOO@example.COM"); err != nil {
+		t.Errorf("Expected lookup by normalized email, got: %v", err)
+	}
+	if err := InsertNewUser(db, User{EventSlug: event.Slug, Email: "A@X.com"}); err != ErrUserExists {
+		t.Errorf("Expected ErrUserExists, got: %v", err)
+	}
+}
+
+func TestMigrateUserEmailKeyDuplicates(t *testing.T) {
+	db := newTestDb(t)
+	// Go back to schema without EmailKey, which allowed near-duplicates.
+	stmts := []string{
+		`DROP INDEX users_email_key;`,
+		`ALTER TABLE users DROP COLUMN EmailKey;`,
+	}
+	for _, stmt := range stmts {
+		if _, err := db.Exec(stmt); err != nil {
+			t.Fatalf("Cannot execute %s: %s", stmt, err.Error())
+		}
+	}
+	for _, email := range []string{"ala@x.com", "Ala@X.com", "bob@x.com"} {
+		_, iErr := db.Exec(`INSERT INTO users(EventSlug, Email, RegistrationTs,
+			Drinks, Confirmed, ConfirmationTs) VALUES (?, ?, '', 0, 0, '')`,
+			defaultEventSlug, email)
+		if iErr != nil {
+			t.Fatalf("Cannot insert %s: %s", email, iErr.Error())
+		}
+	}
+	if mErr := db.WithTx(migrateUserEmailKey); mErr != nil {
+		t.Fatalf("Cannot migrate database: %s", mErr.Error())
+	}
+	duplicates, dErr := EmailDuplicates(db)
+	if dErr != nil {
+		t.Fatalf("Cannot read duplicates: %s", dErr.Error())
+	}
+	expected := []EmailDuplicate{{EventSlug: defaultEventSlug,
+		Email: "Ala@X.com", DuplicateOf: "ala@x.com"}}
+	if !reflect.DeepEqual(duplicates, expected) {
+		t.Errorf("Expected duplicates %+v, got %+v", expected, duplicates)
+	}
+	// Both registrations are still reachable by exact email.
+	for _, email := range []string{"ala@x.com", "Ala@X.com"} {
+		if u, err := UserByEmail(db, defaultEventSlug, email); err != nil || u.Email != email {
+			t.Errorf("Expected registration %s, got %+v (%v)", email, u, err)
+		}
+	}
+
+	// Deleting the original registration cleans up key of the duplicate.
+	if dErr := DeleteUser(db, defaultEventSlug, "ala@x.com"); dErr != nil {
+		t.Fatalf("Cannot delete user: %s", dErr.Error())
+	}
+	if duplicates, _ := EmailDuplicates(db); len(duplicates) != 0 {
+		t.Errorf("Expected no duplicates after deletion, got %+v", duplicates)
+	}
+	dup := User{EventSlug: defaultEventSlug, Email: "ALA@x.com"}
+	if iErr := InsertNewUser(db, dup); iErr != ErrUserExists {
+		t.Errorf("Expected ErrUserExists for the same key, got %v", iErr)
+	}
+}
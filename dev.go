@@ -0,0 +1,261 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// Admin account created in development mode.
+	devAdminUsername = "admin"
+	devAdminPassword = "ppacer-dev-password"
+
+	devUpcomingEventSlug = "ff-dev-meetup"
+	devFullEventSlug     = "ff-dev-workshop"
+)
+
+// devConfig adjusts configuration for development mode: throwaway database
+// in a temporary directory and links pointing at the local server. Secrets,
+// mailer and notifiers settings are ignored in development mode.
+func devConfig(cfg Config) (Config, error) {
+	dir, dErr := os.MkdirTemp("", "ppacerff-dev-")
+	if dErr != nil {
+		return cfg, fmt.Errorf("cannot create directory for dev database: %w",
+			dErr)
+	}
+	cfg.Database.Path = filepath.Join(dir, "ppacer_ff.db")
+	cfg.BaseUrl = fmt.Sprintf("http://localhost:%d", cfg.Port)
+	if cfg.LogLevel == defaultLogLevel {
+		cfg.LogLevel = "INFO"
+	}
+	return cfg, nil
+}
+
+// seedDevData fills fresh database with events, fake registrations and an
+// owner admin account, so the whole flow can be tried locally.
+func seedDevData(db *SqliteDB) error {
+	now := time.Now()
+	start := time.Date(now.Year(), now.Month(), now.Day(), 18, 0, 0, 0,
+		CurrentTz()).AddDate(0, 0, 14)
+	events := []EventRow{
+		{
+			Slug:        devUpcomingEventSlug,
+			Title:       "ppacer meetup",
+			StartTs:     ToString(start),
+			EndTs:       ToString(start.Add(3 * time.Hour)),
+			Venue:       "Somewhere in Warsaw",
+			Description: "Talks about **ppacer** internals, followed by pizza.",
+			Status:      EventStatusPublished,
+			Capacity:    30,
+		},
+		{
+			Slug:        devFullEventSlug,
+			Title:       "ppacer workshop",
+			StartTs:     ToString(start.AddDate(0, 0, 7)),
+			EndTs:       ToString(start.AddDate(0, 0, 7).Add(2 * time.Hour)),
+			Venue:       "Online",
+			Description: "Hands-on workshop with small group, so it's full.",
+			Status:      EventStatusPublished,
+			Capacity:    3,
+		},
+	}
+	for _, event := range events {
+		if err := InsertEvent(db, event); err != nil {
+			return fmt.Errorf("cannot insert event %s: %w", event.Slug, err)
+		}
+	}
+
+	names := []string{"Ala", "Bartek", "Celina", "Darek", "Ewa", "Franek",
+		"Gosia", "Henryk", "Iga", "Janek"}
+	for idx, name := range names {
+		email := strings.ToLower(name) + "@example.com"
+		registered := now.Add(-time.Duration(len(names)-idx) * 7 * time.Hour)
+		nickname := name
+		user := User{
+			EventSlug:      devUpcomingEventSlug,
+			Email:          email,
+			Nickname:       &nickname,
+			RegistrationTs: registered,
+			Drinks:         idx%3 != 0,
+			Confirmed:      idx%4 != 3,
+			Spot:           SpotAttendee,
+		}
+		if user.Confirmed {
+			user.ConfirmationTs = registered.Add(15 * time.Minute)
+		}
+		if err := InsertNewUser(db, user); err != nil {
+			return fmt.Errorf("cannot insert user %s: %w", email, err)
+		}
+		if idx >= 5 {
+			continue
+		}
+		// First five people registered for the workshop too, the last two
+		// ended up on the waitlist.
+		user.EventSlug = devFullEventSlug
+		if idx >= events[1].Capacity {
+			user.Spot = SpotWaitlist
+			user.WaitlistPos = idx - events[1].Capacity + 1
+		}
+		if err := InsertNewUser(db, user); err != nil {
+			return fmt.Errorf("cannot insert user %s: %w", email, err)
+		}
+	}
+	return CreateAdmin(db, devAdminUsername, devAdminPassword, RoleOwner)
+}
+
+// LogNotifier writes alerts into the log instead of sending them.
+type LogNotifier struct {
+	logger *slog.Logger
+}
+
+func (n LogNotifier) Send(msg string) error {
+	n.logger.Info("Notification", "msg", msg)
+	return nil
+}
+
+// DevInbox is a mailer which keeps emails in memory instead of sending them.
+// They can be browsed at /dev/mail.
+type DevInbox struct {
+	sync.Mutex
+	messages []devMail
+}
+
+type devMail struct {
+	Id     int
+	SentTs time.Time
+	EmailMessage
+
+	// Raw is the message exactly as it would be sent.
+	Raw []byte
+}
+
+func NewDevInbox() *DevInbox {
+	return &DevInbox{}
+}
+
+func (d *DevInbox) Send(msg EmailMessage) error {
+	now := time.Now()
+	raw, bErr := BuildMessage(msg, now)
+	if bErr != nil {
+		return bErr
+	}
+	d.Lock()
+	defer d.Unlock()
+	d.messages = append(d.messages, devMail{
+		Id:           len(d.messages) + 1,
+		SentTs:       now,
+		EmailMessage: msg,
+		Raw:          raw,
+	})
+	return nil
+}
+
+// Messages returns captured emails, the newest first.
+func (d *DevInbox) Messages() []devMail {
+	d.Lock()
+	defer d.Unlock()
+	messages := slices.Clone(d.messages)
+	slices.Reverse(messages)
+	return messages
+}
+
+func (d *DevInbox) Message(id int) (devMail, bool) {
+	d.Lock()
+	defer d.Unlock()
+	if id < 1 || id > len(d.messages) {
+		return devMail{}, false
+	}
+	return d.messages[id-1], true
+}
+
+func (m devMail) SentUI() string {
+	return ToStringUI(m.SentTs.In(CurrentTz()))
+}
+
+type devMailPage struct {
+	Messages []devMail
+	Selected *devMail
+}
+
+// DevMailHandler shows emails captured by DevInbox. Selected message is shown
+// next to the list.
+func (o *Owner) DevMailHandler(w http.ResponseWriter, r *http.Request) {
+	p := devMailPage{Messages: o.devInbox.Messages()}
+	if idStr := r.PathValue("id"); idStr != "" {
+		msg, err := o.devMessage(idStr)
+		if err != nil {
+			http.NotFound(w, r)
+			return
+		}
+		p.Selected = &msg
+	}
+	renderErr := o.tmpl.Render(w, "dev-mail", p)
+	if renderErr != nil {
+		o.logger.Error("Error while rendering dev mail page", "err",
+			renderErr.Error())
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+	}
+}
+
+// DevMailPartHandler serves parts of captured email: rendered HTML body,
+// inline images referenced from it or raw message source.
+func (o *Owner) DevMailPartHandler(w http.ResponseWriter, r *http.Request) {
+	msg, err := o.devMessage(r.PathValue("id"))
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	switch part := r.PathValue("part"); part {
+	case "html":
+		// Inline images are referenced by cid: URLs, which browsers don't
+		// resolve.
+		html := strings.ReplaceAll(msg.HTMLBody, "cid:",
+			fmt.Sprintf("/dev/mail/%d/cid/", msg.Id))
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Header().Set("Content-Security-Policy", "sandbox")
+		w.Write([]byte(html))
+	case "raw":
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.Write(msg.Raw)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// DevMailInlineHandler serves inline image of captured email.
+func (o *Owner) DevMailInlineHandler(w http.ResponseWriter, r *http.Request) {
+	msg, err := o.devMessage(r.PathValue("id"))
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	for _, a := range msg.Inline {
+		if a.ContentID == r.PathValue("cid") {
+			w.Header().Set("Content-Type", a.ContentType)
+			w.Write(a.Data)
+			return
+		}
+	}
+	http.NotFound(w, r)
+}
+
+func (o *Owner) devMessage(idStr string) (devMail, error) {
+	id, pErr := strconv.Atoi(idStr)
+	if pErr != nil {
+		return devMail{}, pErr
+	}
+	msg, ok := o.devInbox.Message(id)
+	if !ok {
+		return devMail{}, errors.New("message not found")
+	}
+	return msg, nil
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestSeedDevData(t *testing.T) {
+	db := newTestDb(t)
+	if err := seedDevData(db); err != nil {
+		t.Fatalf("Cannot seed dev data: %s", err.Error())
+	}
+	full, _ := EventBySlug(db, devFullEventSlug)
+	taken, _ := TakenSpots(db, full.Slug)
+	if taken != full.Capacity {
+		t.Errorf("Expected full event, got %d of %d spots taken", taken,
+			full.Capacity)
+	}
+	if _, err := NextWaitlisted(db, full.Slug); err != nil {
+		t.Errorf("Expected waitlisted registrations: %s", err.Error())
+	}
+	if _, err := Authenticate(db, devAdminUsername, devAdminPassword); err != nil {
+		t.Errorf("Expected dev admin account: %s", err.Error())
+	}
+}
+
+func TestDevInbox(t *testing.T) {
+	inbox := NewDevInbox()
+	o := &Owner{logger: defaultLogger(), tmpl: newTemplates(), devInbox: inbox}
+	inbox.Send(EmailMessage{To: "ala@x.com", Subject: "First", Body: "Hi"})
+	inbox.Send(EmailMessage{To: "ala@x.com", Subject: "Second", Body: "Hi",
+		HTMLBody: `<img src="cid:logo">`,
+		Inline: []emailAttachment{{FileName: "logo.png", ContentType: "image/png",
+			Data: []byte("png"), ContentID: "logo"}}})
+	if msgs := inbox.Messages(); len(msgs) != 2 || msgs[0].Subject != "Second" {
+		t.Fatalf("Expected two messages, the newest first, got %+v", msgs)
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /dev/mail", o.DevMailHandler)
+	mux.HandleFunc("GET /dev/mail/{id}", o.DevMailHandler)
+	mux.HandleFunc("GET /dev/mail/{id}/{part}", o.DevMailPartHandler)
+	mux.HandleFunc("GET /dev/mail/{id}/cid/{cid}", o.DevMailInlineHandler)
+	data := map[string]string{
+		"/dev/mail":            "First",
+		"/dev/mail/2":          "/dev/mail/2/html",
+		"/dev/mail/2/html":     `src="/dev/mail/2/cid/logo"`,
+		"/dev/mail/2/raw":      "Subject: Second",
+		"/dev/mail/2/cid/logo": "png",
+	}
+	for path, expected := range data {
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), expected) {
+			t.Errorf("Expected %s to contain %q, got %d: %s", path, expected,
+				rec.Code, rec.Body.String())
+		}
+	}
+	for _, path := range []string{"/dev/mail/3", "/dev/mail/x/raw", "/dev/mail/1/cid/logo"} {
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		if rec.Code != http.StatusNotFound {
+			t.Errorf("Expected 404 for %s, got %d", path, rec.Code)
+		}
+	}
+}
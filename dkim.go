@@ -0,0 +1,250 @@
+package main
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+const (
+	dkimDefaultHeaders = "From:To:Subject:Date:Message-ID:Reply-To:MIME-Version:Content-Type:List-Unsubscribe"
+	dkimLineLength     = 72
+)
+
+// DKIMConfig describes how outgoing messages are signed.
+type DKIMConfig struct {
+	Domain   string
+	Selector string
+	Headers  []string
+	Key      crypto.Signer
+}
+
+// DKIMSigner adds DKIM-Signature header (RFC 6376) to messages, using relaxed
+// canonicalization for both headers and body. RSA keys are used with
+// rsa-sha256 and Ed25519 keys with ed25519-sha256 (RFC 8463).
+type DKIMSigner struct {
+	cfg       DKIMConfig
+	algorithm string
+}
+
+func NewDKIMSigner(cfg DKIMConfig) (*DKIMSigner, error) {
+	if cfg.Domain == "" || cfg.Selector == "" {
+		return nil, errors.New("DKIM domain and selector are required")
+	}
+	signsFrom := false
+	for _, h := range cfg.Headers {
+		if strings.ContainsAny(h, ": \t\r\n") || h == "" {
+			return nil, fmt.Errorf("incorrect DKIM header name %q", h)
+		}
+		signsFrom = signsFrom || strings.EqualFold(h, "From")
+	}
+	if !signsFrom {
+		return nil, errors.New("DKIM signed headers must include From")
+	}
+	s := &DKIMSigner{cfg: cfg}
+	switch cfg.Key.(type) {
+	case *rsa.PrivateKey:
+		s.algorithm = "rsa-sha256"
+	case ed25519.PrivateKey:
+		s.algorithm = "ed25519-sha256"
+	default:
+		return nil, fmt.Errorf("unsupported DKIM key type %T", cfg.Key)
+	}
+	return s, nil
+}
+
+// dkimSignerFromConfig creates DKIM signer configured by cfg.DKIM* settings.
+// It returns nil signer when DKIM is not enabled (no selector). Private key
+// is read from email secrets (dkimPrivateKey field, PEM encoded RSA or
+// Ed25519 key).
+func dkimSignerFromConfig(cfg EmailConfig, secrets emailSecret) (*DKIMSigner, error) {
+	if cfg.DKIMSelector == "" {
+		return nil, nil
+	}
+	if secrets.DKIMPrivateKey == "" {
+		return nil, errors.New("DKIM selector is set, but email secrets have no dkimPrivateKey")
+	}
+	key, kErr := ParseDKIMKey([]byte(secrets.DKIMPrivateKey))
+	if kErr != nil {
+		return nil, kErr
+	}
+	domain := cfg.DKIMDomain
+	if domain == "" {
+		domain = cfg.From[strings.LastIndex(cfg.From, "@")+1:]
+	}
+	return NewDKIMSigner(DKIMConfig{
+		Domain:   domain,
+		Selector: cfg.DKIMSelector,
+		Headers:  cfg.DKIMHeaders,
+		Key:      key,
+	})
+}
+
+// ParseDKIMKey parses PEM encoded private key. PKCS#1 RSA keys and PKCS#8 RSA
+// or Ed25519 keys are supported.
+func ParseDKIMKey(pemData []byte) (crypto.Signer, error) {
+	block, _ := pem.Decode(pemData)
+	if block == nil {
+		return nil, errors.New("cannot decode DKIM private key PEM")
+	}
+	if block.Type == "RSA PRIVATE KEY" {
+		return x509.ParsePKCS1PrivateKey(block.Bytes)
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse DKIM private key: %w", err)
+	}
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("unsupported DKIM key type %T", key)
+	}
+	return signer, nil
+}
+
+// Sign returns message with DKIM-Signature header prepended. Listed headers
+// which are not present in the message are not signed.
+func (s *DKIMSigner) Sign(message []byte, now time.Time) ([]byte, error) {
+	headerEnd := bytes.Index(message, []byte("\r\n\r\n"))
+	if headerEnd < 0 {
+		return nil, errors.New("message has no header and body separator")
+	}
+	fields := splitHeaderFields(string(message[:headerEnd+2]))
+	body := message[headerEnd+4:]
+	bodyHash := sha256.Sum256(dkimRelaxedBody(body))
+
+	var signedNames []string
+	var signedData strings.Builder
+	used := make(map[int]bool)
+	for _, name := range s.cfg.Headers {
+		// Header fields are signed from the bottom, when there are many
+		// instances of the same field.
+		for idx := len(fields) - 1; idx >= 0; idx-- {
+			if used[idx] || !strings.EqualFold(headerFieldName(fields[idx]), name) {
+				continue
+			}
+			used[idx] = true
+			signedNames = append(signedNames, strings.ToLower(name))
+			signedData.WriteString(dkimRelaxedHeader(fields[idx]) + "\r\n")
+			break
+		}
+	}
+
+	signature := fmt.Sprintf(
+		"DKIM-Signature: v=1; a=%s; c=relaxed/relaxed; d=%s; s=%s;\r\n t=%d; h=%s;\r\n bh=%s;\r\n b=",
+		s.algorithm, s.cfg.Domain, s.cfg.Selector, now.Unix(),
+		strings.Join(signedNames, ":"),
+		base64.StdEncoding.EncodeToString(bodyHash[:]),
+	)
+	signedData.WriteString(dkimRelaxedHeader(signature))
+	digest := sha256.Sum256([]byte(signedData.String()))
+
+	var sig []byte
+	var sErr error
+	if s.algorithm == "ed25519-sha256" {
+		sig, sErr = s.cfg.Key.Sign(rand.Reader, digest[:], crypto.Hash(0))
+	} else {
+		sig, sErr = s.cfg.Key.Sign(rand.Reader, digest[:], crypto.SHA256)
+	}
+	if sErr != nil {
+		return nil, fmt.Errorf("cannot compute DKIM signature: %w", sErr)
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString(signature)
+	encoded := base64.StdEncoding.EncodeToString(sig)
+	for len(encoded) > dkimLineLength {
+		buf.WriteString(encoded[:dkimLineLength] + "\r\n ")
+		encoded = encoded[dkimLineLength:]
+	}
+	buf.WriteString(encoded + "\r\n")
+	buf.Write(message)
+	return buf.Bytes(), nil
+}
+
+// splitHeaderFields splits message header into fields. Folded lines are kept
+// together with their field, CRLF at the end of each field is dropped.
+func splitHeaderFields(header string) []string {
+	var fields []string
+	for _, line := range strings.SplitAfter(header, "\r\n") {
+		if line == "" {
+			continue
+		}
+		if (line[0] == ' ' || line[0] == '\t') && len(fields) > 0 {
+			fields[len(fields)-1] += line
+			continue
+		}
+		fields = append(fields, line)
+	}
+	for idx := range fields {
+		fields[idx] = strings.TrimSuffix(fields[idx], "\r\n")
+	}
+	return fields
+}
+
+func headerFieldName(field string) string {
+	name, _, _ := strings.Cut(field, ":")
+	return strings.TrimRight(name, " \t")
+}
+
+// dkimRelaxedHeader canonicalizes header field according to RFC 6376 3.4.2.
+// Result has no trailing CRLF.
+func dkimRelaxedHeader(field string) string {
+	name, value, _ := strings.Cut(field, ":")
+	value = strings.ReplaceAll(value, "\r\n", "")
+	value = strings.Join(strings.FieldsFunc(value, isWsp), " ")
+	return strings.ToLower(strings.TrimRight(name, " \t")) + ":" + value
+}
+
+// dkimRelaxedBody canonicalizes message body according to RFC 6376 3.4.4.
+func dkimRelaxedBody(body []byte) []byte {
+	lines := strings.Split(string(body), "\r\n")
+	for idx, line := range lines {
+		line = strings.TrimRight(line, " \t")
+		var b strings.Builder
+		inWsp := false
+		for _, r := range line {
+			if isWsp(r) {
+				inWsp = true
+				continue
+			}
+			if inWsp {
+				b.WriteByte(' ')
+				inWsp = false
+			}
+			b.WriteRune(r)
+		}
+		lines[idx] = b.String()
+	}
+	for len(lines) > 0 && lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	if len(lines) == 0 {
+		return nil
+	}
+	return []byte(strings.Join(lines, "\r\n") + "\r\n")
+}
+
+func isWsp(r rune) bool {
+	return r == ' ' || r == '\t'
+}
+
+// buildSignedMessage renders message and signs it, when DKIM signer is
+// configured.
+func buildSignedMessage(msg EmailMessage, dkim *DKIMSigner) ([]byte, error) {
+	now := time.Now()
+	message, err := BuildMessage(msg, now)
+	if err != nil || dkim == nil {
+		return message, err
+	}
+	return dkim.Sign(message, now)
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDKIMCanonicalization(t *testing.T) {
+	// Example from RFC 6376 section 3.4.5.
+	fields := splitHeaderFields("A: X\r\nB : Y\t\r\n\tZ  \r\n")
+	var headers []string
+	for _, f := range fields {
+		headers = append(headers, dkimRelaxedHeader(f))
+	}
+	if got := strings.Join(headers, "\r\n"); got != "a:X\r\nb:Y Z" {
+		t.Errorf("Unexpected relaxed headers: %q", got)
+	}
+	body := dkimRelaxedBody([]byte(" C \r\nD \t E\r\n\r\n\r\n"))
+	if string(body) != " C\r\nD E\r\n" {
+		t.Errorf("Unexpected relaxed body: %q", body)
+	}
+	if empty := dkimRelaxedBody([]byte("\r\n\r\n")); len(empty) != 0 {
+		t.Errorf("Expected empty body, got %q", empty)
+	}
+}
+
+func TestDKIMSignAndVerify(t *testing.T) {
+	rsaKey, rErr := rsa.GenerateKey(rand.Reader, 2048)
+	if rErr != nil {
+		t.Fatalf("Cannot generate RSA key: %s", rErr.Error())
+	}
+	_, edKey, eErr := ed25519.GenerateKey(rand.Reader)
+	if eErr != nil {
+		t.Fatalf("Cannot generate Ed25519 key: %s", eErr.Error())
+	}
+	msg := EmailMessage{
+		To:       "Ala <ala@x.com>",
+		Subject:  "Zażółć gęślą jaźń - a rather long subject which gets folded",
+		Body:     "Hello!  \n\nSee you there.\n",
+		HTMLBody: "<p>Hello!</p>",
+	}
+	message, bErr := BuildMessage(msg, time.Now())
+	if bErr != nil {
+		t.Fatalf("Cannot build message: %s", bErr.Error())
+	}
+
+	for _, key := range []crypto.Signer{rsaKey, edKey} {
+		signer, sErr := NewDKIMSigner(DKIMConfig{
+			Domain:   "dskrzypiec.dev",
+			Selector: "ff",
+			Headers:  strings.Split(dkimDefaultHeaders, ":"),
+			Key:      key,
+		})
+		if sErr != nil {
+			t.Fatalf("Cannot create DKIM signer: %s", sErr.Error())
+		}
+		signed, sErr := signer.Sign(message, time.Now())
+		if sErr != nil {
+			t.Fatalf("Cannot sign message: %s", sErr.Error())
+		}
+		if err := verifyDKIM(signed, key.Public()); err != "" {
+			t.Errorf("Signature (%s) does not verify: %s", signer.algorithm,
+				err)
+		}
+		// Modified body and headers shall break the signature.
+		tamperedBody := strings.Replace(string(signed), "Hello!", "Hi!", 1)
+		if err := verifyDKIM([]byte(tamperedBody), key.Public()); err == "" {
+			t.Errorf("Expected %s signature to fail for modified body",
+				signer.algorithm)
+		}
+		tamperedTo := strings.Replace(string(signed), "ala@x.com", "eve@x.com", 1)
+		if err := verifyDKIM([]byte(tamperedTo), key.Public()); err == "" {
+			t.Errorf("Expected %s signature to fail for modified header",
+				signer.algorithm)
+		}
+	}
+}
+
+func TestParseDKIMKey(t *testing.T) {
+	rsaKey, _ := rsa.GenerateKey(rand.Reader, 1024)
+	_, edKey, _ := ed25519.GenerateKey(rand.Reader)
+	edDer, _ := x509.MarshalPKCS8PrivateKey(edKey)
+	blocks := []*pem.Block{
+		{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(rsaKey)},
+		{Type: "PRIVATE KEY", Bytes: edDer},
+	}
+	for _, block := range blocks {
+		if _, err := ParseDKIMKey(pem.EncodeToMemory(block)); err != nil {
+			t.Errorf("Cannot parse %s: %s", block.Type, err.Error())
+		}
+	}
+	if _, err := ParseDKIMKey([]byte("not a key")); err == nil {
+		t.Error("Expected error for incorrect PEM")
+	}
+}
+
+func TestNewDKIMSignerRequiresFrom(t *testing.T) {
+	_, edKey, _ := ed25519.GenerateKey(rand.Reader)
+	_, err := NewDKIMSigner(DKIMConfig{Domain: "x.com", Selector: "s",
+		Headers: []string{"To", "Subject"}, Key: edKey})
+	if err == nil {
+		t.Error("Expected error when From is not signed")
+	}
+}
+
+// verifyDKIM verifies the first DKIM-Signature of the message as a receiving
+// server would do. It returns description of the problem or empty string.
+func verifyDKIM(message []byte, pub crypto.PublicKey) string {
+	raw := string(message)
+	headerEnd := strings.Index(raw, "\r\n\r\n")
+	fields := splitHeaderFields(raw[:headerEnd+2])
+	body := raw[headerEnd+4:]
+	sigField := fields[0]
+	if !strings.HasPrefix(sigField, "DKIM-Signature:") {
+		return "no DKIM-Signature header"
+	}
+	tags := make(map[string]string)
+	_, value, _ := strings.Cut(sigField, ":")
+	for _, tag := range strings.Split(value, ";") {
+		name, v, _ := strings.Cut(tag, "=")
+		tags[strings.TrimSpace(name)] = regexp.MustCompile(`\s+`).
+			ReplaceAllString(v, "")
+	}
+	if tags["c"] != "relaxed/relaxed" || tags["d"] != "dskrzypiec.dev" ||
+		tags["s"] != "ff" {
+		return "unexpected tags: " + value
+	}
+
+	bodyHash := sha256.Sum256(dkimRelaxedBody([]byte(body)))
+	if base64.StdEncoding.EncodeToString(bodyHash[:]) != tags["bh"] {
+		return "body hash mismatch"
+	}
+
+	var data strings.Builder
+	used := make(map[int]bool)
+	for _, name := range strings.Split(tags["h"], ":") {
+		for idx := len(fields) - 1; idx > 0; idx-- {
+			fieldName, _, _ := strings.Cut(fields[idx], ":")
+			if !used[idx] && strings.EqualFold(strings.TrimSpace(fieldName), name) {
+				used[idx] = true
+				data.WriteString(dkimRelaxedHeader(fields[idx]) + "\r\n")
+				break
+			}
+		}
+	}
+	unsigned := regexp.MustCompile(`b=[^;]*$`).ReplaceAllString(sigField, "b=")
+	data.WriteString(dkimRelaxedHeader(unsigned))
+	digest := sha256.Sum256([]byte(data.String()))
+
+	sig, _ := base64.StdEncoding.DecodeString(tags["b"])
+	switch key := pub.(type) {
+	case *rsa.PublicKey:
+		if tags["a"] != "rsa-sha256" {
+			return "unexpected algorithm " + tags["a"]
+		}
+		if err := rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], sig); err != nil {
+			return err.Error()
+		}
+	case ed25519.PublicKey:
+		if tags["a"] != "ed25519-sha256" {
+			return "unexpected algorithm " + tags["a"]
+		}
+		if !ed25519.Verify(key, digest[:], sig) {
+			return "invalid Ed25519 signature"
+		}
+	}
+	return ""
+}
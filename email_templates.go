@@ -0,0 +1,206 @@
+package main
+
+import (
+	"bytes"
+	"embed"
+	"errors"
+	"fmt"
+	htmltemplate "html/template"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	texttemplate "text/template"
+)
+
+const (
+	emailConfirmationRequest    = "confirmation-request"
+	emailConfirmationReminder   = "confirmation-reminder"
+	emailWaitlistConfirmation   = "waitlist-confirmation"
+	emailAttendanceConfirmation = "attendance-confirmation"
+	emailEventUpdate            = "event-update"
+	emailSpotOffer              = "spot-offer"
+
+	emailLayoutFile = "layout.html"
+	emailLogoCid    = "logo"
+)
+
+//go:embed views/emails
+var emailsFS embed.FS
+
+// emailData is passed to email templates. Fields which are not relevant for
+// given email are left empty.
+type emailData struct {
+	Event        EventRow
+	Nickname     string
+	ConfirmUrl   string
+	CancelUrl    string
+	ClaimUrl     string
+	CalendarUrl  string
+	WaitlistRank int
+	OfferExpires string
+
+	// Set by emailTemplates while rendering.
+	BaseUrl string
+	LogoCid string
+}
+
+type emailButton struct {
+	Url   string
+	Label string
+}
+
+// emailTemplates renders emails from views/emails. Each email consists of
+// <name>.txt with plain text body and "subject" template and <name>.html with
+// "content" template, which is rendered within layout.html.
+type emailTemplates struct {
+	overrideDir string
+	cache       map[string]*emailTemplate
+}
+
+type emailTemplate struct {
+	text *texttemplate.Template
+	html *htmltemplate.Template
+}
+
+// newEmailTemplates parses all email templates, so errors are reported on
+// startup. When overrideDir is not empty, files from that directory take
+// precedence over embedded templates.
+func newEmailTemplates(overrideDir string) (*emailTemplates, error) {
+	t := &emailTemplates{overrideDir: overrideDir,
+		cache: make(map[string]*emailTemplate)}
+	names := []string{emailConfirmationRequest, emailConfirmationReminder,
+		emailWaitlistConfirmation,
+		emailAttendanceConfirmation, emailEventUpdate, emailSpotOffer}
+	for _, name := range names {
+		tmpl, pErr := t.parse(name)
+		if pErr != nil {
+			return nil, pErr
+		}
+		t.cache[name] = tmpl
+	}
+	if _, lErr := t.logo(); lErr != nil {
+		return nil, lErr
+	}
+	return t, nil
+}
+
+// Message renders email with given name. Recipient and attachments are left
+// for the caller to fill in.
+func (t *emailTemplates) Message(name string, data emailData) (EmailMessage, error) {
+	tmpl, ok := t.cache[name]
+	if t.overrideDir != "" || !ok {
+		var pErr error
+		if tmpl, pErr = t.parse(name); pErr != nil {
+			return EmailMessage{}, pErr
+		}
+	}
+	data.BaseUrl = appBaseUrl
+	data.LogoCid = emailLogoCid
+
+	var subject, text, html bytes.Buffer
+	if err := tmpl.text.ExecuteTemplate(&subject, "subject", data); err != nil {
+		return EmailMessage{}, fmt.Errorf("cannot render subject of %s: %w",
+			name, err)
+	}
+	if err := tmpl.text.Execute(&text, data); err != nil {
+		return EmailMessage{}, fmt.Errorf("cannot render text of %s: %w", name,
+			err)
+	}
+	if err := tmpl.html.ExecuteTemplate(&html, "layout", data); err != nil {
+		return EmailMessage{}, fmt.Errorf("cannot render HTML of %s: %w", name,
+			err)
+	}
+	logo, lErr := t.logo()
+	if lErr != nil {
+		return EmailMessage{}, lErr
+	}
+	return EmailMessage{
+		Subject:  strings.TrimSpace(subject.String()),
+		Body:     text.String(),
+		HTMLBody: html.String(),
+		Inline:   []emailAttachment{logo},
+	}, nil
+}
+
+func (t *emailTemplates) parse(name string) (*emailTemplate, error) {
+	textSrc, tErr := t.readFile(name + ".txt")
+	if tErr != nil {
+		return nil, tErr
+	}
+	text, tpErr := texttemplate.New(name).Parse(string(textSrc))
+	if tpErr != nil {
+		return nil, fmt.Errorf("cannot parse %s.txt: %w", name, tpErr)
+	}
+	if text.Lookup("subject") == nil {
+		return nil, fmt.Errorf("%s.txt does not define subject template", name)
+	}
+
+	html := htmltemplate.New(name).Funcs(htmltemplate.FuncMap{
+		"button": func(url, label string) emailButton {
+			return emailButton{Url: url, Label: label}
+		},
+	})
+	for _, file := range []string{emailLayoutFile, name + ".html"} {
+		src, rErr := t.readFile(file)
+		if rErr != nil {
+			return nil, rErr
+		}
+		if _, pErr := html.Parse(string(src)); pErr != nil {
+			return nil, fmt.Errorf("cannot parse %s: %w", file, pErr)
+		}
+	}
+	return &emailTemplate{text: text, html: html}, nil
+}
+
+// readFile reads template from the override directory, if it's there, or
+// from embedded views/emails otherwise.
+func (t *emailTemplates) readFile(file string) ([]byte, error) {
+	if t.overrideDir != "" {
+		content, err := os.ReadFile(filepath.Join(t.overrideDir, file))
+		if err == nil {
+			return content, nil
+		}
+		if !errors.Is(err, fs.ErrNotExist) {
+			return nil, fmt.Errorf("cannot read email template %s: %w", file,
+				err)
+		}
+	}
+	content, err := emailsFS.ReadFile("views/emails/" + file)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read email template %s: %w", file, err)
+	}
+	return content, nil
+}
+
+// logo returns ppacer logo embedded into HTML emails. SVG is not rendered by
+// every email client, so logo.png placed in the override directory is used
+// instead, when present.
+func (t *emailTemplates) logo() (emailAttachment, error) {
+	if t.overrideDir != "" {
+		png, err := os.ReadFile(filepath.Join(t.overrideDir, "logo.png"))
+		if err == nil {
+			return emailAttachment{FileName: "logo.png",
+				ContentType: "image/png", Data: png, ContentID: emailLogoCid}, nil
+		}
+	}
+	svg, err := staticFS.ReadFile("assets/logo_ff.svg")
+	if err != nil {
+		return emailAttachment{}, fmt.Errorf("cannot read logo: %w", err)
+	}
+	return emailAttachment{FileName: "logo.svg", ContentType: "image/svg+xml",
+		Data: svg, ContentID: emailLogoCid}, nil
+}
+
+// queueTemplatedEmail renders email template and puts it into the outbox.
+func (o *Owner) queueTemplatedEmail(to, name string, data emailData, attachments ...emailAttachment) error {
+	msg, rErr := o.emails.Message(name, data)
+	if rErr != nil {
+		o.logger.Error("Cannot render email", "template", name, "to", to,
+			"err", rErr.Error())
+		return rErr
+	}
+	msg.To = to
+	msg.Attachments = attachments
+	return o.queueEmail(msg)
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestEmailTemplatesRender(t *testing.T) {
+	emails, eErr := newEmailTemplates("")
+	if eErr != nil {
+		t.Fatalf("Cannot parse email templates: %s", eErr.Error())
+	}
+	event := defaultEvent()
+	event.Title = "Tom & Jerry"
+	data := emailData{
+		Event:       event,
+		Nickname:    "<Ala>",
+		CalendarUrl: "https://ff.ppacer.org/calendar/abc",
+		CancelUrl:   "https://ff.ppacer.org/events/x/cancel/abc",
+	}
+	msg, mErr := emails.Message(emailAttendanceConfirmation, data)
+	if mErr != nil {
+		t.Fatalf("Cannot render email: %s", mErr.Error())
+	}
+	if msg.Subject != "Tom & Jerry - confirmation" {
+		t.Errorf("Unexpected subject: %q", msg.Subject)
+	}
+	for _, expected := range []string{"Hello <Ala>!", "Tom & Jerry",
+		data.CalendarUrl, "When: " + event.DateUI()} {
+		if !strings.Contains(msg.Body, expected) {
+			t.Errorf("Expected %q in text body:\n%s", expected, msg.Body)
+		}
+	}
+	for _, expected := range []string{"Hello &lt;Ala&gt;!", "Tom &amp; Jerry",
+		`src="cid:logo"`, `href="` + data.CalendarUrl + `"`} {
+		if !strings.Contains(msg.HTMLBody, expected) {
+			t.Errorf("Expected %q in HTML body:\n%s", expected, msg.HTMLBody)
+		}
+	}
+	if len(msg.Inline) != 1 || msg.Inline[0].ContentID != emailLogoCid ||
+		msg.Inline[0].ContentType != "image/svg+xml" {
+		t.Errorf("Expected logo as inline image, got %+v", msg.Inline)
+	}
+
+	msg.To = "ala@x.com"
+	if _, bErr := BuildMessage(msg, time.Now()); bErr != nil {
+		t.Errorf("Cannot build rendered email: %s", bErr.Error())
+	}
+}
+
+func TestEmailTemplatesOverrideDir(t *testing.T) {
+	dir := t.TempDir()
+	emails, eErr := newEmailTemplates(dir)
+	if eErr != nil {
+		t.Fatalf("Cannot parse email templates: %s", eErr.Error())
+	}
+	override := "{{ define \"subject\" }}Spot for {{ .Event.Title }}{{ end }}Claim: {{ .ClaimUrl }}"
+	wErr := os.WriteFile(filepath.Join(dir, emailSpotOffer+".txt"),
+		[]byte(override), 0o644)
+	if wErr != nil {
+		t.Fatalf("Cannot write template: %s", wErr.Error())
+	}
+	os.WriteFile(filepath.Join(dir, "logo.png"), []byte("png"), 0o644)
+
+	data := emailData{Event: defaultEvent(), ClaimUrl: "https://x/claim"}
+	msg, mErr := emails.Message(emailSpotOffer, data)
+	if mErr != nil {
+		t.Fatalf("Cannot render email: %s", mErr.Error())
+	}
+	if msg.Subject != "Spot for "+data.Event.Title || msg.Body != "Claim: https://x/claim" {
+		t.Errorf("Expected overridden text template, got %q / %q", msg.Subject,
+			msg.Body)
+	}
+	if !strings.Contains(msg.HTMLBody, "Claim my spot") {
+		t.Errorf("Expected embedded HTML template, got:\n%s", msg.HTMLBody)
+	}
+	if msg.Inline[0].ContentType != "image/png" {
+		t.Errorf("Expected PNG logo from override dir, got %s",
+			msg.Inline[0].ContentType)
+	}
+}
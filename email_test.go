@@ -1,21 +1,41 @@
 package main
 
-import "testing"
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
 
 func TestEmail(t *testing.T) {
-	secrets, awsErr := getEmailSecrets()
-	if awsErr != nil {
-		t.Errorf("Cannot get secrets from AWS: %s", awsErr.Error())
+	dir := t.TempDir()
+	mailer, mErr := NewFileMailer(dir)
+	if mErr != nil {
+		t.Fatalf("Cannot create file mailer: %s", mErr.Error())
 	}
 	body := `Oi mate!
 Check out this proper link: https://ppacer.org
 
 Peace out, mate!
 	`
-	sErr := sendEmail(
-		"damians.lbn@gmail.com", "Another test from Go", body, secrets,
-	)
+	sErr := mailer.Send(EmailMessage{
+		To: "damians.lbn@gmail.com", Subject: "Another test from Go",
+		Body: body,
+	})
 	if sErr != nil {
 		t.Errorf("Cannot send email: %s", sErr.Error())
 	}
+	files, _ := filepath.Glob(filepath.Join(dir, "*.eml"))
+	if len(files) != 1 {
+		t.Fatalf("Expected single .eml file, got %v", files)
+	}
+	content, _ := os.ReadFile(files[0])
+	for _, expected := range []string{
+		"To: <damians.lbn@gmail.com>", "Subject: Another test from Go",
+		"Check out this proper link",
+	} {
+		if !strings.Contains(string(content), expected) {
+			t.Errorf("Expected %q in email:\n%s", expected, content)
+		}
+	}
 }
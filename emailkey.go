@@ -0,0 +1,114 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"golang.org/x/net/idna"
+)
+
+// Separator of the suffix which makes EmailKey of near-duplicates
+// registered before EmailKey was introduced unique.
+const emailDuplicateSep = "#"
+
+// EmailDuplicate is registration which has the same EmailKey as another
+// registration for the event.
+type EmailDuplicate struct {
+	EventSlug   string
+	Email       string
+	DuplicateOf string
+}
+
+// EmailKey returns normalized form of email address used to compare
+// addresses. Case is folded and internationalized domain is converted into
+// ASCII form, so "Foo@Bücher.de" and "foo@xn--bcher-kva.de" are the same
+// person. Address as typed is kept for sending.
+func EmailKey(email string) string {
+	email = strings.ToLower(strings.TrimSpace(email))
+	at := strings.LastIndex(email, "@")
+	if at < 0 {
+		return email
+	}
+	local, domain := email[:at], email[at+1:]
+	if ascii, err := idna.Lookup.ToASCII(domain); err == nil {
+		domain = ascii
+	}
+	return local + "@" + strings.TrimSuffix(domain, ".")
+}
+
+// EmailDuplicates returns near-duplicate registrations found when EmailKey
+// was introduced, which haven't been resolved yet. Those have EmailKey
+// different from the key of their email.
+func EmailDuplicates(db *SqliteDB) ([]EmailDuplicate, error) {
+	rows, qErr := db.Query(readEmailKeysQuery())
+	if qErr != nil {
+		return nil, fmt.Errorf("cannot query email keys: %w", qErr)
+	}
+	defer rows.Close()
+	owners := make(map[[2]string]string)
+	var duplicates []EmailDuplicate
+	for rows.Next() {
+		var eventSlug, email, key string
+		if err := rows.Scan(&eventSlug, &email, &key); err != nil {
+			return nil, fmt.Errorf("cannot scan email key: %w", err)
+		}
+		owners[[2]string{eventSlug, key}] = email
+		if key != EmailKey(email) {
+			duplicates = append(duplicates,
+				EmailDuplicate{EventSlug: eventSlug, Email: email})
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	for idx, d := range duplicates {
+		duplicates[idx].DuplicateOf = owners[[2]string{d.EventSlug, EmailKey(d.Email)}]
+	}
+	return duplicates, nil
+}
+
+// restoreEmailKey gives EmailKey of deleted registration to the first of its
+// near-duplicates, so it no longer needs the "#<rowid>" suffix. Nothing is
+// changed when another registration still has the key.
+func restoreEmailKey(db sqlExecer, eventSlug, email string) error {
+	key := EmailKey(email)
+	_, uErr := db.Exec(restoreEmailKeyQuery(), key, eventSlug, key, key,
+		eventSlug, key)
+	if uErr != nil {
+		return fmt.Errorf("cannot restore email key %s: %w", key, uErr)
+	}
+	return nil
+}
+
+func readEmailKeysQuery() string {
+	return `
+	SELECT
+		EventSlug,
+		Email,
+		EmailKey
+	FROM
+		users
+`
+}
+
+func restoreEmailKeyQuery() string {
+	return `
+	UPDATE
+		users
+	SET
+		EmailKey = ?
+	WHERE
+			rowid = (
+				SELECT
+					MIN(rowid)
+				FROM
+					users
+				WHERE
+						EventSlug = ?
+					AND substr(EmailKey, 1, length(?) + 1) = ? || '#'
+			)
+		AND NOT EXISTS (
+			SELECT 1 FROM users WHERE EventSlug = ? AND EmailKey = ?
+		)
+`
+}
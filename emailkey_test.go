@@ -0,0 +1,23 @@
+package main
+
+import "testing"
+
+func TestEmailKey(t *testing.T) {
+	data := map[string]string{
+		"foo@example.com":              "foo@example.com",
+		" Foo@Example.COM ":            "foo@example.com",
+		"ala@bücher.de":                "ala@xn--bcher-kva.de",
+		"Ala@BÜCHER.de":                "ala@xn--bcher-kva.de",
+		"ala@xn--bcher-kva.de":         "ala@xn--bcher-kva.de",
+		"kot@München.example.":         "kot@xn--mnchen-3ya.example",
+		"info@пример.испытание":        "info@xn--e1afmkfd.xn--80akhbyknj4f",
+		"info@例え。テスト":                  "info@xn--r8jz45g.xn--zckzah",
+		"not-an-email":                 "not-an-email",
+		"\"Quoted@Local\"@example.com": "\"quoted@local\"@example.com",
+	}
+	for email, expected := range data {
+		if key := EmailKey(email); key != expected {
+			t.Errorf("Expected key %s for %s, got %s", expected, email, key)
+		}
+	}
+}
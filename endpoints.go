@@ -4,52 +4,162 @@ import (
 	"fmt"
 	"log/slog"
 	"net/http"
+	"strings"
 	"time"
 )
 
+// Base URL of the public site, used in links sent via email. It's set from
+// configuration.
+var appBaseUrl = defaultBaseUrl
+
 type User struct {
+	EventSlug      string
 	Email          string
 	Nickname       *string
-	Hash           string
 	RegistrationTs time.Time
 	Confirmed      bool
 	ConfirmationTs time.Time
 	Drinks         bool
+	Spot           string
+	WaitlistPos    int
 }
 
 type page struct {
 	ShowForm          bool
 	PostRegisterInfo  string
 	PostRegisterError string
+	Event             *EventRow
+	SpotsLeft         int
+	ResendEmail       string
+	ConfirmUrl        string
+	CancelUrl         string
+	ClaimUrl          string
+	UpcomingEvents    []EventRow
+	PastEvents        []EventRow
 }
 
 type Owner struct {
 	db       *SqliteDB
 	logger   *slog.Logger
 	tmpl     *templates
-	secrets  emailSecret
-	telegram *Telegram
+	emails   *emailTemplates
+	mailer   Mailer
+	notifier Notifier
+
+	// outboxWakeup tells email worker that new message was queued.
+	outboxWakeup chan struct{}
+
+	bounceWebhookToken string
+
+	// Registration ages after which confirmation reminders are sent.
+	confirmReminders []time.Duration
+	summaryHour      int
+
+	// devInbox captures emails in development mode.
+	devInbox *DevInbox
 }
 
-func NewOwner(db *SqliteDB, logger *slog.Logger, tmpl *templates) *Owner {
-	emailSecret, err := getEmailSecrets()
-	if err != nil {
-		logger.Error("Cannot get email credentials from AWS", "err",
-			err.Error())
-		panic(err)
+// NewOwner creates application state. When secrets, mailer or notifiers
+// cannot be configured, the application runs in degraded mode with emails or
+// notifications disabled. In development mode emails are captured in
+// DevInbox and notifications are logged.
+func NewOwner(cfg Config, db *SqliteDB, logger *slog.Logger, tmpl *templates) *Owner {
+	var mailer Mailer = disabledMailer{}
+	var notifier Notifier = MultiNotifier{}
+	var devInbox *DevInbox
+	secrets, sErr := NewSecretsProviderFromConfig(cfg.Secrets)
+	if cfg.Dev {
+		devInbox = NewDevInbox()
+		mailer = devInbox
+		notifier = LogNotifier{logger: logger}
+	} else if sErr != nil {
+		logger.Error("Cannot configure secrets, emails and notifications are disabled",
+			"err", sErr.Error())
+	} else {
+		if m, err := NewMailerFromConfig(cfg.Email, secrets); err != nil {
+			logger.Error("Cannot configure mailer, emails are disabled", "err",
+				err.Error())
+		} else {
+			mailer = m
+		}
+		if n, err := NewNotifierFromConfig(cfg.Notifiers, secrets); err != nil {
+			logger.Error("Cannot configure notifiers, notifications are disabled",
+				"err", err.Error())
+		} else {
+			notifier = n
+		}
+	}
+	emails, eErr := newEmailTemplates(cfg.Email.TemplatesDir)
+	if eErr != nil {
+		logger.Error("Cannot parse email templates", "err", eErr.Error())
+		panic(eErr)
+	}
+	confirmReminders := make([]time.Duration, 0, len(cfg.Reminders.ConfirmAfter))
+	for _, after := range cfg.Reminders.ConfirmAfter {
+		confirmReminders = append(confirmReminders, after.Duration)
 	}
 	return &Owner{
 		db:       db,
 		logger:   logger,
 		tmpl:     tmpl,
-		secrets:  emailSecret,
-		telegram: NewTelegram(),
+		emails:   emails,
+		mailer:   mailer,
+		notifier: notifier,
+
+		outboxWakeup: make(chan struct{}, 1),
+
+		bounceWebhookToken: cfg.Email.BounceWebhookToken,
+
+		confirmReminders: confirmReminders,
+		summaryHour:      cfg.Reminders.SummaryHour,
+
+		devInbox: devInbox,
 	}
 }
 
 func (o *Owner) MainHandler(w http.ResponseWriter, r *http.Request) {
+	events, eErr := ListEvents(o.db)
+	if eErr != nil {
+		o.logger.Error("Cannot list events", "err", eErr.Error())
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	var p page
+	for _, event := range events {
+		if !event.IsVisible() {
+			continue
+		}
+		if event.IsOpen() {
+			p.UpcomingEvents = append(p.UpcomingEvents, event)
+		} else {
+			p.PastEvents = append(p.PastEvents, event)
+		}
+	}
 	w.Header().Set("Content-Type", "text/html; charset=utf-8")
-	renderErr := o.tmpl.Render(w, "index", page{ShowForm: true})
+	renderErr := o.tmpl.Render(w, "index", p)
+	if renderErr != nil {
+		o.logger.Error("Cannot render <index>", "err", renderErr.Error())
+	}
+}
+
+// EventHandler renders event page. Registration form is shown only for open
+// events, past events are rendered as read-only archive.
+func (o *Owner) EventHandler(w http.ResponseWriter, r *http.Request) {
+	event, ok := o.visibleEvent(w, r.PathValue("slug"))
+	if !ok {
+		return
+	}
+	p := page{ShowForm: event.IsOpen(), Event: &event}
+	if event.HasCapacityLimit() {
+		taken, tErr := TakenSpots(o.db, event.Slug)
+		if tErr != nil {
+			o.logger.Error("Cannot count taken spots", "event", event.Slug,
+				"err", tErr.Error())
+		}
+		p.SpotsLeft = max(event.Capacity-taken, 0)
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	renderErr := o.tmpl.Render(w, "index", p)
 	if renderErr != nil {
 		o.logger.Error("Cannot render <index>", "err", renderErr.Error())
 	}
@@ -60,29 +170,55 @@ func (o *Owner) HealthHandler(w http.ResponseWriter, _ *http.Request) {
 }
 
 func (o *Owner) RegistrationHandler(w http.ResponseWriter, r *http.Request) {
-	email := r.FormValue("email")
+	event, ok := o.visibleEvent(w, r.PathValue("slug"))
+	if !ok {
+		return
+	}
+	if !event.IsOpen() {
+		p := page{PostRegisterError: "Registration for this event is closed."}
+		renderErr := o.tmpl.Render(w, "notifications", p)
+		if renderErr != nil {
+			o.logger.Error("Cannot render <index>", "err", renderErr.Error())
+		}
+		return
+	}
+	email := strings.TrimSpace(r.FormValue("email"))
 	nickname := r.FormValue("nickname")
 	drinks := r.FormValue("drinks")
 	drinksBool := drinks == "on"
 
-	userDb, uErr := UserByEmail(o.db, email)
-	exists := uErr != ErrUserNotFound
-	if uErr != nil && uErr != ErrUserNotFound {
-		o.logger.Error("Unexpected error while reading user info", "email",
-			email, "err", uErr.Error())
+	user := User{
+		Email:          email,
+		Nickname:       &nickname,
+		RegistrationTs: time.Now(),
+		Drinks:         drinksBool,
+		Confirmed:      false,
 	}
-	if exists {
-		var errMsg string
+	userDb, created, rErr := RegisterUser(o.db, event, user)
+	if rErr != nil {
+		o.logger.Error("Cannot register user", "event", event.Slug, "email",
+			email, "err", rErr.Error())
+		o.notifier.Send(
+			fmt.Sprintf("[ppacerFF] Cannot register user [%s] for [%s]: %s",
+				email, event.Slug, rErr.Error()),
+		)
+		p := page{PostRegisterError: "Something went wrong. Please try again or contact info@dskrzypiec.dev"}
+		renderErr := o.tmpl.Render(w, "notifications", p)
+		if renderErr != nil {
+			o.logger.Error("Cannot render <index>", "err", renderErr.Error())
+		}
+		return
+	}
+	if !created {
+		p := page{Event: &event}
 		if userDb.Confirmed == 1 {
-			errMsg = fmt.Sprintf("Person using email [%s] is already registered, thank you!",
+			p.PostRegisterError = fmt.Sprintf("Person using email [%s] is already registered, thank you!",
 				email)
 		} else {
-			errMsg = fmt.Sprintf("Person using email [%s] is already registered "+
+			p.PostRegisterError = fmt.Sprintf("Person using email [%s] is already registered "+
 				"but didn't confirm their email. Please check your inbox and spam folder.",
 				email)
-		}
-		p := page{
-			PostRegisterError: errMsg,
+			p.ResendEmail = email
 		}
 		renderErr := o.tmpl.Render(w, "notifications", p)
 		if renderErr != nil {
@@ -91,106 +227,281 @@ func (o *Owner) RegistrationHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	now := time.Now()
-	hash := userHash(email, now)
-	user := User{
-		Email:          email,
-		Nickname:       &nickname,
-		Hash:           hash,
-		RegistrationTs: now,
-		Drinks:         drinksBool,
-		Confirmed:      false,
+	spot := userDb.Spot
+	o.notifier.Send(
+		fmt.Sprintf("[ppacerFF] New user registered for [%s] (%s): [%s] - %s",
+			event.Slug, spot, user.Email, *user.Nickname),
+	)
+	if spot == SpotAttendee {
+		o.notifyCapacity(event, 1)
 	}
-	iErr := InsertNewUser(o.db, user)
-	if iErr != nil {
-		o.logger.Error("Cannot insert new user", "user", user, "err",
-			iErr.Error())
-		o.telegram.Send(
-			fmt.Sprintf("[ppacerFF] Cannot insert new user [%s]: %s",
-				user.Email, iErr.Error()),
+
+	// Errors are already logged by issueToken and queueEmail.
+	if sErr := o.sendConfirmationRequest(event, email); sErr != nil {
+		o.notifier.Send(
+			fmt.Sprintf("[ppacerFF] Cannot send confirmation request to [%s] for [%s]: %s",
+				email, event.Slug, sErr.Error()),
 		)
+		p := page{
+			Event: &event,
+			PostRegisterError: fmt.Sprintf("You have been registered, but we couldn't "+
+				"send the confirmation email to [%s]. Please try sending it again.",
+				email),
+			ResendEmail: email,
+		}
+		renderErr := o.tmpl.Render(w, "notifications", p)
+		if renderErr != nil {
+			o.logger.Error("Cannot render <index>", "err", renderErr.Error())
+		}
+		return
 	}
-	sendEmail(
-		email,
-		"ppacer preview: friends&family - email confirmation",
-		fmt.Sprintf("Please confirm your email by clicking the link: https://ff.ppacer.org/confirm/%s",
-			hash),
-		o.secrets,
-	)
 
 	msg := fmt.Sprintf("Thank you for registering! Please check your inbox and confirm your email (%s).",
 		email)
+	if spot == SpotWaitlist {
+		msg = fmt.Sprintf("The event is full, so you have been added to the waitlist. "+
+			"Please check your inbox and confirm your email (%s) - we will let you "+
+			"know as soon as a spot becomes available.", email)
+	}
 	p := page{PostRegisterInfo: msg}
-	o.telegram.Send(
-		fmt.Sprintf("[ppacerFF] New user registered: [%s] - %s", user.Email,
-			*user.Nickname),
-	)
-
 	renderErr := o.tmpl.Render(w, "notifications", p)
 	if renderErr != nil {
 		o.logger.Error("Cannot render <index>", "err", renderErr.Error())
 	}
 }
 
-func (o *Owner) ConfirmHandler(w http.ResponseWriter, r *http.Request) {
-	confirmHash := r.PathValue("hash")
-	confirmed := false
-	var email string
-	if confirmHash == "" {
-		o.logger.Error("/confirm/{hash}: Expected hash, but got empty value")
+// ResendConfirmationHandler sends new confirmation link to unconfirmed
+// registration. Response is the same whether or not the address is
+// registered, so it cannot be used to find out who registered.
+func (o *Owner) ResendConfirmationHandler(w http.ResponseWriter, r *http.Request) {
+	event, ok := o.visibleEvent(w, r.PathValue("slug"))
+	if !ok {
 		return
 	}
-	userDb, uErr := UserByHash(o.db, confirmHash)
-	if uErr != nil && uErr != ErrUserNotFound {
-		o.logger.Error("Unexpected error when reading user by hash",
-			"hash", confirmHash, "err", uErr.Error())
-	}
-	if uErr == nil {
-		confirmed = true
-		email = userDb.Email
-		o.logger.Info("User confirmed", "email", userDb.Email, "hash",
-			userDb.Hash)
-		o.telegram.Send(
-			fmt.Sprintf("[ppacerFF] User [%s] confirmed their email",
-				userDb.Email),
-		)
-		iErr := ConfirmUser(o.db, userDb.Email, userDb.Hash)
-		if iErr != nil {
-			o.logger.Error("Error while confirming user", "email",
-				userDb.Email, "hash", userDb.Hash, "err", iErr.Error())
-			o.telegram.Send(
-				fmt.Sprintf("[ppacerFF] Error while confirim user [%s]: %s",
-					userDb.Email, iErr.Error()),
-			)
+	email := strings.TrimSpace(r.FormValue("email"))
+	if userDb, ok := o.canResendConfirmation(event, email); ok {
+		// Response is the same either way, so it doesn't reveal who is
+		// registered.
+		if sErr := o.sendConfirmationRequest(event, userDb.Email); sErr != nil {
+			o.logger.Error("Cannot resend confirmation request", "event",
+				event.Slug, "email", userDb.Email, "err", sErr.Error())
 		}
 	}
+	p := page{
+		PostRegisterInfo: fmt.Sprintf("If [%s] is registered and not yet confirmed, "+
+			"we have sent a new confirmation link. Please check your inbox.", email),
+	}
+	renderErr := o.tmpl.Render(w, "notifications", p)
+	if renderErr != nil {
+		o.logger.Error("Cannot render <notifications>", "err",
+			renderErr.Error())
+	}
+}
 
-	var p page
-	if confirmed {
-		p = page{
-			ShowForm: false,
-			PostRegisterInfo: fmt.Sprintf("Email [%s] has been confirmed. Thank you for registration!",
-				email),
+// canResendConfirmation checks if the registration exists, is not confirmed
+// and hasn't received too many confirmation links recently.
+func (o *Owner) canResendConfirmation(event EventRow, email string) (UserRow, bool) {
+	userDb, uErr := UserByEmail(o.db, event.Slug, email)
+	if uErr != nil {
+		if uErr != ErrUserNotFound {
+			o.logger.Error("Cannot read user for confirmation resend", "event",
+				event.Slug, "email", email, "err", uErr.Error())
 		}
-		sendEmail(
-			email,
-			"ppacer preview: friends&family - confirmation",
-			fmt.Sprintf(`Hello %s!
-
-Your participation in the event has been confirmed.
-Thank you for registering, and I can’t wait to meet you there!
-
-Best regards,
-Damian Skrzypiec
-	`, *userDb.Nickname),
-			o.secrets,
+		return userDb, false
+	}
+	if userDb.Confirmed == 1 {
+		return userDb, false
+	}
+	sent, cErr := CountTokensIssuedSince(o.db, event.Slug, userDb.Email,
+		TokenConfirm, time.Now().Add(-confirmResendWindow))
+	if cErr != nil {
+		o.logger.Error("Cannot count confirmation links", "event", event.Slug,
+			"email", userDb.Email, "err", cErr.Error())
+		return userDb, false
+	}
+	if sent >= confirmResendLimit {
+		o.logger.Warn("Confirmation resend rate limited", "event", event.Slug,
+			"email", userDb.Email, "sent", sent)
+		return userDb, false
+	}
+	return userDb, true
+}
+
+// ConfirmHandler renders page on which registered person confirms their
+// email. Actual confirmation is done by POST request, so link scanners which
+// prefetch URLs cannot confirm anyone. Links sent before events were
+// introduced don't contain event slug and are resolved against the default
+// event.
+func (o *Owner) ConfirmHandler(w http.ResponseWriter, r *http.Request) {
+	slug := r.PathValue("slug")
+	if slug == "" {
+		slug = defaultEventSlug
+	}
+	event, ok := o.visibleEvent(w, slug)
+	if !ok {
+		return
+	}
+	token := r.PathValue("token")
+	p := page{Event: &event}
+	userDb, uErr := UserByToken(o.db, event.Slug, token, TokenConfirm,
+		time.Now())
+	if uErr != nil && uErr != ErrTokenNotFound && uErr != ErrTokenExpired {
+		o.logger.Error("Unexpected error when reading user by token",
+			"event", event.Slug, "err", uErr.Error())
+	}
+	switch {
+	case uErr == ErrTokenExpired:
+		o.logger.Info("Confirmation token expired", "event", event.Slug)
+		p.PostRegisterError = "This confirmation link has expired. Please contact info@dskrzypiec.dev"
+	case uErr != nil:
+		o.logger.Info("Confirmation token not found", "event", event.Slug)
+		p.PostRegisterError = "Something went wrong. Cannot find your registration. Please contact info@dskrzypiec.dev"
+	case userDb.Confirmed == 1:
+		p.PostRegisterInfo = fmt.Sprintf("Email [%s] has already been confirmed. Thank you!",
+			userDb.Email)
+	case r.Method == http.MethodPost:
+		p.PostRegisterInfo, p.PostRegisterError = o.confirmRegistration(event,
+			userDb)
+	default:
+		p.ConfirmUrl = fmt.Sprintf("/events/%s/confirm/%s", event.Slug, token)
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	renderErr := o.tmpl.Render(w, "index", p)
+	if renderErr != nil {
+		o.logger.Error("Cannot render <index>", "err", renderErr.Error())
+	}
+}
+
+// confirmRegistration confirms registration and sends follow-up email. It
+// returns info or error message to be shown. Nothing is sent when the
+// registration has been already confirmed.
+func (o *Owner) confirmRegistration(event EventRow, userDb UserRow) (string, string) {
+	email := userDb.Email
+	iErr := ConfirmUser(o.db, event.Slug, email)
+	if iErr == ErrUserAlreadyConfirmed {
+		return fmt.Sprintf("Email [%s] has already been confirmed. Thank you!",
+			email), ""
+	}
+	if iErr == ErrUserNotFound {
+		return "", "Cannot find your registration. It might have been already cancelled."
+	}
+	if iErr != nil {
+		o.logger.Error("Error while confirming user", "event", event.Slug,
+			"email", email, "err", iErr.Error())
+		o.notifier.Send(
+			fmt.Sprintf("[ppacerFF] Error while confirim user [%s]: %s",
+				email, iErr.Error()),
 		)
+		return "", "Something went wrong. Please contact info@dskrzypiec.dev"
+	}
+	o.logger.Info("User confirmed", "event", event.Slug, "email", email)
+	o.notifier.Send(
+		fmt.Sprintf("[ppacerFF] User [%s] confirmed their email for [%s]",
+			email, event.Slug),
+	)
+
+	if userDb.Spot != SpotWaitlist {
+		o.sendAttendanceConfirmation(event, userDb)
+		return fmt.Sprintf("Email [%s] has been confirmed. Thank you for registration!",
+			email), ""
+	}
+	rank, rErr := WaitlistRank(o.db, userDb)
+	if rErr != nil {
+		o.logger.Error("Cannot read waitlist rank", "event", event.Slug,
+			"email", email, "err", rErr.Error())
+	}
+	// Email isn't sent without cancellation link. Error is already logged by
+	// issueToken.
+	if cancelToken, tErr := o.issueToken(event, email, TokenCancel); tErr == nil {
+		o.queueTemplatedEmail(email, emailWaitlistConfirmation, emailData{
+			Event:        event,
+			Nickname:     userDb.NicknameOrEmpty(),
+			CancelUrl:    cancelUrl(event, cancelToken),
+			WaitlistRank: rank,
+		})
+	}
+	o.promoteFromWaitlist(event)
+	return fmt.Sprintf("Email [%s] has been confirmed. You are number %d on the waitlist.",
+		email, rank), ""
+}
+
+// CancelHandler renders page on which registered person can give up their
+// spot or leave the waitlist. Actual cancellation is done by POST request.
+func (o *Owner) CancelHandler(w http.ResponseWriter, r *http.Request) {
+	event, ok := o.visibleEvent(w, r.PathValue("slug"))
+	if !ok {
+		return
+	}
+	token := r.PathValue("token")
+	p := page{Event: &event}
+	userDb, uErr := UserByToken(o.db, event.Slug, token, TokenCancel,
+		time.Now())
+	if uErr != nil && uErr != ErrTokenNotFound && uErr != ErrTokenExpired {
+		o.logger.Error("Unexpected error when reading user by token", "event",
+			event.Slug, "err", uErr.Error())
+	}
+	if uErr == ErrTokenExpired {
+		p.PostRegisterError = "This cancellation link has expired."
+	} else if uErr != nil {
+		p.PostRegisterError = "Cannot find your registration. It might have been already cancelled."
+	} else if r.Method == http.MethodPost {
+		p.PostRegisterInfo = o.cancelRegistration(event, userDb)
 	} else {
-		o.logger.Info("Hash not found", "email", email, "hash", confirmHash)
-		p = page{
-			PostRegisterError: fmt.Sprintf("Something went wrong. Cannot find hash [%s]. Please contact info@dskrzypiec.dev",
-				confirmHash),
-		}
+		p.CancelUrl = fmt.Sprintf("/events/%s/cancel/%s", event.Slug, token)
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	renderErr := o.tmpl.Render(w, "index", p)
+	if renderErr != nil {
+		o.logger.Error("Cannot render <index>", "err", renderErr.Error())
+	}
+}
+
+func (o *Owner) cancelRegistration(event EventRow, userDb UserRow) string {
+	dErr := DeleteUser(o.db, event.Slug, userDb.Email)
+	if dErr != nil {
+		o.logger.Error("Cannot delete user", "event", event.Slug, "email",
+			userDb.Email, "err", dErr.Error())
+		return "Something went wrong. Please contact info@dskrzypiec.dev"
+	}
+	o.logger.Info("Registration cancelled", "event", event.Slug, "email",
+		userDb.Email, "spot", userDb.Spot)
+	o.notifier.Send(
+		fmt.Sprintf("[ppacerFF] User [%s] cancelled registration for [%s] (%s)",
+			userDb.Email, event.Slug, userDb.Spot),
+	)
+	o.promoteFromWaitlist(event)
+	return "Your registration has been cancelled. Thank you for letting us know!"
+}
+
+// ClaimHandler renders page on which person from the waitlist can claim the
+// spot offered to them. Actual claim is done by POST request.
+func (o *Owner) ClaimHandler(w http.ResponseWriter, r *http.Request) {
+	event, ok := o.visibleEvent(w, r.PathValue("slug"))
+	if !ok {
+		return
+	}
+	token := r.PathValue("token")
+	p := page{Event: &event}
+	userDb, uErr := UserByToken(o.db, event.Slug, token, TokenManage,
+		time.Now())
+	if uErr != nil && uErr != ErrTokenNotFound && uErr != ErrTokenExpired {
+		o.logger.Error("Unexpected error when reading user by token", "event",
+			event.Slug, "err", uErr.Error())
+	}
+	switch {
+	case uErr == ErrTokenExpired:
+		p.PostRegisterError = "This offer has expired and the spot was passed on to the next person on the waitlist."
+	case uErr != nil:
+		p.PostRegisterError = "Cannot find your registration. Please contact info@dskrzypiec.dev"
+	case userDb.Spot == SpotAttendee:
+		p.PostRegisterInfo = "You already have a spot at this event. See you there!"
+	case userDb.Spot != SpotOffered ||
+		!time.Now().Before(FromStringMust(userDb.OfferExpiresTs)):
+		p.PostRegisterError = "This offer has expired and the spot was passed on to the next person on the waitlist."
+	case r.Method == http.MethodPost:
+		p.PostRegisterInfo, p.PostRegisterError = o.claimSpot(event, userDb)
+	default:
+		p.ClaimUrl = fmt.Sprintf("/events/%s/claim/%s", event.Slug, token)
 	}
 	w.Header().Set("Content-Type", "text/html; charset=utf-8")
 	renderErr := o.tmpl.Render(w, "index", p)
@@ -199,6 +510,26 @@ Damian Skrzypiec
 	}
 }
 
+// claimSpot turns offered spot into attendee spot and sends attendance
+// confirmation. It returns info or error message to be shown.
+func (o *Owner) claimSpot(event EventRow, userDb UserRow) (string, string) {
+	claimed, cErr := ChangeUserSpot(o.db, userDb, SpotAttendee, "")
+	if cErr != nil {
+		o.logger.Error("Cannot claim offered spot", "event", event.Slug,
+			"email", userDb.Email, "err", cErr.Error())
+		return "", "Something went wrong. Please contact info@dskrzypiec.dev"
+	}
+	if !claimed {
+		return "", "This offer has expired and the spot was passed on to the next person on the waitlist."
+	}
+	o.notifier.Send(
+		fmt.Sprintf("[ppacerFF] User [%s] claimed spot from waitlist for [%s]",
+			userDb.Email, event.Slug),
+	)
+	o.sendAttendanceConfirmation(event, userDb)
+	return "The spot is yours! See you at the event.", ""
+}
+
 func (o *Owner) PolicyHandler(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "text/html; charset=utf-8")
 	renderErr := o.tmpl.Render(w, "policy", page{})
@@ -206,3 +537,107 @@ func (o *Owner) PolicyHandler(w http.ResponseWriter, r *http.Request) {
 		o.logger.Error("Cannot render <policy>", "err", renderErr.Error())
 	}
 }
+
+// sendConfirmationRequest queues email with link which confirms registration.
+// New confirmation token is issued for every request.
+func (o *Owner) sendConfirmationRequest(event EventRow, email string) error {
+	token, tErr := o.issueToken(event, email, TokenConfirm)
+	if tErr != nil {
+		return tErr
+	}
+	return o.queueTemplatedEmail(email, emailConfirmationRequest, emailData{
+		Event: event,
+		ConfirmUrl: fmt.Sprintf("%s/events/%s/confirm/%s", appBaseUrl,
+			event.Slug, token),
+	})
+}
+
+// sendAttendanceConfirmation queues email confirming the spot at the event
+// together with calendar invite. Nothing is queued when links for the email
+// cannot be issued. Organizers are notified about failures, because errors
+// are already logged by issueToken and queueEmail.
+func (o *Owner) sendAttendanceConfirmation(event EventRow, user UserRow) {
+	sErr := o.queueAttendanceConfirmation(event, user)
+	if sErr != nil {
+		o.notifier.Send(
+			fmt.Sprintf("[ppacerFF] Cannot send attendance confirmation to [%s] for [%s]: %s",
+				user.Email, event.Slug, sErr.Error()),
+		)
+	}
+}
+
+func (o *Owner) queueAttendanceConfirmation(event EventRow, user UserRow) error {
+	calendarToken, mErr := o.issueCalendarToken(user.Email)
+	if mErr != nil {
+		return mErr
+	}
+	cancelToken, cErr := o.issueToken(event, user.Email, TokenCancel)
+	if cErr != nil {
+		return cErr
+	}
+	invite := EventInvite(event, user, CurrentTz(), time.Now())
+	return o.queueTemplatedEmail(user.Email, emailAttendanceConfirmation,
+		emailData{
+			Event:       event,
+			Nickname:    user.NicknameOrEmpty(),
+			CalendarUrl: attendeeCalendarUrl(calendarToken),
+			CancelUrl:   cancelUrl(event, cancelToken),
+		},
+		emailAttachment{
+			FileName:    icsInviteFileName,
+			ContentType: icsInviteContentType,
+			Data:        invite,
+		},
+	)
+}
+
+// sendEventUpdate queues updated calendar invite to all confirmed attendees
+// of the event. Invites share UID with the original ones and have higher
+// sequence, so calendar entries are moved instead of duplicated.
+func (o *Owner) sendEventUpdate(event EventRow) error {
+	yes := true
+	filter := UserFilter{EventSlug: event.Slug, Confirmed: &yes}
+	now := time.Now()
+	return ForEachUser(o.db, filter, func(user UserRow) error {
+		if user.Spot != SpotAttendee {
+			return nil
+		}
+		cancelToken, tErr := o.issueToken(event, user.Email, TokenCancel)
+		if tErr != nil {
+			return tErr
+		}
+		return o.queueTemplatedEmail(user.Email, emailEventUpdate,
+			emailData{
+				Event:     event,
+				Nickname:  user.NicknameOrEmpty(),
+				CancelUrl: cancelUrl(event, cancelToken),
+			},
+			emailAttachment{
+				FileName:    icsInviteFileName,
+				ContentType: icsInviteContentType,
+				Data:        EventInvite(event, user, CurrentTz(), now),
+			},
+		)
+	})
+}
+
+// cancelUrl returns link to the page where registration can be cancelled.
+func cancelUrl(event EventRow, token string) string {
+	return fmt.Sprintf("%s/events/%s/cancel/%s", appBaseUrl, event.Slug, token)
+}
+
+// visibleEvent reads event by slug. When event doesn't exist or is not
+// publicly visible, 404 response is written and false is returned.
+func (o *Owner) visibleEvent(w http.ResponseWriter, slug string) (EventRow, bool) {
+	event, eErr := EventBySlug(o.db, slug)
+	if eErr != nil && eErr != ErrEventNotFound {
+		o.logger.Error("Cannot read event", "slug", slug, "err", eErr.Error())
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return EventRow{}, false
+	}
+	if eErr == ErrEventNotFound || !event.IsVisible() {
+		http.Error(w, "Event not found", http.StatusNotFound)
+		return EventRow{}, false
+	}
+	return event, true
+}
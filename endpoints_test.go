@@ -0,0 +1,174 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestConfirmHandlerTwoStep(t *testing.T) {
+	db := newTestDb(t)
+	user := User{EventSlug: defaultEventSlug, Email: "ala@x.com",
+		Spot: SpotAttendee}
+	if iErr := InsertNewUser(db, user); iErr != nil {
+		t.Fatalf("Cannot insert user: %s", iErr.Error())
+	}
+	emails, eErr := newEmailTemplates("")
+	if eErr != nil {
+		t.Fatalf("Cannot parse email templates: %s", eErr.Error())
+	}
+	notifier := &fakeNotifier{}
+	o := &Owner{db: db, logger: defaultLogger(), tmpl: newTemplates(),
+		emails: emails, notifier: notifier}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /events/{slug}/confirm/{token}", o.ConfirmHandler)
+	mux.HandleFunc("POST /events/{slug}/confirm/{token}", o.ConfirmHandler)
+	do := func(method, token string) string {
+		w := httptest.NewRecorder()
+		path := "/events/" + defaultEventSlug + "/confirm/" + token
+		mux.ServeHTTP(w, httptest.NewRequest(method, path, nil))
+		return w.Body.String()
+	}
+	token, _ := IssueToken(db, defaultEventSlug, user.Email, TokenConfirm,
+		time.Now().Add(time.Hour))
+
+	// Prefetching the link doesn't confirm anything.
+	if body := do(http.MethodGet, token); !strings.Contains(body, "Confirm my spot") {
+		t.Errorf("Expected confirmation button, got:\n%s", body)
+	}
+	if u, _ := UserByEmail(db, defaultEventSlug, user.Email); u.Confirmed != 0 {
+		t.Fatal("Expected user not to be confirmed by GET request")
+	}
+
+	if body := do(http.MethodPost, token); !strings.Contains(body, "has been confirmed") {
+		t.Errorf("Expected confirmation, got:\n%s", body)
+	}
+	pending, _ := OutboxMessagesByStatus(db, OutboxPending)
+	if len(pending) != 1 || len(notifier.messages) != 1 {
+		t.Fatalf("Expected single email and notification, got %d and %d",
+			len(pending), len(notifier.messages))
+	}
+	// Transactional emails have no mailing list to unsubscribe from.
+	if pending[0].ListUnsubscribe != "" {
+		t.Errorf("Expected no List-Unsubscribe, got %q",
+			pending[0].ListUnsubscribe)
+	}
+
+	// Repeat visits don't send anything.
+	for _, method := range []string{http.MethodGet, http.MethodPost} {
+		if body := do(method, token); !strings.Contains(body, "already been confirmed") {
+			t.Errorf("Expected already confirmed info for %s, got:\n%s", method,
+				body)
+		}
+	}
+	pending, _ = OutboxMessagesByStatus(db, OutboxPending)
+	if len(pending) != 1 || len(notifier.messages) != 1 {
+		t.Errorf("Expected nothing sent on repeat visits, got %d emails and %d notifications",
+			len(pending), len(notifier.messages))
+	}
+
+	expired, _ := IssueToken(db, defaultEventSlug, user.Email, TokenConfirm,
+		time.Now().Add(-time.Hour))
+	if body := do(http.MethodGet, expired); !strings.Contains(body, "expired") ||
+		strings.Contains(body, expired) {
+		t.Errorf("Expected expired link message without the token, got:\n%s",
+			body)
+	}
+	if body := do(http.MethodGet, "unknown-token"); strings.Contains(body, "unknown-token") {
+		t.Errorf("Expected unknown token not to be echoed, got:\n%s", body)
+	}
+}
+
+func TestResendConfirmation(t *testing.T) {
+	db := newTestDb(t)
+	users := []User{
+		{EventSlug: defaultEventSlug, Email: "new@x.com", Spot: SpotAttendee},
+		{EventSlug: defaultEventSlug, Email: "done@x.com", Spot: SpotAttendee,
+			Confirmed: true},
+	}
+	for _, u := range users {
+		if iErr := InsertNewUser(db, u); iErr != nil {
+			t.Fatalf("Cannot insert user: %s", iErr.Error())
+		}
+	}
+	emails, _ := newEmailTemplates("")
+	o := &Owner{db: db, logger: defaultLogger(), tmpl: newTemplates(),
+		emails: emails}
+	resend := func(email string) string {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodPost,
+			"/events/"+defaultEventSlug+"/resend",
+			strings.NewReader("email="+email))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		r.SetPathValue("slug", defaultEventSlug)
+		o.ResendConfirmationHandler(w, r)
+		return strings.ReplaceAll(w.Body.String(), email, "")
+	}
+
+	expected := resend("new@x.com")
+	for _, email := range []string{"done@x.com", "nobody@x.com"} {
+		if body := resend(email); body != expected {
+			t.Errorf("Expected the same response for %s, got:\n%s", email, body)
+		}
+	}
+	for i := 0; i < confirmResendLimit; i++ {
+		resend("new@x.com")
+	}
+	pending, _ := OutboxMessagesByStatus(db, OutboxPending)
+	if len(pending) != confirmResendLimit {
+		t.Fatalf("Expected %d emails, got %d", confirmResendLimit, len(pending))
+	}
+	for _, msg := range pending {
+		if msg.To != "new@x.com" {
+			t.Errorf("Unexpected email to %s", msg.To)
+		}
+	}
+}
+
+func TestClaimHandlerTwoStep(t *testing.T) {
+	db := newTestDb(t)
+	expires := time.Now().Add(time.Hour)
+	user := User{EventSlug: defaultEventSlug, Email: "ala@x.com",
+		Confirmed: true, Spot: SpotWaitlist, WaitlistPos: 1}
+	if iErr := InsertNewUser(db, user); iErr != nil {
+		t.Fatalf("Cannot insert user: %s", iErr.Error())
+	}
+	event := defaultEvent()
+	event.Capacity = 1
+	if _, oErr := OfferNextSpot(db, event, expires); oErr != nil {
+		t.Fatalf("Cannot offer spot: %s", oErr.Error())
+	}
+	emails, eErr := newEmailTemplates("")
+	if eErr != nil {
+		t.Fatalf("Cannot parse email templates: %s", eErr.Error())
+	}
+	o := &Owner{db: db, logger: defaultLogger(), tmpl: newTemplates(),
+		emails: emails, notifier: &fakeNotifier{}}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /events/{slug}/claim/{token}", o.ClaimHandler)
+	mux.HandleFunc("POST /events/{slug}/claim/{token}", o.ClaimHandler)
+	token, _ := IssueToken(db, defaultEventSlug, user.Email, TokenManage,
+		expires)
+	do := func(method string) string {
+		w := httptest.NewRecorder()
+		path := "/events/" + defaultEventSlug + "/claim/" + token
+		mux.ServeHTTP(w, httptest.NewRequest(method, path, nil))
+		return w.Body.String()
+	}
+
+	if body := do(http.MethodGet); !strings.Contains(body, "Claim my spot") {
+		t.Errorf("Expected claim button, got:\n%s", body)
+	}
+	if u, _ := UserByEmail(db, defaultEventSlug, user.Email); u.Spot != SpotOffered {
+		t.Fatalf("Expected spot not to be claimed by GET request, got %s",
+			u.Spot)
+	}
+	if body := do(http.MethodPost); !strings.Contains(body, "The spot is yours") {
+		t.Errorf("Expected claimed spot, got:\n%s", body)
+	}
+	if u, _ := UserByEmail(db, defaultEventSlug, user.Email); u.Spot != SpotAttendee {
+		t.Errorf("Expected spot to be claimed by POST request, got %s", u.Spot)
+	}
+}
@@ -0,0 +1,345 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"html/template"
+	"time"
+)
+
+const (
+	// Slug of the very first event. Registrations made before events were
+	// introduced belong to this event and old confirmation links without
+	// event slug are resolved against it.
+	defaultEventSlug = "ff-preview-2024"
+
+	// Timezone in which events take place. Event times on the UI, in the CLI
+	// and in calendar invites are presented in this timezone.
+	eventsTimezone = "Europe/Warsaw"
+
+	EventStatusDraft     = "draft"
+	EventStatusPublished = "published"
+	EventStatusArchived  = "archived"
+)
+
+var (
+	ErrEventNotFound = errors.New("event not found in database")
+)
+
+type EventRow struct {
+	Slug        string
+	Title       string
+	StartTs     string
+	EndTs       string
+	Venue       string
+	Description string
+	Status      string
+	Capacity    int
+
+	// Sequence is incremented whenever event date or venue changes, so
+	// calendar clients update already imported entries.
+	Sequence int
+}
+
+// Start returns parsed event start timestamp.
+func (e EventRow) Start() time.Time {
+	return FromStringMust(e.StartTs)
+}
+
+// End returns parsed event end timestamp.
+func (e EventRow) End() time.Time {
+	return FromStringMust(e.EndTs)
+}
+
+// IsOpen returns true when the event is published and has not started yet,
+// so new registrations are accepted.
+func (e EventRow) IsOpen() bool {
+	return e.Status == EventStatusPublished && Now().Before(e.Start())
+}
+
+// IsVisible returns true for events which can be browsed publicly. Drafts are
+// hidden.
+func (e EventRow) IsVisible() bool {
+	return e.Status == EventStatusPublished || e.Status == EventStatusArchived
+}
+
+// DateUI returns event date in human-friendly format in the current timezone.
+func (e EventRow) DateUI() string {
+	return e.Start().In(CurrentTz()).Format("Monday, 2 January 2006")
+}
+
+// TimeUI returns event start and end time in the current timezone.
+func (e EventRow) TimeUI() string {
+	const hourFmt = "15:04"
+	return fmt.Sprintf("%s - %s", e.Start().In(CurrentTz()).Format(hourFmt),
+		e.End().In(CurrentTz()).Format(hourFmt))
+}
+
+// HasCapacityLimit returns true when number of attendees is limited.
+// Capacity equal to zero means unlimited.
+func (e EventRow) HasCapacityLimit() bool {
+	return e.Capacity > 0
+}
+
+// DescriptionHTML returns event description as HTML. Descriptions are written
+// by organizers, hence they are trusted.
+func (e EventRow) DescriptionHTML() template.HTML {
+	return template.HTML(e.Description)
+}
+
+func EventBySlug(db *SqliteDB, slug string) (EventRow, error) {
+	row := db.QueryRow(readEventBySlugQuery(), slug)
+	event, scanErr := parseEventRow(row)
+	if scanErr == sql.ErrNoRows {
+		return EventRow{}, ErrEventNotFound
+	}
+	if scanErr != nil {
+		return EventRow{}, fmt.Errorf("cannot read event %s: %w", slug,
+			scanErr)
+	}
+	return event, nil
+}
+
+// ListEvents returns all events ordered by start timestamp descending.
+func ListEvents(db *SqliteDB) ([]EventRow, error) {
+	rows, qErr := db.Query(readEventsQuery())
+	if qErr != nil {
+		return nil, fmt.Errorf("cannot query events: %w", qErr)
+	}
+	defer rows.Close()
+	events := make([]EventRow, 0)
+	for rows.Next() {
+		event, scanErr := parseEventRow(rows)
+		if scanErr != nil {
+			return nil, fmt.Errorf("error while scanning eventRow: %w",
+				scanErr)
+		}
+		events = append(events, event)
+	}
+	return events, rows.Err()
+}
+
+// AttendeeEvents returns visible events for which the person using given
+// email has a spot. Emails are compared by EmailKey.
+func AttendeeEvents(db *SqliteDB, email string) ([]EventRow, error) {
+	rows, qErr := db.Query(readAttendeeEventsQuery(), EmailKey(email))
+	if qErr != nil {
+		return nil, fmt.Errorf("cannot query attendee events: %w", qErr)
+	}
+	defer rows.Close()
+	events := make([]EventRow, 0)
+	for rows.Next() {
+		event, scanErr := parseEventRow(rows)
+		if scanErr != nil {
+			return nil, fmt.Errorf("error while scanning eventRow: %w",
+				scanErr)
+		}
+		events = append(events, event)
+	}
+	return events, rows.Err()
+}
+
+func InsertEvent(db *SqliteDB, event EventRow) error {
+	_, iErr := db.Exec(
+		insertEventQuery(),
+		event.Slug, event.Title, event.StartTs, event.EndTs, event.Venue,
+		event.Description, event.Status, event.Capacity,
+	)
+	return iErr
+}
+
+func UpdateEventStatus(db *SqliteDB, slug, status string) error {
+	res, uErr := db.Exec(updateEventStatusQuery(), status, slug)
+	if uErr != nil {
+		return uErr
+	}
+	rows, rErr := res.RowsAffected()
+	if rErr != nil {
+		return fmt.Errorf("cannot get number of rows affected: %w", rErr)
+	}
+	if rows == 0 {
+		return ErrEventNotFound
+	}
+	return nil
+}
+
+// UpdateEventSchedule changes event time and venue and increments its
+// sequence number.
+func UpdateEventSchedule(db *SqliteDB, slug string, start, end time.Time, venue string) error {
+	res, uErr := db.Exec(updateEventScheduleQuery(), ToString(start),
+		ToString(end), venue, slug)
+	if uErr != nil {
+		return uErr
+	}
+	rows, rErr := res.RowsAffected()
+	if rErr != nil {
+		return fmt.Errorf("cannot get number of rows affected: %w", rErr)
+	}
+	if rows == 0 {
+		return ErrEventNotFound
+	}
+	return nil
+}
+
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+func parseEventRow(row rowScanner) (EventRow, error) {
+	var e EventRow
+	scanErr := row.Scan(&e.Slug, &e.Title, &e.StartTs, &e.EndTs, &e.Venue,
+		&e.Description, &e.Status, &e.Capacity, &e.Sequence)
+	return e, scanErr
+}
+
+func isValidEventStatus(status string) bool {
+	return status == EventStatusDraft || status == EventStatusPublished ||
+		status == EventStatusArchived
+}
+
+func readEventBySlugQuery() string {
+	return `
+	SELECT
+		Slug,
+		Title,
+		StartTs,
+		EndTs,
+		Venue,
+		Description,
+		Status,
+		Capacity,
+		Sequence
+	FROM
+		events
+	WHERE
+		Slug = ?
+`
+}
+
+func readEventsQuery() string {
+	return `
+	SELECT
+		Slug,
+		Title,
+		StartTs,
+		EndTs,
+		Venue,
+		Description,
+		Status,
+		Capacity,
+		Sequence
+	FROM
+		events
+	ORDER BY
+		StartTs DESC
+`
+}
+
+func readAttendeeEventsQuery() string {
+	return `
+	SELECT
+		e.Slug,
+		e.Title,
+		e.StartTs,
+		e.EndTs,
+		e.Venue,
+		e.Description,
+		e.Status,
+		e.Capacity,
+		e.Sequence
+	FROM
+		events e
+	INNER JOIN
+		users u ON u.EventSlug = e.Slug
+	WHERE
+			u.EmailKey = ?
+		AND u.Spot = 'attendee'
+		AND e.Status IN ('published', 'archived')
+	ORDER BY
+		e.StartTs DESC
+`
+}
+
+func insertEventQuery() string {
+	return `
+	INSERT INTO events(Slug, Title, StartTs, EndTs, Venue, Description, Status, Capacity)
+	VALUES (?,?,?,?,?,?,?,?)
+	`
+}
+
+func updateEventStatusQuery() string {
+	return `
+	UPDATE
+		events
+	SET
+		Status = ?
+	WHERE
+		Slug = ?
+`
+}
+
+func updateEventScheduleQuery() string {
+	return `
+	UPDATE
+		events
+	SET
+		StartTs = ?,
+		EndTs = ?,
+		Venue = ?,
+		Sequence = Sequence + 1
+	WHERE
+		Slug = ?
+`
+}
+
+func sqliteCreateEventsTable() string {
+	return `
+		CREATE TABLE IF NOT EXISTS events (
+			Slug        TEXT NOT NULL,
+			Title       TEXT NOT NULL,
+			StartTs     TEXT NOT NULL,
+			EndTs       TEXT NOT NULL,
+			Venue       TEXT NOT NULL,
+			Description TEXT NOT NULL,
+			Status      TEXT NOT NULL,
+			Capacity    INT NOT NULL DEFAULT 0,
+			Sequence    INT NOT NULL DEFAULT 0,
+
+			PRIMARY KEY (Slug)
+		);
+`
+}
+
+// defaultEvent returns the first ppacer friends&family preview. It's inserted
+// into every database, so registrations from before events existed keep
+// pointing at a real event.
+func defaultEvent() EventRow {
+	warsaw, locErr := time.LoadLocation(eventsTimezone)
+	if locErr != nil {
+		warsaw = time.Local
+	}
+	start := time.Date(2024, time.October, 23, 17, 0, 0, 0, warsaw)
+	return EventRow{
+		Slug:    defaultEventSlug,
+		Title:   "ppacer preview: friends&family",
+		StartTs: ToString(start),
+		EndTs:   ToString(start.Add(2 * time.Hour)),
+		Venue:   "On-site in Warsaw",
+		Status:  EventStatusPublished,
+		Description: `<p class="text-lg mb-4">
+    I am thrilled to invite you to the first exclusive preview of
+    <span class="text-customOrange"><a href="https://ppacer.org">ppacer</a></span>,
+    a new DAG scheduler built in Go that I've been passionately working on for
+    the past 13 months. This special event is for friends and family, and I'd
+    love to show you what I've created.
+</p>
+<p class="text-xl font-bold mb-4">What to Expect:</p>
+<ul class="list-disc list-inside text-lg px-8 mb-8">
+    <li>An introduction to what ppacer is and why I decided to build it</li>
+    <li>A live demo showcasing its capabilities</li>
+    <li>High-level plans for the road to version 1.0</li>
+    <li>Drinks and casual conversation at a nearby spot afterwards</li>
+</ul>`,
+	}
+}
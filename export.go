@@ -0,0 +1,286 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	ExportCSV   = "csv"
+	ExportJSONL = "jsonl"
+	ExportXLSX  = "xlsx"
+
+	exportTimeFormat = "2006-01-02 15:04:05"
+)
+
+// exportColumn describes single column of registrations export. Value returns
+// string, bool or int, so JSON Lines keep proper types.
+type exportColumn struct {
+	Name  string
+	Value func(u UserRow, loc *time.Location) any
+}
+
+var exportColumns = []exportColumn{
+	{"event", func(u UserRow, _ *time.Location) any { return u.EventSlug }},
+	{"email", func(u UserRow, _ *time.Location) any { return u.Email }},
+	{"nickname", func(u UserRow, _ *time.Location) any { return u.NicknameOrEmpty() }},
+	{"registered_at", func(u UserRow, loc *time.Location) any {
+		return exportTime(u.RegistrationTs, loc)
+	}},
+	{"drinks", func(u UserRow, _ *time.Location) any { return u.Drinks == 1 }},
+	{"confirmed", func(u UserRow, _ *time.Location) any { return u.Confirmed == 1 }},
+	{"confirmed_at", func(u UserRow, loc *time.Location) any {
+		return exportTime(u.ConfirmationTs, loc)
+	}},
+	{"spot", func(u UserRow, _ *time.Location) any { return u.Spot }},
+	{"waitlist_pos", func(u UserRow, _ *time.Location) any { return u.WaitlistPos }},
+}
+
+// ExportOptions configures registrations export.
+type ExportOptions struct {
+	Format   string
+	Columns  []string
+	Filter   UserFilter
+	Location *time.Location
+}
+
+// ExportUsers streams registrations matching the filter into given writer in
+// requested format. Empty list of columns means all columns.
+func ExportUsers(w io.Writer, db *SqliteDB, opts ExportOptions) error {
+	columns, cErr := selectExportColumns(opts.Columns)
+	if cErr != nil {
+		return cErr
+	}
+	loc := opts.Location
+	if loc == nil {
+		loc = CurrentTz()
+	}
+	header := make([]any, len(columns))
+	for idx, col := range columns {
+		header[idx] = col.Name
+	}
+	values := func(u UserRow) []any {
+		vals := make([]any, len(columns))
+		for idx, col := range columns {
+			vals[idx] = col.Value(u, loc)
+		}
+		return vals
+	}
+
+	switch opts.Format {
+	case ExportCSV:
+		cw := csv.NewWriter(w)
+		cw.Write(csvRecord(header))
+		fErr := ForEachUser(db, opts.Filter, func(u UserRow) error {
+			return cw.Write(csvRecord(values(u)))
+		})
+		cw.Flush()
+		if fErr != nil {
+			return fErr
+		}
+		return cw.Error()
+	case ExportJSONL:
+		return ForEachUser(db, opts.Filter, func(u UserRow) error {
+			line, jErr := jsonlRecord(header, values(u))
+			if jErr != nil {
+				return jErr
+			}
+			_, wErr := w.Write(line)
+			return wErr
+		})
+	case ExportXLSX:
+		xw, xErr := newXlsxWriter(w, "Registrations")
+		if xErr != nil {
+			return xErr
+		}
+		if wErr := xw.Write(header); wErr != nil {
+			return wErr
+		}
+		fErr := ForEachUser(db, opts.Filter, func(u UserRow) error {
+			return xw.Write(xlsxRecord(values(u)))
+		})
+		if fErr != nil {
+			return fErr
+		}
+		return xw.Close()
+	}
+	return fmt.Errorf("unsupported export format %q", opts.Format)
+}
+
+// jsonlRecord encodes single JSON Lines object. Keys are written in the order
+// of selected columns, which encoding a map wouldn't preserve.
+func jsonlRecord(keys, vals []any) ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for idx := range keys {
+		if idx > 0 {
+			buf.WriteByte(',')
+		}
+		key, kErr := json.Marshal(keys[idx])
+		if kErr != nil {
+			return nil, kErr
+		}
+		val, vErr := json.Marshal(vals[idx])
+		if vErr != nil {
+			return nil, vErr
+		}
+		buf.Write(key)
+		buf.WriteByte(':')
+		buf.Write(val)
+	}
+	buf.WriteString("}\n")
+	return buf.Bytes(), nil
+}
+
+// ExportHandler streams registrations as file download. It accepts the same
+// filters as admin registrations table and additionally format, columns
+// (comma-separated) and tz.
+func (o *Owner) ExportHandler(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	filter, fErr := adminFilterFromQuery(q).userFilter()
+	if fErr != nil {
+		http.Error(w, fErr.Error(), http.StatusBadRequest)
+		return
+	}
+	opts, oErr := parseExportOptions(q.Get("format"), q.Get("columns"),
+		q.Get("tz"))
+	if oErr != nil {
+		http.Error(w, oErr.Error(), http.StatusBadRequest)
+		return
+	}
+	opts.Filter = filter
+
+	admin, _ := AdminFromContext(r.Context())
+	o.logger.Warn("Registrations exported", "admin", admin.Username,
+		"format", opts.Format, "filter", filter)
+	fileName := fmt.Sprintf("registrations-%s.%s",
+		time.Now().Format("20060102-150405"), opts.Format)
+	w.Header().Set("Content-Type", exportContentType(opts.Format))
+	w.Header().Set("Content-Disposition",
+		fmt.Sprintf("attachment; filename=%q", fileName))
+	if eErr := ExportUsers(w, o.db, opts); eErr != nil {
+		// Part of the response might have been already sent, so we can only
+		// log the error.
+		o.logger.Error("Cannot export registrations", "err", eErr.Error())
+	}
+}
+
+func parseExportOptions(format, columns, tz string) (ExportOptions, error) {
+	opts := ExportOptions{Format: format, Location: CurrentTz()}
+	if opts.Format == "" {
+		opts.Format = ExportCSV
+	}
+	if exportContentType(opts.Format) == "" {
+		return opts, fmt.Errorf("unsupported export format %q, expected csv, jsonl or xlsx",
+			format)
+	}
+	if columns != "" {
+		opts.Columns = strings.Split(columns, ",")
+		if _, cErr := selectExportColumns(opts.Columns); cErr != nil {
+			return opts, cErr
+		}
+	}
+	if tz != "" {
+		loc, lErr := time.LoadLocation(tz)
+		if lErr != nil {
+			return opts, fmt.Errorf("incorrect timezone %q", tz)
+		}
+		opts.Location = loc
+	}
+	return opts, nil
+}
+
+func selectExportColumns(names []string) ([]exportColumn, error) {
+	if len(names) == 0 {
+		return exportColumns, nil
+	}
+	columns := make([]exportColumn, 0, len(names))
+	for _, name := range names {
+		name = strings.TrimSpace(name)
+		found := false
+		for _, col := range exportColumns {
+			if col.Name == name {
+				columns = append(columns, col)
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("unknown export column %q, available columns: %s",
+				name, strings.Join(exportColumnNames(), ","))
+		}
+	}
+	return columns, nil
+}
+
+func exportColumnNames() []string {
+	names := make([]string, len(exportColumns))
+	for idx, col := range exportColumns {
+		names[idx] = col.Name
+	}
+	return names
+}
+
+func exportContentType(format string) string {
+	switch format {
+	case ExportCSV:
+		return "text/csv; charset=utf-8"
+	case ExportJSONL:
+		return "application/x-ndjson"
+	case ExportXLSX:
+		return "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"
+	}
+	return ""
+}
+
+// exportTime converts timestamp from the database format into given timezone.
+// Empty string is returned for timestamps which were never set.
+func exportTime(ts string, loc *time.Location) string {
+	t, pErr := FromString(ts)
+	if pErr != nil || t.IsZero() || t.Year() <= 1 {
+		return ""
+	}
+	return t.In(loc).Format(exportTimeFormat)
+}
+
+// csvRecord formats values for CSV. Text starting with characters which
+// spreadsheets interpret as formula is prefixed with apostrophe.
+func csvRecord(values []any) []string {
+	record := make([]string, len(values))
+	for idx, v := range values {
+		switch val := v.(type) {
+		case bool:
+			record[idx] = yesNo(val)
+		case string:
+			if val != "" && strings.ContainsRune("=+-@\t\r", rune(val[0])) {
+				val = "'" + val
+			}
+			record[idx] = val
+		default:
+			record[idx] = fmt.Sprint(val)
+		}
+	}
+	return record
+}
+
+func xlsxRecord(values []any) []any {
+	for idx, v := range values {
+		if b, ok := v.(bool); ok {
+			values[idx] = yesNo(b)
+		}
+	}
+	return values
+}
+
+func yesNo(b bool) string {
+	if b {
+		return "yes"
+	}
+	return "no"
+}
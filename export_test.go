@@ -0,0 +1,117 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestExportUsers(t *testing.T) {
+	db := newTestDb(t)
+	nick := "=HYPERLINK()"
+	regTs := time.Date(2024, time.October, 1, 10, 0, 0, 0, time.UTC)
+	users := []User{
+		{Email: "ala@x.com", Nickname: &nick, Drinks: true, Confirmed: true},
+		{Email: "bob@x.com"},
+	}
+	for _, u := range users {
+		u.EventSlug = defaultEventSlug
+		u.RegistrationTs = regTs
+		u.Spot = SpotAttendee
+		if iErr := InsertNewUser(db, u); iErr != nil {
+			t.Fatalf("Cannot insert user: %s", iErr.Error())
+		}
+	}
+	warsaw, _ := time.LoadLocation("Europe/Warsaw")
+	yes := true
+
+	var csvOut bytes.Buffer
+	eErr := ExportUsers(&csvOut, db, ExportOptions{
+		Format:   ExportCSV,
+		Columns:  []string{"email", "nickname", "registered_at", "confirmed_at"},
+		Location: warsaw,
+	})
+	if eErr != nil {
+		t.Fatalf("Cannot export CSV: %s", eErr.Error())
+	}
+	expected := "email,nickname,registered_at,confirmed_at\n" +
+		"ala@x.com,'=HYPERLINK(),2024-10-01 12:00:00,\n" +
+		"bob@x.com,,2024-10-01 12:00:00,\n"
+	if csvOut.String() != expected {
+		t.Errorf("Unexpected CSV export:\n%s", csvOut.String())
+	}
+
+	var jsonOut bytes.Buffer
+	eErr = ExportUsers(&jsonOut, db, ExportOptions{
+		Format: ExportJSONL,
+		Filter: UserFilter{Drinks: &yes},
+	})
+	if eErr != nil {
+		t.Fatalf("Cannot export JSON Lines: %s", eErr.Error())
+	}
+	lines := strings.Split(strings.TrimSpace(jsonOut.String()), "\n")
+	if len(lines) != 1 {
+		t.Fatalf("Expected single JSON line for drinks filter, got %d",
+			len(lines))
+	}
+	var obj map[string]any
+	if jErr := json.Unmarshal([]byte(lines[0]), &obj); jErr != nil {
+		t.Fatalf("Cannot parse JSON line: %s", jErr.Error())
+	}
+	if obj["confirmed"] != true || obj["nickname"] != nick {
+		t.Errorf("Unexpected JSON line: %s", lines[0])
+	}
+
+	jsonOut.Reset()
+	eErr = ExportUsers(&jsonOut, db, ExportOptions{
+		Format:  ExportJSONL,
+		Columns: []string{"spot", "email", "confirmed"},
+		Filter:  UserFilter{Drinks: &yes},
+	})
+	if eErr != nil {
+		t.Fatalf("Cannot export JSON Lines: %s", eErr.Error())
+	}
+	if line := strings.TrimSpace(jsonOut.String()); !strings.HasPrefix(line,
+		`{"spot":`) || strings.Index(line, `"email"`) > strings.Index(line,
+		`"confirmed"`) {
+		t.Errorf("Expected keys in selected column order, got: %s", line)
+	}
+
+	var xlsxOut bytes.Buffer
+	eErr = ExportUsers(&xlsxOut, db, ExportOptions{Format: ExportXLSX})
+	if eErr != nil {
+		t.Fatalf("Cannot export XLSX: %s", eErr.Error())
+	}
+	zr, zErr := zip.NewReader(bytes.NewReader(xlsxOut.Bytes()),
+		int64(xlsxOut.Len()))
+	if zErr != nil {
+		t.Fatalf("XLSX export is not a valid zip: %s", zErr.Error())
+	}
+	for _, f := range zr.File {
+		if f.Name != "xl/worksheets/sheet1.xml" {
+			continue
+		}
+		rc, _ := f.Open()
+		sheet, _ := io.ReadAll(rc)
+		rc.Close()
+		if !strings.Contains(string(sheet), "bob@x.com") {
+			t.Errorf("Expected bob@x.com in XLSX sheet, got: %s", sheet)
+		}
+		return
+	}
+	t.Error("XLSX export has no sheet")
+}
+
+func TestXlsxColumnName(t *testing.T) {
+	data := map[int]string{0: "A", 25: "Z", 26: "AA", 27: "AB", 701: "ZZ",
+		702: "AAA"}
+	for idx, expected := range data {
+		if name := xlsxColumnName(idx); name != expected {
+			t.Errorf("Expected column %s for %d, got %s", expected, idx, name)
+		}
+	}
+}
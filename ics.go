@@ -0,0 +1,224 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	icsProdId         = "-//ppacer//ppacerFF//EN"
+	icsLocalFormat    = "20060102T150405"
+	icsUtcFormat      = "20060102T150405Z"
+	icsMaxLineOctets  = 75
+	icsInviteFileName = "invite.ics"
+
+	// Content type of calendar invite. Method has to match METHOD property
+	// of the calendar.
+	icsInviteContentType = `text/calendar; charset="UTF-8"; method=REQUEST`
+)
+
+// icsWriter builds iCalendar (RFC 5545) content. Lines are terminated by
+// CRLF and folded after 75 octets.
+type icsWriter struct {
+	b strings.Builder
+}
+
+func (w *icsWriter) line(name, value string) {
+	content := name + ":" + value
+	// Continuation lines start with a space, which counts towards the limit.
+	limit := icsMaxLineOctets
+	for len(content) > limit {
+		cut := limit
+		for cut > 0 && !utf8.RuneStart(content[cut]) {
+			cut--
+		}
+		w.b.WriteString(content[:cut])
+		w.b.WriteString("\r\n ")
+		content = content[cut:]
+		limit = icsMaxLineOctets - 1
+	}
+	w.b.WriteString(content)
+	w.b.WriteString("\r\n")
+}
+
+func (w *icsWriter) String() string {
+	return w.b.String()
+}
+
+// EventInvite returns calendar invite for given attendee. UID of the event is
+// stable, so an invite sent after event was rescheduled (with higher
+// sequence) updates the existing calendar entry.
+func EventInvite(event EventRow, attendee UserRow, loc *time.Location, now time.Time) []byte {
+	var w icsWriter
+	w.line("BEGIN", "VCALENDAR")
+	w.line("VERSION", "2.0")
+	w.line("PRODID", icsProdId)
+	w.line("CALSCALE", "GREGORIAN")
+	w.line("METHOD", "REQUEST")
+	writeIcsTimezone(&w, loc, event.Start(), event.End())
+	writeIcsEvent(&w, event, loc, now, &attendee)
+	w.line("END", "VCALENDAR")
+	return []byte(w.String())
+}
+
+// writeIcsEvent writes VEVENT component. When attendee is given, the organizer
+// and the attendee are included, as required by invites.
+func writeIcsEvent(w *icsWriter, event EventRow, loc *time.Location, now time.Time, attendee *UserRow) {
+	eventUrl := fmt.Sprintf("%s/events/%s", appBaseUrl, event.Slug)
+	w.line("BEGIN", "VEVENT")
+	w.line("UID", icsUid(event))
+	w.line("SEQUENCE", fmt.Sprint(event.Sequence))
+	w.line("DTSTAMP", now.UTC().Format(icsUtcFormat))
+	w.line("DTSTART;TZID="+loc.String(),
+		event.Start().In(loc).Format(icsLocalFormat))
+	w.line("DTEND;TZID="+loc.String(), event.End().In(loc).Format(icsLocalFormat))
+	w.line("SUMMARY", icsText(event.Title))
+	if event.Venue != "" {
+		w.line("LOCATION", icsText(event.Venue))
+	}
+	w.line("DESCRIPTION", icsText("Event details: "+eventUrl))
+	w.line("URL", eventUrl)
+	w.line("STATUS", "CONFIRMED")
+	if attendee != nil {
+		name := attendee.NicknameOrEmpty()
+		if name == "" {
+			name = attendee.Email
+		}
+		w.line("ORGANIZER;CN=ppacerFF", "mailto:"+from)
+		w.line("ATTENDEE;ROLE=REQ-PARTICIPANT;PARTSTAT=ACCEPTED;CN="+
+			icsParam(name), "mailto:"+attendee.Email)
+	}
+	w.line("END", "VEVENT")
+}
+
+// writeIcsTimezone writes VTIMEZONE component for given location. Instead of
+// hard-coding rules, offsets and transitions are taken from the tz database
+// for all years between from and to.
+func writeIcsTimezone(w *icsWriter, loc *time.Location, from, to time.Time) {
+	w.line("BEGIN", "VTIMEZONE")
+	w.line("TZID", loc.String())
+	start := time.Date(from.In(loc).Year(), time.January, 1, 0, 0, 0, 0, loc)
+	end := time.Date(to.In(loc).Year()+1, time.January, 1, 0, 0, 0, 0, loc)
+	transitions := tzTransitions(start, end)
+	if len(transitions) == 0 {
+		name, offset := start.Zone()
+		writeIcsObservance(w, "STANDARD", name, offset, offset,
+			time.Date(1970, time.January, 1, 0, 0, 0, 0, time.UTC))
+	}
+	for _, t := range transitions {
+		component := "STANDARD"
+		if t.IsDST() {
+			component = "DAYLIGHT"
+		}
+		_, offsetFrom := t.Add(-time.Second).Zone()
+		name, offsetTo := t.Zone()
+		// Observance start is local time expressed in the offset in use
+		// before the transition.
+		localStart := t.UTC().Add(time.Duration(offsetFrom) * time.Second)
+		writeIcsObservance(w, component, name, offsetFrom, offsetTo,
+			localStart)
+	}
+	w.line("END", "VTIMEZONE")
+}
+
+func writeIcsObservance(w *icsWriter, component, name string, offsetFrom, offsetTo int, start time.Time) {
+	w.line("BEGIN", component)
+	w.line("DTSTART", start.Format(icsLocalFormat))
+	w.line("TZOFFSETFROM", icsOffset(offsetFrom))
+	w.line("TZOFFSETTO", icsOffset(offsetTo))
+	w.line("TZNAME", icsText(name))
+	w.line("END", component)
+}
+
+// tzTransitions returns moments between start and end when UTC offset of the
+// location changes.
+func tzTransitions(start, end time.Time) []time.Time {
+	var transitions []time.Time
+	_, prevOffset := start.Zone()
+	for day := start; day.Before(end); day = day.Add(24 * time.Hour) {
+		next := day.Add(24 * time.Hour)
+		_, offset := next.Zone()
+		if offset == prevOffset {
+			continue
+		}
+		// Binary search for the first second with the new offset.
+		lo, hi := day.Unix(), next.Unix()
+		for hi-lo > 1 {
+			mid := lo + (hi-lo)/2
+			if _, o := time.Unix(mid, 0).In(start.Location()).Zone(); o == prevOffset {
+				lo = mid
+			} else {
+				hi = mid
+			}
+		}
+		transitions = append(transitions, time.Unix(hi, 0).In(start.Location()))
+		prevOffset = offset
+	}
+	return transitions
+}
+
+// icsUid returns globally unique and stable identifier of the event.
+func icsUid(event EventRow) string {
+	host := "ppacerff"
+	if u, pErr := url.Parse(appBaseUrl); pErr == nil && u.Host != "" {
+		host = u.Host
+	}
+	return event.Slug + "@" + host
+}
+
+func icsOffset(seconds int) string {
+	sign := "+"
+	if seconds < 0 {
+		sign = "-"
+		seconds = -seconds
+	}
+	return fmt.Sprintf("%s%02d%02d", sign, seconds/3600, seconds%3600/60)
+}
+
+var icsTextEscaper = strings.NewReplacer(
+	`\`, `\\`, ";", `\;`, ",", `\,`, "\r\n", `\n`, "\n", `\n`,
+)
+
+// icsText escapes TEXT property value.
+func icsText(s string) string {
+	return icsTextEscaper.Replace(s)
+}
+
+// icsParam quotes parameter value. Double quotes are not allowed inside
+// parameter values, so they are removed.
+func icsParam(s string) string {
+	return `"` + strings.ReplaceAll(s, `"`, "") + `"`
+}
+
+// EventsCalendar returns calendar with given events which can be subscribed
+// to. Unlike invites it has no attendees and uses PUBLISH method.
+func EventsCalendar(name string, events []EventRow, loc *time.Location, now time.Time) []byte {
+	var w icsWriter
+	w.line("BEGIN", "VCALENDAR")
+	w.line("VERSION", "2.0")
+	w.line("PRODID", icsProdId)
+	w.line("CALSCALE", "GREGORIAN")
+	w.line("METHOD", "PUBLISH")
+	w.line("X-WR-CALNAME", icsText(name))
+	w.line("X-WR-TIMEZONE", loc.String())
+	if len(events) > 0 {
+		from, to := events[0].Start(), events[0].End()
+		for _, event := range events {
+			if event.Start().Before(from) {
+				from = event.Start()
+			}
+			if event.End().After(to) {
+				to = event.End()
+			}
+		}
+		writeIcsTimezone(&w, loc, from, to)
+	}
+	for _, event := range events {
+		writeIcsEvent(&w, event, loc, now, nil)
+	}
+	w.line("END", "VCALENDAR")
+	return []byte(w.String())
+}
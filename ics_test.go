@@ -0,0 +1,78 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestEventInvite(t *testing.T) {
+	warsaw, lErr := time.LoadLocation("Europe/Warsaw")
+	if lErr != nil {
+		t.Skipf("No tz database: %s", lErr.Error())
+	}
+	event := defaultEvent()
+	event.Sequence = 2
+	nick := "Ala, the; admin"
+	user := UserRow{Email: "ala@x.com", Nickname: &nick}
+	now := time.Date(2024, time.October, 1, 12, 0, 0, 0, time.UTC)
+
+	invite := string(EventInvite(event, user, warsaw, now))
+	expectedLines := []string{
+		"METHOD:REQUEST",
+		"TZID:Europe/Warsaw",
+		"BEGIN:DAYLIGHT\r\nDTSTART:20240331T020000\r\nTZOFFSETFROM:+0100\r\nTZOFFSETTO:+0200\r\nTZNAME:CEST\r\nEND:DAYLIGHT",
+		"BEGIN:STANDARD\r\nDTSTART:20241027T030000\r\nTZOFFSETFROM:+0200\r\nTZOFFSETTO:+0100\r\nTZNAME:CET\r\nEND:STANDARD",
+		"UID:ff-preview-2024@ff.ppacer.org",
+		"SEQUENCE:2",
+		"DTSTAMP:20241001T120000Z",
+		"DTSTART;TZID=Europe/Warsaw:20241023T170000",
+		"DTEND;TZID=Europe/Warsaw:20241023T190000",
+		`SUMMARY:ppacer preview: friends&family`,
+		`CN="Ala, the; admin":mailto:ala@x.com`,
+	}
+	unfolded := strings.ReplaceAll(invite, "\r\n ", "")
+	for _, line := range expectedLines {
+		if !strings.Contains(unfolded, line) {
+			t.Errorf("Expected %q in invite:\n%s", line, invite)
+		}
+	}
+	for _, line := range strings.Split(invite, "\r\n") {
+		if len(line) > icsMaxLineOctets {
+			t.Errorf("Line longer than %d octets: %q", icsMaxLineOctets, line)
+		}
+	}
+}
+
+func TestIcsLineFolding(t *testing.T) {
+	for _, value := range []string{
+		strings.Repeat("ż", 60),
+		strings.Repeat("a", 200),
+	} {
+		var w icsWriter
+		w.line("SUMMARY", value)
+		folded := w.String()
+		if !strings.HasSuffix(folded, "\r\n") {
+			t.Error("Expected line to end with CRLF")
+		}
+		if unfolded := strings.ReplaceAll(folded, "\r\n ", ""); unfolded != "SUMMARY:"+value+"\r\n" {
+			t.Errorf("Unexpected content after unfolding: %q", unfolded)
+		}
+		// Limit applies to every physical line, including the leading space
+		// of continuation lines.
+		for _, line := range strings.Split(strings.TrimSuffix(folded, "\r\n"), "\r\n") {
+			if len(line) > icsMaxLineOctets {
+				t.Errorf("Line has %d octets, expected at most %d: %q",
+					len(line), icsMaxLineOctets, line)
+			}
+		}
+	}
+}
+
+func TestIcsText(t *testing.T) {
+	const input = "a,b;c\\d\ne"
+	const expected = `a\,b\;c\\d\ne`
+	if escaped := icsText(input); escaped != expected {
+		t.Errorf("Expected %s, got %s", expected, escaped)
+	}
+}
@@ -0,0 +1,306 @@
+package main
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/mail"
+	"strings"
+	"time"
+)
+
+const (
+	// Imported registrations wait for confirmation, no email is sent.
+	ImportUnconfirmed = "unconfirmed"
+
+	// Imported registrations are marked as confirmed.
+	ImportPreConfirmed = "preconfirmed"
+
+	// Imported registrations get the regular confirmation email.
+	ImportSendConfirmation = "email"
+
+	ImportStatusImported  = "imported"
+	ImportStatusDuplicate = "duplicate"
+	ImportStatusInvalid   = "invalid"
+
+	importMaxFileSize = 5 << 20
+)
+
+// ImportOptions configures bulk import of attendees.
+type ImportOptions struct {
+	EventSlug    string
+	Confirmation string
+
+	// DryRun validates the file and reports what would change without
+	// touching the database or sending emails.
+	DryRun bool
+}
+
+type ImportRowResult struct {
+	Line    int
+	Email   string
+	Status  string
+	Spot    string
+	Message string
+}
+
+type ImportReport struct {
+	DryRun     bool
+	Rows       []ImportRowResult
+	Imported   int
+	Duplicates int
+	Invalid    int
+}
+
+type importPage struct {
+	Admin    AdminRow
+	Events   []EventRow
+	Report   *ImportReport
+	ErrorMsg string
+}
+
+// ImportUsers reads CSV with header row containing email column and optional
+// nickname and drinks columns, and registers each row for given event. Rows
+// which are invalid or already registered are skipped and reported. Spots
+// are assigned the same way as for regular registrations, so rows above
+// event capacity land on the waitlist.
+func (o *Owner) ImportUsers(r io.Reader, opts ImportOptions) (ImportReport, error) {
+	report := ImportReport{DryRun: opts.DryRun}
+	event, eErr := EventBySlug(o.db, opts.EventSlug)
+	if eErr != nil {
+		return report, eErr
+	}
+	switch opts.Confirmation {
+	case ImportUnconfirmed, ImportPreConfirmed, ImportSendConfirmation:
+	default:
+		return report, fmt.Errorf("incorrect confirmation mode %q",
+			opts.Confirmation)
+	}
+
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	cr.TrimLeadingSpace = true
+	header, hErr := cr.Read()
+	if hErr != nil {
+		return report, fmt.Errorf("cannot read CSV header: %w", hErr)
+	}
+	cols, cErr := importColumns(header)
+	if cErr != nil {
+		return report, cErr
+	}
+
+	taken, tErr := TakenSpots(o.db, event.Slug)
+	if tErr != nil {
+		return report, tErr
+	}
+	nextPos, pErr := NextWaitlistPos(o.db, event.Slug)
+	if pErr != nil {
+		return report, pErr
+	}
+	takenBefore := taken
+	seen := make(map[string]bool)
+
+	for {
+		record, rErr := cr.Read()
+		if rErr == io.EOF {
+			break
+		}
+		var parseErr *csv.ParseError
+		if errors.As(rErr, &parseErr) {
+			// Malformed row is reported and the rest of the file is still
+			// imported.
+			report.add(ImportRowResult{Line: parseErr.Line,
+				Status: ImportStatusInvalid, Message: parseErr.Err.Error()})
+			continue
+		}
+		if rErr != nil {
+			return report, fmt.Errorf("cannot read CSV: %w", rErr)
+		}
+		line, _ := cr.FieldPos(0)
+		res := ImportRowResult{Line: line}
+		user, vErr := importRecord(record, cols)
+		res.Email = user.Email
+		if vErr != nil {
+			res.Status = ImportStatusInvalid
+			res.Message = vErr.Error()
+			report.add(res)
+			continue
+		}
+		key := EmailKey(user.Email)
+		_, uErr := UserByEmail(o.db, event.Slug, user.Email)
+		if uErr != nil && uErr != ErrUserNotFound {
+			return report, uErr
+		}
+		if uErr == nil || seen[key] {
+			res.Status = ImportStatusDuplicate
+			res.Message = "already registered for this event"
+			report.add(res)
+			continue
+		}
+		seen[key] = true
+
+		user.EventSlug = event.Slug
+		user.Spot = SpotAttendee
+		if event.HasCapacityLimit() && taken >= event.Capacity {
+			user.Spot = SpotWaitlist
+			user.WaitlistPos = nextPos
+		}
+		res.Spot = user.Spot
+		res.Status = ImportStatusImported
+		if !opts.DryRun {
+			iErr := o.importUser(event, user, opts.Confirmation)
+			if errors.Is(iErr, ErrUserExists) {
+				res.Status = ImportStatusDuplicate
+				res.Message = "already registered for this event"
+				report.add(res)
+				continue
+			}
+			if iErr != nil {
+				res.Status = ImportStatusInvalid
+				res.Message = iErr.Error()
+				report.add(res)
+				continue
+			}
+		}
+		if user.Spot == SpotWaitlist {
+			nextPos++
+		} else {
+			taken++
+		}
+		report.add(res)
+	}
+	if !opts.DryRun {
+		o.notifyCapacity(event, taken-takenBefore)
+	}
+	if !opts.DryRun && report.Imported > 0 {
+		o.logger.Warn("Attendees imported", "event", event.Slug, "imported",
+			report.Imported, "duplicates", report.Duplicates, "invalid",
+			report.Invalid)
+	}
+	return report, nil
+}
+
+func (o *Owner) importUser(event EventRow, user User, confirmation string) error {
+	now := time.Now()
+	user.RegistrationTs = now
+	if confirmation == ImportPreConfirmed {
+		user.Confirmed = true
+		user.ConfirmationTs = now
+	}
+	if iErr := InsertNewUser(o.db, user); iErr != nil {
+		return fmt.Errorf("cannot insert: %w", iErr)
+	}
+	if confirmation == ImportSendConfirmation {
+		// Errors are already logged by queueEmail.
+		o.sendConfirmationRequest(event, user.Email)
+	}
+	return nil
+}
+
+// ImportHandler renders import form on GET and imports uploaded CSV file on
+// POST.
+func (o *Owner) ImportHandler(w http.ResponseWriter, r *http.Request) {
+	admin, _ := AdminFromContext(r.Context())
+	p := importPage{Admin: admin}
+	events, eErr := ListEvents(o.db)
+	if eErr != nil {
+		o.logger.Error("Cannot list events", "err", eErr.Error())
+	}
+	p.Events = events
+
+	if r.Method == http.MethodPost {
+		report, iErr := o.importUpload(r)
+		if iErr != nil {
+			p.ErrorMsg = iErr.Error()
+		} else {
+			p.Report = &report
+		}
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	renderErr := o.tmpl.Render(w, "admin-import", p)
+	if renderErr != nil {
+		o.logger.Error("Cannot render <admin-import>", "err",
+			renderErr.Error())
+	}
+}
+
+func (o *Owner) importUpload(r *http.Request) (ImportReport, error) {
+	if pErr := r.ParseMultipartForm(importMaxFileSize); pErr != nil {
+		return ImportReport{}, fmt.Errorf("cannot read uploaded file: %w", pErr)
+	}
+	file, _, fErr := r.FormFile("file")
+	if fErr != nil {
+		return ImportReport{}, errors.New("please choose CSV file to import")
+	}
+	defer file.Close()
+	opts := ImportOptions{
+		EventSlug:    r.FormValue("event"),
+		Confirmation: r.FormValue("confirmation"),
+		DryRun:       r.FormValue("dryrun") == "on",
+	}
+	admin, _ := AdminFromContext(r.Context())
+	o.logger.Info("Admin import", "admin", admin.Username, "event",
+		opts.EventSlug, "dryRun", opts.DryRun)
+	return o.ImportUsers(file, opts)
+}
+
+func (r *ImportReport) add(res ImportRowResult) {
+	r.Rows = append(r.Rows, res)
+	switch res.Status {
+	case ImportStatusImported:
+		r.Imported++
+	case ImportStatusDuplicate:
+		r.Duplicates++
+	case ImportStatusInvalid:
+		r.Invalid++
+	}
+}
+
+// importColumns maps column names from CSV header to their indexes.
+func importColumns(header []string) (map[string]int, error) {
+	cols := make(map[string]int)
+	for idx, name := range header {
+		// Spreadsheets tend to save CSV with byte order mark.
+		name = strings.TrimPrefix(name, "\ufeff")
+		name = strings.ToLower(strings.TrimSpace(name))
+		switch name {
+		case "email", "nickname", "drinks":
+			cols[name] = idx
+		default:
+			return nil, fmt.Errorf("unknown CSV column %q, expected email, nickname and drinks",
+				name)
+		}
+	}
+	if _, exists := cols["email"]; !exists {
+		return nil, errors.New("CSV header has to contain email column")
+	}
+	return cols, nil
+}
+
+func importRecord(record []string, cols map[string]int) (User, error) {
+	field := func(name string) string {
+		idx, exists := cols[name]
+		if !exists || idx >= len(record) {
+			return ""
+		}
+		return strings.TrimSpace(record[idx])
+	}
+	user := User{Email: field("email")}
+	addr, aErr := mail.ParseAddress(user.Email)
+	if aErr != nil || addr.Address != user.Email {
+		return user, fmt.Errorf("incorrect email address")
+	}
+	nickname := field("nickname")
+	user.Nickname = &nickname
+	switch strings.ToLower(field("drinks")) {
+	case "", "no", "n", "false", "0":
+		user.Drinks = false
+	case "yes", "y", "true", "1":
+		user.Drinks = true
+	default:
+		return user, fmt.Errorf("incorrect drinks value %q", field("drinks"))
+	}
+	return user, nil
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestImportUsers(t *testing.T) {
+	db := newTestDb(t)
+	event := EventRow{
+		Slug: "workshop", Title: "Workshop", Status: EventStatusPublished,
+		StartTs: ToString(time.Now().Add(time.Hour)), EndTs: ToString(time.Now()),
+		Capacity: 2,
+	}
+	if iErr := InsertEvent(db, event); iErr != nil {
+		t.Fatalf("Cannot insert event: %s", iErr.Error())
+	}
+	existing := User{EventSlug: event.Slug, Email: "a@x.com",
+		Spot: SpotAttendee}
+	if iErr := InsertNewUser(db, existing); iErr != nil {
+		t.Fatalf("Cannot insert user: %s", iErr.Error())
+	}
+	notifier := &fakeNotifier{}
+	o := &Owner{db: db, logger: slog.Default(), notifier: notifier}
+	input := "email,nickname,drinks\n" +
+		"a@x.com,Ala,yes\n" +
+		"b@x.com,Bob,no\n" +
+		"not an email,,\n" +
+		"c@x.com,,maybe\n" +
+		"d@x.com,,1\n" +
+		"b@x.com,Bob again,\n"
+
+	opts := ImportOptions{EventSlug: event.Slug,
+		Confirmation: ImportPreConfirmed, DryRun: true}
+	report, iErr := o.ImportUsers(strings.NewReader(input), opts)
+	if iErr != nil {
+		t.Fatalf("Cannot import users: %s", iErr.Error())
+	}
+	if report.Imported != 2 || report.Duplicates != 2 || report.Invalid != 2 {
+		t.Errorf("Unexpected dry run report: %+v", report)
+	}
+	if _, uErr := UserByEmail(db, event.Slug, "b@x.com"); uErr != ErrUserNotFound {
+		t.Errorf("Expected dry run not to insert users, got: %v", uErr)
+	}
+
+	opts.DryRun = false
+	report, iErr = o.ImportUsers(strings.NewReader(input), opts)
+	if iErr != nil {
+		t.Fatalf("Cannot import users: %s", iErr.Error())
+	}
+	if report.Imported != 2 {
+		t.Errorf("Expected 2 imported rows, got: %+v", report)
+	}
+	if len(notifier.messages) != 2 {
+		t.Errorf("Expected 80%% and 100%% capacity alerts, got: %v",
+			notifier.messages)
+	}
+	if report.Rows[2].Line != 4 || report.Rows[2].Status != ImportStatusInvalid {
+		t.Errorf("Expected invalid email on line 4, got: %+v", report.Rows[2])
+	}
+	bob, _ := UserByEmail(db, event.Slug, "b@x.com")
+	if bob.Confirmed != 1 || bob.Spot != SpotAttendee {
+		t.Errorf("Expected b@x.com to be confirmed attendee, got: %+v", bob)
+	}
+	dan, _ := UserByEmail(db, event.Slug, "d@x.com")
+	if dan.Spot != SpotWaitlist || dan.Drinks != 1 {
+		t.Errorf("Expected d@x.com on the waitlist with drinks, got: %+v", dan)
+	}
+}
+
+func TestImportColumns(t *testing.T) {
+	if _, cErr := importColumns([]string{"nickname"}); cErr == nil {
+		t.Error("Expected error for header without email column")
+	}
+	if _, cErr := importColumns([]string{"email", "phone"}); cErr == nil {
+		t.Error("Expected error for unknown column")
+	}
+	cols, cErr := importColumns([]string{"\ufeffEmail", " drinks "})
+	if cErr != nil || cols["email"] != 0 || cols["drinks"] != 1 {
+		t.Errorf("Unexpected columns %v, err: %v", cols, cErr)
+	}
+}
+
+func TestImportUsersMalformedRows(t *testing.T) {
+	db := newTestDb(t)
+	o := &Owner{db: db, logger: slog.Default(), notifier: &fakeNotifier{}}
+	input := "email\n" +
+		"ok@x.com\n" +
+		"a\"b@x.com\n" +
+		"\"abc\n"
+	opts := ImportOptions{EventSlug: defaultEventSlug,
+		Confirmation: ImportUnconfirmed}
+	report, iErr := o.ImportUsers(strings.NewReader(input), opts)
+	if iErr != nil {
+		t.Fatalf("Cannot import users: %s", iErr.Error())
+	}
+	if report.Imported != 1 || report.Invalid != 2 {
+		t.Fatalf("Expected one imported and two invalid rows, got: %+v",
+			report)
+	}
+	if report.Rows[1].Line != 3 || report.Rows[2].Line != 4 {
+		t.Errorf("Expected malformed rows on lines 3 and 4, got: %+v",
+			report.Rows)
+	}
+}
@@ -0,0 +1,215 @@
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/mail"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const (
+	defaultSendmailPath = "/usr/sbin/sendmail"
+	mailerTimeout       = 30 * time.Second
+)
+
+// NewMailerFromConfig creates mailer selected by cfg.Mailer. Email secrets
+// are read for smtp backend or when DKIM signing is enabled.
+func NewMailerFromConfig(cfg EmailConfig, provider SecretsProvider) (Mailer, error) {
+	var secrets emailSecret
+	if cfg.Mailer == "smtp" || cfg.DKIMSelector != "" {
+		var err error
+		if secrets, err = getSecret[emailSecret](provider, cfg.SecretName); err != nil {
+			return nil, fmt.Errorf("cannot get email credentials: %w", err)
+		}
+	}
+	dkim, dErr := dkimSignerFromConfig(cfg, secrets)
+	if dErr != nil {
+		return nil, fmt.Errorf("cannot configure DKIM: %w", dErr)
+	}
+
+	switch cfg.Mailer {
+	case "smtp":
+		smtpCfg, cErr := smtpConfigFromConfig(cfg, secrets)
+		if cErr != nil {
+			return nil, cErr
+		}
+		mailer := NewSMTPMailer(smtpCfg)
+		mailer.dkim = dkim
+		// Credentials are read again for each new connection, so rotated
+		// password is picked up once cached secret expires.
+		mailer.reload = func() (SMTPConfig, error) {
+			secrets, err := getSecret[emailSecret](provider, cfg.SecretName)
+			if err != nil {
+				return SMTPConfig{}, err
+			}
+			return smtpConfigFromConfig(cfg, secrets)
+		}
+		return mailer, nil
+	case "sendmail":
+		mailer := NewSendmailMailer(cfg.SendmailPath)
+		mailer.dkim = dkim
+		return mailer, nil
+	case "file":
+		mailer, fErr := NewFileMailer(cfg.MailDir)
+		if fErr != nil {
+			return nil, fErr
+		}
+		mailer.dkim = dkim
+		return mailer, nil
+	case "http":
+		if dkim != nil {
+			return nil, errors.New("http mailer does not sign messages, configure DKIM at the email provider instead")
+		}
+		return NewHTTPMailer(cfg.ApiUrl, cfg.ApiKey), nil
+	default:
+		return nil, fmt.Errorf("unknown mailer %q, expected smtp, sendmail, file or http",
+			cfg.Mailer)
+	}
+}
+
+// ErrMailerDisabled is returned by mailer which couldn't be configured.
+var ErrMailerDisabled = errors.New("mailer is disabled")
+
+// disabledMailer is used when mailer cannot be configured, so the application
+// can still run. Emails are kept in the outbox.
+type disabledMailer struct{}
+
+func (disabledMailer) Send(EmailMessage) error {
+	return ErrMailerDisabled
+}
+
+// SendmailMailer passes emails to local sendmail-compatible binary.
+type SendmailMailer struct {
+	path string
+	dkim *DKIMSigner
+}
+
+func NewSendmailMailer(path string) *SendmailMailer {
+	return &SendmailMailer{path: path}
+}
+
+func (m *SendmailMailer) Send(msg EmailMessage) error {
+	message, bErr := buildSignedMessage(msg, m.dkim)
+	if bErr != nil {
+		return bErr
+	}
+	to, _ := mail.ParseAddress(msg.To)
+	// Recipient is given explicitly after "--", so it cannot be interpreted
+	// as an option.
+	cmd := exec.Command(m.path, "-i", "-f", from, "--", to.Address)
+	cmd.Stdin = bytes.NewReader(message)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("sendmail failed: %w: %s", err,
+			strings.TrimSpace(stderr.String()))
+	}
+	return nil
+}
+
+// FileMailer writes each email as .eml file into a directory instead of
+// sending it. It's meant for local development and tests.
+type FileMailer struct {
+	dir  string
+	dkim *DKIMSigner
+}
+
+func NewFileMailer(dir string) (*FileMailer, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("cannot create mail directory: %w", err)
+	}
+	return &FileMailer{dir: dir}, nil
+}
+
+func (m *FileMailer) Send(msg EmailMessage) error {
+	message, bErr := buildSignedMessage(msg, m.dkim)
+	if bErr != nil {
+		return bErr
+	}
+	suffix := make([]byte, 4)
+	if _, err := rand.Read(suffix); err != nil {
+		return err
+	}
+	name := fmt.Sprintf("%s-%s.eml", time.Now().UTC().Format("20060102T150405.000000"),
+		hex.EncodeToString(suffix))
+	return os.WriteFile(filepath.Join(m.dir, name), message, 0o644)
+}
+
+// HTTPMailer sends emails through HTTP API of email provider. Message is
+// posted as JSON in the shape most providers accept (or can be adapted to
+// with a small proxy).
+type HTTPMailer struct {
+	endpoint   string
+	apiKey     string
+	httpClient *http.Client
+}
+
+type httpMailerAttachment struct {
+	FileName    string `json:"filename"`
+	ContentType string `json:"content_type"`
+	Content     []byte `json:"content"`
+	ContentID   string `json:"content_id,omitempty"`
+}
+
+type httpMailerPayload struct {
+	From        string                 `json:"from"`
+	To          []string               `json:"to"`
+	ReplyTo     string                 `json:"reply_to,omitempty"`
+	Subject     string                 `json:"subject"`
+	Text        string                 `json:"text"`
+	HTML        string                 `json:"html,omitempty"`
+	Headers     map[string]string      `json:"headers,omitempty"`
+	Attachments []httpMailerAttachment `json:"attachments,omitempty"`
+	Inline      []httpMailerAttachment `json:"inline,omitempty"`
+}
+
+// NewHTTPMailer creates mailer posting emails to given endpoint. When apiKey
+// is not empty, it's sent as bearer token.
+func NewHTTPMailer(endpoint, apiKey string) *HTTPMailer {
+	return &HTTPMailer{
+		endpoint:   endpoint,
+		apiKey:     apiKey,
+		httpClient: &http.Client{Timeout: mailerTimeout},
+	}
+}
+
+func (m *HTTPMailer) Send(msg EmailMessage) error {
+	if err := validateHeaderValues(msg); err != nil {
+		return err
+	}
+	payload := httpMailerPayload{
+		From:    (&mail.Address{Name: fromName, Address: from}).String(),
+		To:      []string{msg.To},
+		ReplyTo: msg.ReplyTo,
+		Subject: msg.Subject,
+		Text:    msg.Body,
+		HTML:    msg.HTMLBody,
+	}
+	if msg.ListUnsubscribe != "" {
+		payload.Headers = map[string]string{
+			"List-Unsubscribe": "<" + msg.ListUnsubscribe + ">",
+		}
+	}
+	for _, a := range msg.Attachments {
+		payload.Attachments = append(payload.Attachments,
+			httpMailerAttachment{a.FileName, a.ContentType, a.Data, a.ContentID})
+	}
+	for _, a := range msg.Inline {
+		payload.Inline = append(payload.Inline,
+			httpMailerAttachment{a.FileName, a.ContentType, a.Data, a.ContentID})
+	}
+	var headers map[string]string
+	if m.apiKey != "" {
+		headers = map[string]string{"Authorization": "Bearer " + m.apiKey}
+	}
+	return sendJson(m.httpClient, http.MethodPost, m.endpoint, headers,
+		payload)
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestHTTPMailer(t *testing.T) {
+	var payload httpMailerPayload
+	var auth string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth = r.Header.Get("Authorization")
+		body, _ := io.ReadAll(r.Body)
+		json.Unmarshal(body, &payload)
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer srv.Close()
+
+	mailer := NewHTTPMailer(srv.URL+"/v1/send", "key")
+	sErr := mailer.Send(EmailMessage{
+		To: "ala@x.com", Subject: "Hi", Body: "Hello",
+		Attachments: []emailAttachment{{FileName: "invite.ics",
+			ContentType: "text/calendar", Data: []byte("ics")}},
+	})
+	if sErr != nil {
+		t.Fatalf("Cannot send email: %s", sErr.Error())
+	}
+	if auth != "Bearer key" || !strings.Contains(payload.From, from) ||
+		payload.To[0] != "ala@x.com" || payload.Text != "Hello" ||
+		string(payload.Attachments[0].Content) != "ics" {
+		t.Errorf("Unexpected request %s: %+v", auth, payload)
+	}
+}
+
+func TestSendmailMailer(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("sendmail stand-in is a shell script")
+	}
+	dir := t.TempDir()
+	out := filepath.Join(dir, "out")
+	script := filepath.Join(dir, "sendmail")
+	content := "#!/bin/sh\necho \"$@\" > " + out + ".args\ncat > " + out + "\n"
+	if wErr := os.WriteFile(script, []byte(content), 0o755); wErr != nil {
+		t.Fatalf("Cannot write script: %s", wErr.Error())
+	}
+	sErr := NewSendmailMailer(script).Send(EmailMessage{
+		To: "ala@x.com", Subject: "Hi", Body: "Hello",
+	})
+	if sErr != nil {
+		t.Fatalf("Cannot send email: %s", sErr.Error())
+	}
+	args, _ := os.ReadFile(out + ".args")
+	if strings.TrimSpace(string(args)) != "-i -f "+from+" -- ala@x.com" {
+		t.Errorf("Unexpected sendmail arguments: %s", args)
+	}
+	msg, _ := os.ReadFile(out)
+	if !strings.Contains(string(msg), "Subject: Hi") {
+		t.Errorf("Unexpected message passed to sendmail: %s", msg)
+	}
+}
+
+func TestNewMailerFromConfig(t *testing.T) {
+	cfg := DefaultConfig().Email
+	cfg.Mailer = "file"
+	cfg.MailDir = t.TempDir()
+	if m, mErr := NewMailerFromConfig(cfg, EnvSecrets{}); mErr != nil {
+		t.Errorf("Cannot create file mailer: %s", mErr.Error())
+	} else if _, ok := m.(*FileMailer); !ok {
+		t.Errorf("Expected file mailer, got %T", m)
+	}
+	cfg.Mailer = "smtp"
+	if _, mErr := NewMailerFromConfig(cfg, EnvSecrets{}); mErr == nil {
+		t.Error("Expected error for smtp mailer without email secrets")
+	}
+	cfg.Mailer = "pigeon"
+	if _, mErr := NewMailerFromConfig(cfg, EnvSecrets{}); mErr == nil {
+		t.Error("Expected error for unknown mailer")
+	}
+}
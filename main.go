@@ -1,12 +1,14 @@
 package main
 
 import (
+	"context"
 	"embed"
 	"flag"
 	"fmt"
 	"html/template"
 	"io"
 	"net/http"
+	"os"
 )
 
 //go:embed views/*.html
@@ -16,28 +18,110 @@ var viewsFS embed.FS
 var staticFS embed.FS
 
 func main() {
-	port := flag.Int("port", 7272, "Port for HTTP server")
-	flag.Parse()
+	cfg, cfgErr := LoadConfig(flag.CommandLine, os.Args[1:])
+	if cfgErr != nil {
+		fmt.Fprintf(os.Stderr, "Incorrect configuration:\n%s\n", cfgErr.Error())
+		os.Exit(2)
+	}
+	if cfg.Dev {
+		var dErr error
+		if cfg, dErr = devConfig(cfg); dErr != nil {
+			fmt.Fprintf(os.Stderr, "Cannot start dev mode: %s\n", dErr.Error())
+			os.Exit(1)
+		}
+	}
+	if aErr := applyConfig(cfg); aErr != nil {
+		fmt.Fprintf(os.Stderr, "Cannot apply configuration: %s\n", aErr.Error())
+		os.Exit(2)
+	}
+	if flag.NArg() > 0 {
+		os.Exit(runCommand(cfg, flag.Args()))
+	}
 	logger := defaultLogger()
 	templates := newTemplates()
 	mux := http.NewServeMux()
 
-	db, dbErr := NewSqliteClient("ppacer_ff.db", logger)
+	db, dbErr := NewSqliteClient(cfg.Database, logger)
 	if dbErr != nil {
 		logger.Error("Cannot create database client", "err", dbErr.Error())
 		panic(dbErr)
 	}
-	owner := NewOwner(db, logger, templates)
+	if cfg.Dev {
+		if sErr := seedDevData(db); sErr != nil {
+			logger.Error("Cannot seed dev database", "err", sErr.Error())
+			panic(sErr)
+		}
+		logger.Info("Development mode", "db", cfg.Database.Path, "admin",
+			devAdminUsername, "password", devAdminPassword, "inbox",
+			cfg.BaseUrl+"/dev/mail")
+	}
+	duplicates, dupErr := EmailDuplicates(db)
+	if dupErr != nil {
+		logger.Error("Cannot check near-duplicate registrations", "err",
+			dupErr.Error())
+	}
+	for _, d := range duplicates {
+		logger.Warn("Near-duplicate registration, delete the unneeded one with: ppacerFF duplicates delete -event <slug> -email <email>",
+			"event", d.EventSlug, "email", d.Email, "duplicateOf", d.DuplicateOf)
+	}
+	owner := NewOwner(cfg, db, logger, templates)
+	go owner.RunWaitlistWorker(context.Background())
+	go owner.RunEmailWorker(context.Background())
+	go owner.RunTokenCleanupWorker(context.Background())
+	go owner.RunReminderWorker(context.Background())
 
 	mux.Handle("/css/", http.FileServer(http.FS(staticFS)))
 	mux.Handle("/assets/", http.FileServer(http.FS(staticFS)))
 	mux.HandleFunc("/", owner.MainHandler)
 	mux.HandleFunc("GET /health", owner.HealthHandler)
-	mux.HandleFunc("POST /register", owner.RegistrationHandler)
-	mux.HandleFunc("GET /confirm/{hash}", owner.ConfirmHandler)
+	mux.HandleFunc("GET /events.ics", owner.CalendarHandler)
+	mux.HandleFunc("GET /calendar/{token}", owner.AttendeeCalendarHandler)
+	mux.HandleFunc("POST /webhooks/email", owner.BounceWebhookHandler)
+	mux.HandleFunc("GET /events/{slug}", owner.EventHandler)
+	mux.HandleFunc("POST /events/{slug}/register", owner.RegistrationHandler)
+	mux.HandleFunc("POST /events/{slug}/resend", owner.ResendConfirmationHandler)
+	mux.HandleFunc("GET /events/{slug}/confirm/{token}", owner.ConfirmHandler)
+	mux.HandleFunc("POST /events/{slug}/confirm/{token}", owner.ConfirmHandler)
+	mux.HandleFunc("GET /confirm/{token}", owner.ConfirmHandler)
+	mux.HandleFunc("GET /events/{slug}/cancel/{token}", owner.CancelHandler)
+	mux.HandleFunc("POST /events/{slug}/cancel/{token}", owner.CancelHandler)
+	mux.HandleFunc("GET /events/{slug}/claim/{token}", owner.ClaimHandler)
+	mux.HandleFunc("POST /events/{slug}/claim/{token}", owner.ClaimHandler)
 	mux.HandleFunc("/policy", owner.PolicyHandler)
+	mux.HandleFunc("GET /admin/login", owner.LoginHandler)
+	mux.HandleFunc("POST /admin/login", owner.LoginHandler)
+	mux.HandleFunc("GET /admin/login/2fa", owner.TotpLoginHandler)
+	mux.HandleFunc("POST /admin/login/2fa", owner.TotpLoginHandler)
+	mux.HandleFunc("POST /admin/logout", owner.LogoutHandler)
+	mux.HandleFunc("GET /admin/2fa", owner.RequireAdmin(PermViewRegistrations,
+		owner.TwoFactorHandler))
+	mux.HandleFunc("POST /admin/2fa/enable",
+		owner.RequireAdmin(PermViewRegistrations, owner.TwoFactorEnableHandler))
+	mux.HandleFunc("POST /admin/2fa/disable",
+		owner.RequireAdmin(PermViewRegistrations, owner.TwoFactorDisableHandler))
+	mux.HandleFunc("GET /admin", owner.RequireAdmin(PermViewRegistrations,
+		owner.AdminHandler))
+	mux.HandleFunc("GET /admin/registrations",
+		owner.RequireAdmin(PermViewRegistrations,
+			owner.AdminRegistrationsHandler))
+	mux.HandleFunc("GET /admin/export",
+		owner.RequireAdmin(PermExport, owner.ExportHandler))
+	mux.HandleFunc("POST /admin/registrations/{action}",
+		owner.RequireAdmin(PermEditRegistrations, owner.AdminActionHandler))
+	mux.HandleFunc("GET /admin/import",
+		owner.RequireAdmin(PermEditRegistrations, owner.ImportHandler))
+	mux.HandleFunc("POST /admin/import",
+		owner.RequireAdmin(PermEditRegistrations, owner.ImportHandler))
+
+	if cfg.Dev {
+		mux.HandleFunc("GET /dev/mail", owner.DevMailHandler)
+		mux.HandleFunc("GET /dev/mail/{id}", owner.DevMailHandler)
+		mux.HandleFunc("GET /dev/mail/{id}/{part}", owner.DevMailPartHandler)
+		mux.HandleFunc("GET /dev/mail/{id}/cid/{cid}",
+			owner.DevMailInlineHandler)
+	}
 
-	portStr := fmt.Sprintf(":%d", *port)
+	portStr := fmt.Sprintf(":%d", cfg.Port)
 	fmt.Println("Listening on port", portStr)
 	lErr := http.ListenAndServe(portStr, mux)
 	if lErr != nil {
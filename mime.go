@@ -0,0 +1,206 @@
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"net/textproto"
+	"strings"
+	"time"
+)
+
+const (
+	fromName         = "ppacerFF"
+	base64LineLength = 76
+)
+
+var (
+	ErrHeaderInjection = errors.New("email header value contains line break")
+)
+
+// mimePart is a node of MIME tree. Leaves have already encoded body,
+// multipart nodes have children.
+type mimePart struct {
+	header   textproto.MIMEHeader
+	body     []byte
+	subtype  string
+	children []mimePart
+}
+
+// BuildMessage renders email as RFC 5322 message. Text and HTML bodies become
+// multipart/alternative, inline images are put together with HTML into
+// multipart/related and attachments wrap everything in multipart/mixed.
+// Header values are validated against CR/LF injection and non-ASCII text is
+// encoded according to RFC 2047.
+func BuildMessage(msg EmailMessage, now time.Time) ([]byte, error) {
+	if err := validateHeaderValues(msg); err != nil {
+		return nil, err
+	}
+	to, toErr := mail.ParseAddress(msg.To)
+	if toErr != nil {
+		return nil, fmt.Errorf("incorrect recipient address %q: %w", msg.To,
+			toErr)
+	}
+	if len(msg.Inline) > 0 && msg.HTMLBody == "" {
+		return nil, errors.New("inline images require HTML body")
+	}
+	messageId, idErr := newMessageId()
+	if idErr != nil {
+		return nil, idErr
+	}
+
+	var buf bytes.Buffer
+	writeHeader := func(name, value string) {
+		buf.WriteString(name + ": " + value + "\r\n")
+	}
+	writeHeader("Date", now.Format(time.RFC1123Z))
+	writeHeader("Message-ID", messageId)
+	writeHeader("From", (&mail.Address{Name: fromName, Address: from}).String())
+	writeHeader("To", to.String())
+	if msg.ReplyTo != "" {
+		replyTo, rErr := mail.ParseAddress(msg.ReplyTo)
+		if rErr != nil {
+			return nil, fmt.Errorf("incorrect Reply-To address %q: %w",
+				msg.ReplyTo, rErr)
+		}
+		writeHeader("Reply-To", replyTo.String())
+	}
+	writeHeader("Subject", encodeHeaderText(msg.Subject))
+	if msg.ListUnsubscribe != "" {
+		writeHeader("List-Unsubscribe", "<"+msg.ListUnsubscribe+">")
+	}
+	writeHeader("MIME-Version", "1.0")
+
+	header, body := messageTree(msg).render()
+	for _, name := range []string{"Content-Type", "Content-Transfer-Encoding"} {
+		if value := header.Get(name); value != "" {
+			writeHeader(name, value)
+		}
+	}
+	buf.WriteString("\r\n")
+	buf.Write(body)
+	return buf.Bytes(), nil
+}
+
+func messageTree(msg EmailMessage) mimePart {
+	var content mimePart
+	if msg.HTMLBody != "" {
+		html := textPart("text/html", msg.HTMLBody)
+		if len(msg.Inline) > 0 {
+			related := mimePart{subtype: "related", children: []mimePart{html}}
+			for _, img := range msg.Inline {
+				related.children = append(related.children,
+					filePart(img, "inline"))
+			}
+			html = related
+		}
+		content = html
+		if msg.Body != "" {
+			content = mimePart{
+				subtype:  "alternative",
+				children: []mimePart{textPart("text/plain", msg.Body), html},
+			}
+		}
+	} else {
+		content = textPart("text/plain", msg.Body)
+	}
+	if len(msg.Attachments) == 0 {
+		return content
+	}
+	mixed := mimePart{subtype: "mixed", children: []mimePart{content}}
+	for _, a := range msg.Attachments {
+		mixed.children = append(mixed.children, filePart(a, "attachment"))
+	}
+	return mixed
+}
+
+// render returns MIME headers of the part and its encoded content.
+func (p mimePart) render() (textproto.MIMEHeader, []byte) {
+	if len(p.children) == 0 {
+		return p.header, p.body
+	}
+	var buf bytes.Buffer
+	mw := multipart.NewWriter(&buf)
+	for _, child := range p.children {
+		header, body := child.render()
+		w, _ := mw.CreatePart(header)
+		w.Write(body)
+	}
+	mw.Close()
+	header := textproto.MIMEHeader{}
+	header.Set("Content-Type", mime.FormatMediaType("multipart/"+p.subtype,
+		map[string]string{"boundary": mw.Boundary()}))
+	return header, buf.Bytes()
+}
+
+func textPart(mediaType, text string) mimePart {
+	var buf bytes.Buffer
+	qp := quotedprintable.NewWriter(&buf)
+	qp.Write([]byte(text))
+	qp.Close()
+	header := textproto.MIMEHeader{}
+	header.Set("Content-Type", mediaType+"; charset=UTF-8")
+	header.Set("Content-Transfer-Encoding", "quoted-printable")
+	return mimePart{header: header, body: buf.Bytes()}
+}
+
+func filePart(a emailAttachment, disposition string) mimePart {
+	header := textproto.MIMEHeader{}
+	header.Set("Content-Type", a.ContentType)
+	header.Set("Content-Transfer-Encoding", "base64")
+	header.Set("Content-Disposition", mime.FormatMediaType(disposition,
+		map[string]string{"filename": a.FileName}))
+	if a.ContentID != "" {
+		header.Set("Content-ID", "<"+a.ContentID+">")
+	}
+	return mimePart{header: header, body: base64Lines(a.Data)}
+}
+
+func base64Lines(data []byte) []byte {
+	encoded := base64.StdEncoding.EncodeToString(data)
+	var buf bytes.Buffer
+	for len(encoded) > base64LineLength {
+		buf.WriteString(encoded[:base64LineLength] + "\r\n")
+		encoded = encoded[base64LineLength:]
+	}
+	buf.WriteString(encoded + "\r\n")
+	return buf.Bytes()
+}
+
+// encodeHeaderText encodes non-ASCII text as RFC 2047 encoded words. Long
+// values are folded between encoded words.
+func encodeHeaderText(s string) string {
+	encoded := mime.QEncoding.Encode("UTF-8", s)
+	return strings.ReplaceAll(encoded, "?= =?", "?=\r\n =?")
+}
+
+// validateHeaderValues rejects values which end up in headers and contain
+// line breaks, which could be used to inject additional headers.
+func validateHeaderValues(msg EmailMessage) error {
+	values := []string{msg.To, msg.Subject, msg.ReplyTo, msg.ListUnsubscribe}
+	for _, a := range append(msg.Attachments, msg.Inline...) {
+		values = append(values, a.FileName, a.ContentType, a.ContentID)
+	}
+	for _, v := range values {
+		if strings.ContainsAny(v, "\r\n") {
+			return ErrHeaderInjection
+		}
+	}
+	return nil
+}
+
+func newMessageId() (string, error) {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	domain := from[strings.LastIndex(from, "@")+1:]
+	return fmt.Sprintf("<%s@%s>", hex.EncodeToString(buf), domain), nil
+}
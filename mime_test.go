@@ -0,0 +1,119 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/mail"
+	"net/textproto"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestBuildMessageStructure(t *testing.T) {
+	now := time.Date(2024, time.October, 1, 12, 0, 0, 0, time.UTC)
+	raw, bErr := BuildMessage(EmailMessage{
+		To:       "Łukasz <lukasz@x.com>",
+		ReplyTo:  "organizers@x.com",
+		Subject:  "Zażółć gęślą jaźń - confirmation",
+		Body:     "Hello Łukasz!",
+		HTMLBody: `<p>Hello Łukasz!</p><img src="cid:logo">`,
+		Inline: []emailAttachment{{FileName: "logo.png",
+			ContentType: "image/png", Data: []byte("png"), ContentID: "logo"}},
+		Attachments: []emailAttachment{{FileName: "invite.ics",
+			ContentType: "text/calendar", Data: []byte("BEGIN:VCALENDAR")}},
+		ListUnsubscribe: "https://ff.ppacer.org/unsubscribe",
+	}, now)
+	if bErr != nil {
+		t.Fatalf("Cannot build message: %s", bErr.Error())
+	}
+	msg, pErr := mail.ReadMessage(bytes.NewReader(raw))
+	if pErr != nil {
+		t.Fatalf("Cannot parse built message: %s\n%s", pErr.Error(), raw)
+	}
+	if msg.Header.Get("Date") != "Tue, 01 Oct 2024 12:00:00 +0000" ||
+		!strings.HasSuffix(msg.Header.Get("Message-ID"), "@dskrzypiec.dev>") ||
+		msg.Header.Get("Reply-To") != "<organizers@x.com>" ||
+		msg.Header.Get("List-Unsubscribe") != "<https://ff.ppacer.org/unsubscribe>" {
+		t.Errorf("Unexpected headers: %v", msg.Header)
+	}
+	subject, _ := new(mime.WordDecoder).DecodeHeader(msg.Header.Get("Subject"))
+	if subject != "Zażółć gęślą jaźń - confirmation" {
+		t.Errorf("Unexpected decoded subject %q", subject)
+	}
+	for _, line := range strings.Split(string(raw), "\r\n") {
+		if len(line) > 998 {
+			t.Errorf("Line too long: %q", line)
+		}
+	}
+
+	// mixed(alternative(text, related(html, image)), attachment)
+	mixed := readParts(t, msg.Header.Get("Content-Type"), msg.Body)
+	if len(mixed) != 2 || !strings.HasPrefix(mixed[1].contentType, "text/calendar") {
+		t.Fatalf("Unexpected multipart/mixed parts: %+v", mixed)
+	}
+	alternative := readParts(t, mixed[0].contentType, bytes.NewReader(mixed[0].body))
+	if len(alternative) != 2 || string(alternative[0].body) != "Hello Łukasz!" {
+		t.Fatalf("Unexpected multipart/alternative parts: %+v", alternative)
+	}
+	related := readParts(t, alternative[1].contentType,
+		bytes.NewReader(alternative[1].body))
+	if len(related) != 2 || related[1].header.Get("Content-Id") != "<logo>" ||
+		string(related[1].body) != "png" {
+		t.Fatalf("Unexpected multipart/related parts: %+v", related)
+	}
+}
+
+func TestBuildMessageRejectsHeaderInjection(t *testing.T) {
+	msgs := []EmailMessage{
+		{To: "ala@x.com\r\nBcc: eve@x.com", Subject: "Hi", Body: "x"},
+		{To: "ala@x.com", Subject: "Hi\nBcc: eve@x.com", Body: "x"},
+		{To: "ala@x.com", Subject: "Hi", Body: "x", Attachments: []emailAttachment{
+			{FileName: "a\r\n.ics", ContentType: "text/calendar"},
+		}},
+	}
+	for _, msg := range msgs {
+		if _, bErr := BuildMessage(msg, time.Now()); bErr != ErrHeaderInjection {
+			t.Errorf("Expected header injection error for %+v, got %v", msg,
+				bErr)
+		}
+	}
+	if _, bErr := BuildMessage(EmailMessage{To: "not an address"}, time.Now()); bErr == nil {
+		t.Error("Expected error for incorrect recipient")
+	}
+}
+
+type testPart struct {
+	header      textproto.MIMEHeader
+	contentType string
+	body        []byte
+}
+
+func readParts(t *testing.T, contentType string, r io.Reader) []testPart {
+	t.Helper()
+	_, params, mErr := mime.ParseMediaType(contentType)
+	if mErr != nil {
+		t.Fatalf("Cannot parse content type %q: %s", contentType, mErr.Error())
+	}
+	mr := multipart.NewReader(r, params["boundary"])
+	var parts []testPart
+	for {
+		p, pErr := mr.NextPart()
+		if pErr == io.EOF {
+			return parts
+		}
+		if pErr != nil {
+			t.Fatalf("Cannot read part: %s", pErr.Error())
+		}
+		body, _ := io.ReadAll(p)
+		if p.Header.Get("Content-Transfer-Encoding") == "base64" {
+			body, _ = io.ReadAll(base64.NewDecoder(base64.StdEncoding,
+				bytes.NewReader(body)))
+		}
+		parts = append(parts, testPart{p.Header, p.Header.Get("Content-Type"),
+			body})
+	}
+}
@@ -0,0 +1,208 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+const notifierTimeout = 30 * time.Second
+
+// Notifier sends short text alerts to organizers.
+type Notifier interface {
+	Send(msg string) error
+}
+
+// NewNotifierFromConfig creates notifier which sends alerts to all enabled
+// notifiers. Without enabled notifiers alerts are dropped.
+func NewNotifierFromConfig(cfg NotifiersConfig, secrets SecretsProvider) (Notifier, error) {
+	notifiers := MultiNotifier{}
+	for _, name := range cfg.Enabled {
+		n, nErr := newNotifier(name, cfg, secrets)
+		if nErr != nil {
+			return nil, nErr
+		}
+		notifiers = append(notifiers, n)
+	}
+	if len(notifiers) == 1 {
+		return notifiers[0], nil
+	}
+	return notifiers, nil
+}
+
+func newNotifier(name string, cfg NotifiersConfig, secrets SecretsProvider) (Notifier, error) {
+	switch name {
+	case "telegram":
+		return NewTelegram(cfg.TelegramApiUrl, cfg.TelegramSecretName, secrets)
+	case "slack":
+		return NewSlack(cfg.SlackWebhookUrl), nil
+	case "discord":
+		return NewDiscord(cfg.DiscordWebhookUrl), nil
+	case "matrix":
+		return NewMatrix(cfg.MatrixHomeserver, cfg.MatrixAccessToken,
+			cfg.MatrixRoomId), nil
+	case "webhook":
+		return NewWebhook(cfg.WebhookUrl, cfg.WebhookAuthToken), nil
+	}
+	return nil, fmt.Errorf("unknown notifier %q, expected telegram, slack, discord, matrix or webhook",
+		name)
+}
+
+// MultiNotifier sends each message to all its notifiers. Failure of one
+// notifier doesn't stop the others.
+type MultiNotifier []Notifier
+
+func (m MultiNotifier) Send(msg string) error {
+	var errs []error
+	for _, n := range m {
+		if err := n.Send(msg); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Slack sends messages using Slack incoming webhook.
+type Slack struct {
+	webhookUrl string
+	httpClient *http.Client
+}
+
+func NewSlack(webhookUrl string) *Slack {
+	return &Slack{
+		webhookUrl: webhookUrl,
+		httpClient: &http.Client{Timeout: notifierTimeout},
+	}
+}
+
+func (s *Slack) Send(msg string) error {
+	payload := map[string]string{"text": msg}
+	return sendJson(s.httpClient, http.MethodPost, s.webhookUrl, nil, payload)
+}
+
+// Discord sends messages using Discord channel webhook.
+type Discord struct {
+	webhookUrl string
+	httpClient *http.Client
+}
+
+func NewDiscord(webhookUrl string) *Discord {
+	return &Discord{
+		webhookUrl: webhookUrl,
+		httpClient: &http.Client{Timeout: notifierTimeout},
+	}
+}
+
+func (d *Discord) Send(msg string) error {
+	// Discord rejects messages longer than 2000 characters.
+	const maxLen = 2000
+	if runes := []rune(msg); len(runes) > maxLen {
+		msg = string(runes[:maxLen])
+	}
+	payload := map[string]string{"content": msg}
+	return sendJson(d.httpClient, http.MethodPost, d.webhookUrl, nil, payload)
+}
+
+// Matrix sends messages to Matrix room using client-server API.
+type Matrix struct {
+	homeserverUrl string
+	accessToken   string
+	roomId        string
+	httpClient    *http.Client
+	txnCounter    atomic.Int64
+}
+
+func NewMatrix(homeserverUrl, accessToken, roomId string) *Matrix {
+	return &Matrix{
+		homeserverUrl: strings.TrimSuffix(homeserverUrl, "/"),
+		accessToken:   accessToken,
+		roomId:        roomId,
+		httpClient:    &http.Client{Timeout: notifierTimeout},
+	}
+}
+
+func (m *Matrix) Send(msg string) error {
+	// Transaction ID makes retries idempotent, it has to be unique per
+	// access token.
+	txnId := fmt.Sprintf("ppacerff-%d-%d", time.Now().UnixNano(),
+		m.txnCounter.Add(1))
+	sendUrl := fmt.Sprintf("%s/_matrix/client/v3/rooms/%s/send/m.room.message/%s",
+		m.homeserverUrl, url.PathEscape(m.roomId), txnId)
+	headers := map[string]string{"Authorization": "Bearer " + m.accessToken}
+	payload := map[string]string{"msgtype": "m.text", "body": msg}
+	return sendJson(m.httpClient, http.MethodPut, sendUrl, headers, payload)
+}
+
+// Webhook sends messages as JSON to any HTTP endpoint.
+type Webhook struct {
+	url        string
+	authToken  string
+	httpClient *http.Client
+}
+
+type webhookPayload struct {
+	Source    string `json:"source"`
+	Text      string `json:"text"`
+	Timestamp string `json:"timestamp"`
+}
+
+// NewWebhook creates generic webhook notifier. When authToken is not empty,
+// it's sent as bearer token in Authorization header.
+func NewWebhook(url, authToken string) *Webhook {
+	return &Webhook{
+		url:        url,
+		authToken:  authToken,
+		httpClient: &http.Client{Timeout: notifierTimeout},
+	}
+}
+
+func (w *Webhook) Send(msg string) error {
+	var headers map[string]string
+	if w.authToken != "" {
+		headers = map[string]string{"Authorization": "Bearer " + w.authToken}
+	}
+	payload := webhookPayload{
+		Source:    "ppacerFF",
+		Text:      msg,
+		Timestamp: time.Now().UTC().Format(time.RFC3339),
+	}
+	return sendJson(w.httpClient, http.MethodPost, w.url, headers, payload)
+}
+
+// sendJson sends payload encoded as JSON and expects 2xx response.
+func sendJson(client *http.Client, method, url string, headers map[string]string, payload any) error {
+	body, jErr := json.Marshal(payload)
+	if jErr != nil {
+		return jErr
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), notifierTimeout)
+	defer cancel()
+	req, rErr := http.NewRequestWithContext(ctx, method, url,
+		bytes.NewReader(body))
+	if rErr != nil {
+		return rErr
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for key, value := range headers {
+		req.Header.Set(key, value)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		respBody, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("expected 2xx status from %s, got: %d %s",
+			req.URL.Host, resp.StatusCode, strings.TrimSpace(string(respBody)))
+	}
+	return nil
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+type recordedRequest struct {
+	Method string
+	Path   string
+	Query  string
+	Auth   string
+	Body   map[string]string
+}
+
+func newRecordingServer(t *testing.T, status int) (*httptest.Server, *[]recordedRequest) {
+	t.Helper()
+	var requests []recordedRequest
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		req := recordedRequest{
+			Method: r.Method, Path: r.URL.EscapedPath(), Query: r.URL.RawQuery,
+			Auth: r.Header.Get("Authorization"),
+		}
+		json.Unmarshal(body, &req.Body)
+		requests = append(requests, req)
+		w.WriteHeader(status)
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &requests
+}
+
+func TestNotifierBackends(t *testing.T) {
+	srv, requests := newRecordingServer(t, http.StatusOK)
+	notifiers := []Notifier{
+		&Telegram{apiUrl: srv.URL, botToken: "token", channelId: 42,
+			httpClient: srv.Client()},
+		NewSlack(srv.URL + "/services/T0/B0/X"),
+		NewDiscord(srv.URL + "/api/webhooks/1/abc"),
+		NewMatrix(srv.URL+"/", "secret", "!room:example.org"),
+		NewWebhook(srv.URL+"/hook", "hook-token"),
+	}
+	for _, n := range notifiers {
+		if err := n.Send("hello"); err != nil {
+			t.Fatalf("Cannot send message with %T: %s", n, err.Error())
+		}
+	}
+	if len(*requests) != len(notifiers) {
+		t.Fatalf("Expected %d requests, got %d", len(notifiers), len(*requests))
+	}
+	reqs := *requests
+
+	if reqs[0].Path != "/bottoken/sendMessage" ||
+		reqs[0].Query != "chat_id=42&text=hello" {
+		t.Errorf("Unexpected Telegram request: %+v", reqs[0])
+	}
+	if reqs[1].Method != "POST" || reqs[1].Body["text"] != "hello" {
+		t.Errorf("Unexpected Slack request: %+v", reqs[1])
+	}
+	if reqs[2].Path != "/api/webhooks/1/abc" || reqs[2].Body["content"] != "hello" {
+		t.Errorf("Unexpected Discord request: %+v", reqs[2])
+	}
+	if reqs[3].Method != "PUT" || reqs[3].Auth != "Bearer secret" ||
+		!strings.HasPrefix(reqs[3].Path,
+			"/_matrix/client/v3/rooms/%21room:example.org/send/m.room.message/") ||
+		reqs[3].Body["msgtype"] != "m.text" || reqs[3].Body["body"] != "hello" {
+		t.Errorf("Unexpected Matrix request: %+v", reqs[3])
+	}
+	if reqs[4].Auth != "Bearer hook-token" || reqs[4].Body["text"] != "hello" ||
+		reqs[4].Body["source"] != "ppacerFF" {
+		t.Errorf("Unexpected webhook request: %+v", reqs[4])
+	}
+}
+
+func TestMultiNotifierSendsToAll(t *testing.T) {
+	okSrv, okRequests := newRecordingServer(t, http.StatusOK)
+	failSrv, _ := newRecordingServer(t, http.StatusInternalServerError)
+	multi := MultiNotifier{NewSlack(failSrv.URL), NewWebhook(okSrv.URL, "")}
+	err := multi.Send("hello")
+	if err == nil {
+		t.Error("Expected error from failing notifier")
+	}
+	if len(*okRequests) != 1 {
+		t.Errorf("Expected message to reach all notifiers, got %d requests",
+			len(*okRequests))
+	}
+	if err := (MultiNotifier{}).Send("hello"); err != nil {
+		t.Errorf("Expected no error without notifiers, got: %s", err.Error())
+	}
+}
+
+func TestNewNotifierFromConfig(t *testing.T) {
+	cfg := NotifiersConfig{
+		Enabled:         []string{"slack", "webhook"},
+		SlackWebhookUrl: "http://localhost/slack",
+		WebhookUrl:      "http://localhost/hook",
+	}
+	n, nErr := NewNotifierFromConfig(cfg, EnvSecrets{})
+	if nErr != nil {
+		t.Fatalf("Cannot create notifier: %s", nErr.Error())
+	}
+	multi, ok := n.(MultiNotifier)
+	if !ok || len(multi) != 2 {
+		t.Fatalf("Expected two notifiers, got %#v", n)
+	}
+
+	cfg.Enabled = []string{"telegram"}
+	if _, nErr := NewNotifierFromConfig(cfg, EnvSecrets{}); nErr == nil {
+		t.Error("Expected error for Telegram notifier without secrets")
+	}
+	cfg.Enabled = []string{"pigeon"}
+	if _, nErr := NewNotifierFromConfig(cfg, EnvSecrets{}); nErr == nil {
+		t.Error("Expected error for unknown notifier")
+	}
+	cfg.Enabled = nil
+	if n, nErr := NewNotifierFromConfig(cfg, EnvSecrets{}); nErr != nil || n.Send("x") != nil {
+		t.Errorf("Expected no-op notifier, got %#v, %v", n, nErr)
+	}
+}
@@ -0,0 +1,343 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+const (
+	OutboxPending = "pending"
+	OutboxSent    = "sent"
+	OutboxDead    = "dead"
+	// Recipient is on the suppression list, message won't be sent.
+	OutboxSuppressed = "suppressed"
+
+	outboxCheckInterval = 10 * time.Second
+	outboxBatchSize     = 20
+	outboxMaxAttempts   = 8
+	outboxBaseBackoff   = 30 * time.Second
+	outboxMaxBackoff    = 2 * time.Hour
+)
+
+// OutboxMessage is an email waiting in email_outbox table to be sent.
+type OutboxMessage struct {
+	Id int64
+	EmailMessage
+	Status      string
+	Attempts    int
+	NextAttempt time.Time
+	LastError   string
+	CreatedTs   string
+	SentTs      string
+}
+
+// QueueEmail stores email in the outbox. It's sent by RunEmailWorker.
+func QueueEmail(db *SqliteDB, msg EmailMessage) error {
+	attachmentsJson, jErr := json.Marshal(msg.Attachments)
+	if jErr != nil {
+		return fmt.Errorf("cannot serialize attachments: %w", jErr)
+	}
+	inlineJson, jErr := json.Marshal(msg.Inline)
+	if jErr != nil {
+		return fmt.Errorf("cannot serialize inline images: %w", jErr)
+	}
+	now := time.Now()
+	_, iErr := db.Exec(insertOutboxQuery(), msg.To, msg.ReplyTo, msg.Subject,
+		msg.Body, msg.HTMLBody, string(attachmentsJson), string(inlineJson),
+		msg.ListUnsubscribe, OutboxPending, now.Unix(), ToString(now))
+	if iErr != nil {
+		return fmt.Errorf("cannot queue email to %s: %w", msg.To, iErr)
+	}
+	return nil
+}
+
+// DueOutboxMessages returns pending messages which should be sent at given
+// time, oldest first.
+func DueOutboxMessages(db *SqliteDB, now time.Time, limit int) ([]OutboxMessage, error) {
+	rows, qErr := db.Query(readDueOutboxQuery(), OutboxPending, now.Unix(),
+		limit)
+	if qErr != nil {
+		return nil, fmt.Errorf("cannot query email outbox: %w", qErr)
+	}
+	defer rows.Close()
+	messages := make([]OutboxMessage, 0)
+	for rows.Next() {
+		msg, scanErr := parseOutboxRow(rows)
+		if scanErr != nil {
+			return nil, fmt.Errorf("error while scanning outbox row: %w",
+				scanErr)
+		}
+		messages = append(messages, msg)
+	}
+	return messages, rows.Err()
+}
+
+// OutboxMessagesByStatus returns messages in given status, oldest first.
+func OutboxMessagesByStatus(db *SqliteDB, status string) ([]OutboxMessage, error) {
+	rows, qErr := db.Query(readOutboxByStatusQuery(), status)
+	if qErr != nil {
+		return nil, fmt.Errorf("cannot query email outbox: %w", qErr)
+	}
+	defer rows.Close()
+	messages := make([]OutboxMessage, 0)
+	for rows.Next() {
+		msg, scanErr := parseOutboxRow(rows)
+		if scanErr != nil {
+			return nil, fmt.Errorf("error while scanning outbox row: %w",
+				scanErr)
+		}
+		messages = append(messages, msg)
+	}
+	return messages, rows.Err()
+}
+
+func markOutboxSent(db *SqliteDB, id int64, now time.Time) error {
+	_, uErr := db.Exec(updateOutboxSentQuery(), OutboxSent, ToString(now), id)
+	return uErr
+}
+
+func markOutboxFailed(db *SqliteDB, id int64, status string, attempts int, nextAttempt time.Time, lastError string) error {
+	_, uErr := db.Exec(updateOutboxFailedQuery(), status, attempts,
+		nextAttempt.Unix(), lastError, id)
+	return uErr
+}
+
+// outboxBackoff returns delay before next attempt after given number of
+// failed attempts. It doubles with each attempt up to outboxMaxBackoff.
+func outboxBackoff(attempts int) time.Duration {
+	backoff := outboxBaseBackoff
+	for i := 1; i < attempts; i++ {
+		backoff *= 2
+		if backoff >= outboxMaxBackoff {
+			return outboxMaxBackoff
+		}
+	}
+	return backoff
+}
+
+// queueEmail puts email into the outbox and wakes up the email worker. Errors
+// are logged, because there's nothing more a caller could do about them.
+func (o *Owner) queueEmail(msg EmailMessage) error {
+	qErr := QueueEmail(o.db, msg)
+	if qErr != nil {
+		o.logger.Error("Cannot queue email", "to", msg.To, "subject",
+			msg.Subject, "err", qErr.Error())
+		return qErr
+	}
+	select {
+	case o.outboxWakeup <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// RunEmailWorker sends emails from the outbox. Failed messages are retried
+// with exponential backoff and after outboxMaxAttempts they are moved to dead
+// state and organizers are notified. State is kept in the database, so the
+// worker picks up where it left off after restart. It blocks until given
+// context is done.
+func (o *Owner) RunEmailWorker(ctx context.Context) {
+	if _, disabled := o.mailer.(disabledMailer); disabled {
+		o.logger.Warn("Mailer is disabled, emails are kept in the outbox")
+		return
+	}
+	send := func(msg OutboxMessage) error {
+		return o.mailer.Send(msg.EmailMessage)
+	}
+	ticker := time.NewTicker(outboxCheckInterval)
+	defer ticker.Stop()
+	for {
+		o.processOutbox(send, time.Now())
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-o.outboxWakeup:
+		}
+	}
+}
+
+func (o *Owner) processOutbox(send func(OutboxMessage) error, now time.Time) {
+	messages, mErr := DueOutboxMessages(o.db, now, outboxBatchSize)
+	if mErr != nil {
+		o.logger.Error("Cannot read email outbox", "err", mErr.Error())
+		return
+	}
+	for _, msg := range messages {
+		suppressed, supErr := IsSuppressed(o.db, msg.To)
+		if supErr != nil {
+			o.logger.Error("Cannot check suppression list", "id", msg.Id,
+				"err", supErr.Error())
+			continue
+		}
+		if suppressed {
+			o.logger.Warn("Email not sent, recipient is suppressed", "id",
+				msg.Id, "to", msg.To)
+			uErr := markOutboxFailed(o.db, msg.Id, OutboxSuppressed,
+				msg.Attempts, msg.NextAttempt, "recipient is on suppression list")
+			if uErr != nil {
+				o.logger.Error("Cannot update email in outbox", "id", msg.Id,
+					"err", uErr.Error())
+			}
+			continue
+		}
+		sErr := send(msg)
+		if sErr == nil {
+			if uErr := markOutboxSent(o.db, msg.Id, time.Now()); uErr != nil {
+				o.logger.Error("Cannot mark email as sent", "id", msg.Id,
+					"err", uErr.Error())
+			}
+			continue
+		}
+		attempts := msg.Attempts + 1
+		status := OutboxPending
+		if attempts >= outboxMaxAttempts {
+			status = OutboxDead
+		}
+		o.logger.Warn("Cannot send email", "id", msg.Id, "to",
+			msg.To, "attempts", attempts, "err", sErr.Error())
+		uErr := markOutboxFailed(o.db, msg.Id, status, attempts,
+			now.Add(outboxBackoff(attempts)), sErr.Error())
+		if uErr != nil {
+			o.logger.Error("Cannot update email in outbox", "id", msg.Id,
+				"err", uErr.Error())
+			continue
+		}
+		if status == OutboxDead {
+			o.notifier.Send(
+				fmt.Sprintf("[ppacerFF] Email [%s] to [%s] failed %d times and was given up: %s",
+					msg.Subject, msg.To, attempts, sErr.Error()),
+			)
+		}
+	}
+}
+
+func parseOutboxRow(row rowScanner) (OutboxMessage, error) {
+	var m OutboxMessage
+	var attachmentsJson, inlineJson string
+	var nextAttemptUnix int64
+	scanErr := row.Scan(&m.Id, &m.To, &m.ReplyTo, &m.Subject, &m.Body,
+		&m.HTMLBody, &attachmentsJson, &inlineJson, &m.ListUnsubscribe,
+		&m.Status, &m.Attempts, &nextAttemptUnix, &m.LastError, &m.CreatedTs,
+		&m.SentTs)
+	if scanErr != nil {
+		return m, scanErr
+	}
+	m.NextAttempt = time.Unix(nextAttemptUnix, 0)
+	if attachmentsJson != "" {
+		if jErr := json.Unmarshal([]byte(attachmentsJson), &m.Attachments); jErr != nil {
+			return m, fmt.Errorf("cannot parse attachments: %w", jErr)
+		}
+	}
+	if inlineJson != "" {
+		if jErr := json.Unmarshal([]byte(inlineJson), &m.Inline); jErr != nil {
+			return m, fmt.Errorf("cannot parse inline images: %w", jErr)
+		}
+	}
+	return m, nil
+}
+
+func insertOutboxQuery() string {
+	return `
+	INSERT INTO email_outbox(
+		Recipient, ReplyTo, Subject, Body, HtmlBody, Attachments, Inline,
+		ListUnsubscribe, Status, Attempts, NextAttemptUnix, LastError,
+		CreatedTs, SentTs
+	)
+	VALUES (?,?,?,?,?,?,?,?,?,0,?,'',?,'')
+	`
+}
+
+func selectOutboxQuery(where, orderBy string) string {
+	return `
+	SELECT
+		Id,
+		Recipient,
+		ReplyTo,
+		Subject,
+		Body,
+		HtmlBody,
+		Attachments,
+		Inline,
+		ListUnsubscribe,
+		Status,
+		Attempts,
+		NextAttemptUnix,
+		LastError,
+		CreatedTs,
+		SentTs
+	FROM
+		email_outbox
+	WHERE
+		` + where + `
+	ORDER BY
+		` + orderBy + `
+`
+}
+
+func readDueOutboxQuery() string {
+	return selectOutboxQuery("Status = ? AND NextAttemptUnix <= ?",
+		"NextAttemptUnix, Id") + "LIMIT ?"
+}
+
+func readOutboxByStatusQuery() string {
+	return selectOutboxQuery("Status = ?", "Id")
+}
+
+func updateOutboxSentQuery() string {
+	return `
+	UPDATE
+		email_outbox
+	SET
+		Status = ?,
+		SentTs = ?,
+		LastError = ''
+	WHERE
+		Id = ?
+`
+}
+
+func updateOutboxFailedQuery() string {
+	return `
+	UPDATE
+		email_outbox
+	SET
+		Status = ?,
+		Attempts = ?,
+		NextAttemptUnix = ?,
+		LastError = ?
+	WHERE
+		Id = ?
+`
+}
+
+func sqliteCreateEmailOutboxTable() string {
+	return `
+		CREATE TABLE IF NOT EXISTS email_outbox (
+			Id              INTEGER PRIMARY KEY AUTOINCREMENT,
+			Recipient       TEXT NOT NULL,
+			ReplyTo         TEXT NOT NULL,
+			Subject         TEXT NOT NULL,
+			Body            TEXT NOT NULL,
+			HtmlBody        TEXT NOT NULL,
+			Attachments     TEXT NOT NULL,
+			Inline          TEXT NOT NULL,
+			ListUnsubscribe TEXT NOT NULL,
+			Status          TEXT NOT NULL,
+			Attempts        INT NOT NULL,
+			NextAttemptUnix INT NOT NULL,
+			LastError       TEXT NOT NULL,
+			CreatedTs       TEXT NOT NULL,
+			SentTs          TEXT NOT NULL
+		);
+`
+}
+
+func sqliteCreateEmailOutboxIndex() string {
+	return `
+		CREATE INDEX IF NOT EXISTS email_outbox_due
+		ON email_outbox (Status, NextAttemptUnix);
+`
+}
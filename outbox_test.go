@@ -0,0 +1,90 @@
+package main
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+type fakeNotifier struct {
+	messages []string
+}
+
+func (f *fakeNotifier) Send(msg string) error {
+	f.messages = append(f.messages, msg)
+	return nil
+}
+
+func TestOutboxRetriesAndDeadLetters(t *testing.T) {
+	db := newTestDb(t)
+	notifier := &fakeNotifier{}
+	o := &Owner{db: db, logger: defaultLogger(), notifier: notifier}
+	invite := emailAttachment{FileName: "invite.ics",
+		ContentType: "text/calendar", Data: []byte("ics")}
+	if qErr := o.queueEmail(EmailMessage{To: "ok@x.com",
+		ReplyTo: "info@x.com", ListUnsubscribe: "https://x.com/cancel/t",
+		Subject: "Hi", Body: "Body", Attachments: []emailAttachment{invite}}); qErr != nil {
+		t.Fatalf("Cannot queue email: %s", qErr.Error())
+	}
+	if qErr := o.queueEmail(EmailMessage{To: "bad@x.com",
+		Subject: "Hi", Body: "Body"}); qErr != nil {
+		t.Fatalf("Cannot queue email: %s", qErr.Error())
+	}
+
+	var sent []OutboxMessage
+	send := func(msg OutboxMessage) error {
+		if msg.To == "bad@x.com" {
+			return errors.New("mailbox unavailable")
+		}
+		sent = append(sent, msg)
+		return nil
+	}
+	now := time.Now()
+	o.processOutbox(send, now)
+	if len(sent) != 1 || string(sent[0].Attachments[0].Data) != "ics" {
+		t.Fatalf("Expected single sent message with attachment, got %+v", sent)
+	}
+	if sent[0].ReplyTo != "info@x.com" ||
+		sent[0].ListUnsubscribe != "https://x.com/cancel/t" {
+		t.Errorf("Expected Reply-To and List-Unsubscribe to be kept, got %+v",
+			sent[0].EmailMessage)
+	}
+
+	// Failed message is not retried before its backoff passes.
+	o.processOutbox(send, now.Add(time.Second))
+	pending, _ := OutboxMessagesByStatus(db, OutboxPending)
+	if len(pending) != 1 || pending[0].Attempts != 1 ||
+		pending[0].LastError != "mailbox unavailable" {
+		t.Fatalf("Expected one pending message after first failure, got %+v",
+			pending)
+	}
+
+	for attempt := 2; attempt <= outboxMaxAttempts; attempt++ {
+		now = now.Add(outboxMaxBackoff)
+		o.processOutbox(send, now)
+	}
+	dead, _ := OutboxMessagesByStatus(db, OutboxDead)
+	if len(dead) != 1 || dead[0].Attempts != outboxMaxAttempts {
+		t.Fatalf("Expected message in dead state, got %+v", dead)
+	}
+	if len(notifier.messages) != 1 {
+		t.Errorf("Expected single alert about dead message, got %v",
+			notifier.messages)
+	}
+	if sentMsgs, _ := OutboxMessagesByStatus(db, OutboxSent); len(sentMsgs) != 1 {
+		t.Errorf("Expected one sent message, got %d", len(sentMsgs))
+	}
+}
+
+func TestOutboxBackoff(t *testing.T) {
+	data := map[int]time.Duration{
+		1: outboxBaseBackoff, 2: 2 * outboxBaseBackoff,
+		4: 8 * outboxBaseBackoff, 20: outboxMaxBackoff,
+	}
+	for attempts, expected := range data {
+		if backoff := outboxBackoff(attempts); backoff != expected {
+			t.Errorf("Expected backoff %s after %d attempts, got %s",
+				expected, attempts, backoff)
+		}
+	}
+}
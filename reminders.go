@@ -0,0 +1,230 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	// How often unconfirmed registrations are checked for due reminders.
+	reminderCheckInterval = 10 * time.Minute
+)
+
+// unconfirmedUser is unconfirmed registration together with the last
+// reminder from the schedule which was sent to it, 0 when none was sent.
+type unconfirmedUser struct {
+	EventSlug      string
+	Email          string
+	Nickname       *string
+	RegistrationTs string
+	LastReminder   int
+}
+
+// UnconfirmedUsers returns all unconfirmed registrations with the last
+// confirmation reminder sent to each of them.
+func UnconfirmedUsers(db *SqliteDB) ([]unconfirmedUser, error) {
+	rows, qErr := db.Query(readUnconfirmedUsersQuery())
+	if qErr != nil {
+		return nil, fmt.Errorf("cannot query unconfirmed users: %w", qErr)
+	}
+	defer rows.Close()
+	users := make([]unconfirmedUser, 0)
+	for rows.Next() {
+		var u unconfirmedUser
+		scanErr := rows.Scan(&u.EventSlug, &u.Email, &u.Nickname,
+			&u.RegistrationTs, &u.LastReminder)
+		if scanErr != nil {
+			return nil, fmt.Errorf("cannot scan unconfirmed user: %w", scanErr)
+		}
+		users = append(users, u)
+	}
+	return users, rows.Err()
+}
+
+// RecordReminder stores attempt of sending confirmation reminder.
+func RecordReminder(db *SqliteDB, eventSlug, email string, attempt int, now time.Time) error {
+	_, iErr := db.Exec(insertReminderQuery(), eventSlug, email, attempt,
+		ToString(now))
+	return iErr
+}
+
+// dueReminders returns how many reminders should have been sent for
+// registration of given age.
+func dueReminders(schedule []time.Duration, age time.Duration) int {
+	due := 0
+	for _, after := range schedule {
+		if age >= after {
+			due++
+		}
+	}
+	return due
+}
+
+// sendConfirmationReminders sends new confirmation link to unconfirmed
+// registrations which reached the next age from the schedule. When the
+// worker was not running for a while, reminders which were missed are
+// skipped, so nobody gets several emails at once. Registrations for events
+// which are no longer open are not reminded.
+func (o *Owner) sendConfirmationReminders(now time.Time) {
+	if len(o.confirmReminders) == 0 {
+		return
+	}
+	users, uErr := UnconfirmedUsers(o.db)
+	if uErr != nil {
+		o.logger.Error("Cannot read unconfirmed users", "err", uErr.Error())
+		return
+	}
+	events := make(map[string]EventRow)
+	for _, user := range users {
+		registered, pErr := FromString(user.RegistrationTs)
+		if pErr != nil {
+			continue
+		}
+		due := dueReminders(o.confirmReminders, now.Sub(registered))
+		if due <= user.LastReminder {
+			continue
+		}
+		event, ok := events[user.EventSlug]
+		if !ok {
+			var eErr error
+			if event, eErr = EventBySlug(o.db, user.EventSlug); eErr != nil {
+				o.logger.Error("Cannot read event", "slug", user.EventSlug,
+					"err", eErr.Error())
+				continue
+			}
+			events[user.EventSlug] = event
+		}
+		if !event.IsOpen() {
+			continue
+		}
+		// Attempt is recorded before sending, so failure doesn't lead to
+		// sending the reminder over and over again.
+		rErr := RecordReminder(o.db, user.EventSlug, user.Email, due, now)
+		if rErr != nil {
+			o.logger.Error("Cannot record reminder", "event", user.EventSlug,
+				"email", user.Email, "err", rErr.Error())
+			continue
+		}
+		token, tErr := o.issueToken(event, user.Email, TokenConfirm)
+		if tErr != nil {
+			continue
+		}
+		nickname := ""
+		if user.Nickname != nil {
+			nickname = *user.Nickname
+		}
+		o.queueTemplatedEmail(user.Email, emailConfirmationReminder, emailData{
+			Event:    event,
+			Nickname: nickname,
+			ConfirmUrl: fmt.Sprintf("%s/events/%s/confirm/%s", appBaseUrl,
+				event.Slug, token),
+		})
+		o.logger.Info("Confirmation reminder sent", "event", user.EventSlug,
+			"email", user.Email, "attempt", due)
+	}
+}
+
+// sendUnconfirmedSummary notifies organizers how many registrations for
+// events which haven't started yet are still unconfirmed. Nothing is sent
+// when there are none.
+func (o *Owner) sendUnconfirmedSummary() {
+	users, uErr := UnconfirmedUsers(o.db)
+	if uErr != nil {
+		o.logger.Error("Cannot read unconfirmed users", "err", uErr.Error())
+		return
+	}
+	counts := make(map[string]int)
+	for _, user := range users {
+		counts[user.EventSlug]++
+	}
+	lines := make([]string, 0, len(counts))
+	for slug, count := range counts {
+		event, eErr := EventBySlug(o.db, slug)
+		if eErr != nil || !event.IsOpen() {
+			continue
+		}
+		lines = append(lines, fmt.Sprintf("[%s]: %d", slug, count))
+	}
+	if len(lines) == 0 {
+		return
+	}
+	sort.Strings(lines)
+	o.notifier.Send(fmt.Sprintf("[ppacerFF] Unconfirmed registrations: %s",
+		strings.Join(lines, ", ")))
+}
+
+// RunReminderWorker periodically sends confirmation reminders and once a day,
+// after summaryHour, summary of unconfirmed registrations to organizers. It
+// blocks until given context is done.
+func (o *Owner) RunReminderWorker(ctx context.Context) {
+	ticker := time.NewTicker(reminderCheckInterval)
+	defer ticker.Stop()
+	var lastSummary string
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			now := time.Now()
+			o.sendConfirmationReminders(now)
+			local := now.In(CurrentTz())
+			today := local.Format(DateFormat)
+			if local.Hour() >= o.summaryHour && today != lastSummary {
+				o.sendUnconfirmedSummary()
+				lastSummary = today
+			}
+		}
+	}
+}
+
+func readUnconfirmedUsersQuery() string {
+	return `
+	SELECT
+		u.EventSlug,
+		u.Email,
+		u.Nickname,
+		u.RegistrationTs,
+		COALESCE(MAX(r.Attempt), 0) AS LastReminder
+	FROM
+		users u
+	LEFT JOIN
+		confirmation_reminders r ON r.EventSlug = u.EventSlug AND r.Email = u.Email
+	WHERE
+		u.Confirmed = 0
+	GROUP BY
+		u.EventSlug,
+		u.Email
+`
+}
+
+func insertReminderQuery() string {
+	return `
+	INSERT INTO confirmation_reminders(EventSlug, Email, Attempt, SentTs)
+	VALUES (?,?,?,?)
+`
+}
+
+func deleteRemindersQuery() string {
+	return `
+	DELETE FROM
+		confirmation_reminders
+	WHERE
+			EventSlug = ?
+		AND Email = ?
+`
+}
+
+func sqliteCreateConfirmationRemindersTable() string {
+	return `
+		CREATE TABLE IF NOT EXISTS confirmation_reminders (
+			EventSlug TEXT NOT NULL,
+			Email     TEXT NOT NULL,
+			Attempt   INT NOT NULL,
+			SentTs    TEXT NOT NULL,
+			PRIMARY KEY (EventSlug, Email, Attempt)
+		);
+`
+}
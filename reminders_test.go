@@ -0,0 +1,79 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSendConfirmationReminders(t *testing.T) {
+	db := newTestDb(t)
+	start := time.Now().Add(10 * 24 * time.Hour)
+	event := EventRow{Slug: "meetup", Title: "Meetup",
+		Status: EventStatusPublished, StartTs: ToString(start),
+		EndTs: ToString(start.Add(time.Hour))}
+	if iErr := InsertEvent(db, event); iErr != nil {
+		t.Fatalf("Cannot insert event: %s", iErr.Error())
+	}
+	registered := time.Now()
+	users := []User{
+		{EventSlug: event.Slug, Email: "late@x.com"},
+		{EventSlug: event.Slug, Email: "done@x.com", Confirmed: true},
+		// Registrations for past events are not reminded.
+		{EventSlug: defaultEventSlug, Email: "old@x.com"},
+	}
+	for _, u := range users {
+		u.RegistrationTs = registered
+		u.Spot = SpotAttendee
+		if iErr := InsertNewUser(db, u); iErr != nil {
+			t.Fatalf("Cannot insert user: %s", iErr.Error())
+		}
+	}
+	emails, _ := newEmailTemplates("")
+	notifier := &fakeNotifier{}
+	o := &Owner{db: db, logger: defaultLogger(), emails: emails,
+		notifier:         notifier,
+		confirmReminders: []time.Duration{24 * time.Hour, 72 * time.Hour}}
+
+	data := []struct {
+		age      time.Duration
+		expected int
+	}{
+		{time.Hour, 0},
+		{25 * time.Hour, 1},
+		{26 * time.Hour, 1},
+		{73 * time.Hour, 2},
+		{200 * time.Hour, 2},
+	}
+	for _, d := range data {
+		o.sendConfirmationReminders(registered.Add(d.age))
+		pending, _ := OutboxMessagesByStatus(db, OutboxPending)
+		if len(pending) != d.expected {
+			t.Fatalf("Expected %d reminders after %s, got %d", d.expected,
+				d.age, len(pending))
+		}
+		for _, msg := range pending {
+			if msg.To != "late@x.com" || !strings.Contains(msg.Body, "/events/meetup/confirm/") {
+				t.Errorf("Unexpected reminder to %s:\n%s", msg.To, msg.Body)
+			}
+		}
+	}
+
+	o.sendUnconfirmedSummary()
+	if len(notifier.messages) != 1 || !strings.Contains(notifier.messages[0], "[meetup]: 1") ||
+		strings.Contains(notifier.messages[0], defaultEventSlug) {
+		t.Errorf("Unexpected summary: %v", notifier.messages)
+	}
+
+	// Registering again after cancellation starts the schedule from scratch.
+	DeleteUser(db, event.Slug, "late@x.com")
+	InsertNewUser(db, User{EventSlug: event.Slug, Email: "late@x.com",
+		RegistrationTs: registered})
+	unconfirmed, _ := UnconfirmedUsers(db)
+	for _, u := range unconfirmed {
+		if u.Email == "late@x.com" && u.LastReminder != 0 {
+			t.Errorf("Expected no reminders after registering again, got %d",
+				u.LastReminder)
+		}
+	}
+}
@@ -0,0 +1,239 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	// Prefix of environment variables holding secrets for env backend.
+	secretEnvPrefix  = "PPACER_FF_SECRET_"
+	defaultAwsRegion = "eu-central-1"
+	defaultSecretTTL = 10 * time.Minute
+	awsSecretTimeout = 10 * time.Second
+)
+
+var ErrSecretNotFound = errors.New("secret not found")
+
+// SecretsProvider returns secrets by name. Secret is a JSON object, which is
+// parsed into a struct by getSecret.
+type SecretsProvider interface {
+	GetSecret(name string) ([]byte, error)
+}
+
+// NewSecretsProviderFromConfig creates secrets provider selected by
+// cfg.Backend. Secrets are cached for cfg.TTL.
+func NewSecretsProviderFromConfig(cfg SecretsConfig) (SecretsProvider, error) {
+	var provider SecretsProvider
+	switch cfg.Backend {
+	case "aws":
+		provider = NewAWSSecrets(cfg.AwsRegion)
+	case "env":
+		provider = EnvSecrets{}
+	case "file":
+		provider = FileSecrets{path: cfg.File}
+	case "dir":
+		provider = DirSecrets{dir: cfg.Dir}
+	default:
+		return nil, fmt.Errorf("unknown secrets backend %q, expected aws, env, file or dir",
+			cfg.Backend)
+	}
+	return NewCachedSecrets(provider, cfg.TTL.Duration), nil
+}
+
+// getSecret reads secret and parses it into T.
+func getSecret[T any](provider SecretsProvider, name string) (T, error) {
+	var secret T
+	raw, err := provider.GetSecret(name)
+	if err != nil {
+		return secret, fmt.Errorf("cannot get secret %s: %w", name, err)
+	}
+	if err := json.Unmarshal(raw, &secret); err != nil {
+		return secret, fmt.Errorf("cannot parse secret %s: %w", name, err)
+	}
+	return secret, nil
+}
+
+// EnvSecrets reads secret from environment variable named after the secret,
+// for example email/dskrzypiec/info is read from
+// PPACER_FF_SECRET_EMAIL_DSKRZYPIEC_INFO.
+type EnvSecrets struct{}
+
+func (EnvSecrets) GetSecret(name string) ([]byte, error) {
+	value, ok := os.LookupEnv(secretEnvName(name))
+	if !ok {
+		return nil, fmt.Errorf("%w: %s is not set", ErrSecretNotFound,
+			secretEnvName(name))
+	}
+	return []byte(value), nil
+}
+
+func secretEnvName(name string) string {
+	mapped := strings.Map(func(r rune) rune {
+		if r > unicode.MaxASCII || !(unicode.IsLetter(r) || unicode.IsDigit(r)) {
+			return '_'
+		}
+		return unicode.ToUpper(r)
+	}, name)
+	return secretEnvPrefix + mapped
+}
+
+// FileSecrets reads secrets from JSON or YAML file (by extension), which maps
+// secret names to objects. File is read on each call, the provider is meant
+// to be wrapped by CachedSecrets.
+type FileSecrets struct {
+	path string
+}
+
+func (f FileSecrets) GetSecret(name string) ([]byte, error) {
+	content, rErr := os.ReadFile(f.path)
+	if rErr != nil {
+		return nil, fmt.Errorf("cannot read secrets file: %w", rErr)
+	}
+	secrets := make(map[string]any)
+	var pErr error
+	switch strings.ToLower(filepath.Ext(f.path)) {
+	case ".yaml", ".yml":
+		pErr = yaml.Unmarshal(content, &secrets)
+	default:
+		pErr = json.Unmarshal(content, &secrets)
+	}
+	if pErr != nil {
+		return nil, fmt.Errorf("cannot parse secrets file %s: %w", f.path, pErr)
+	}
+	secret, ok := secrets[name]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s in %s", ErrSecretNotFound, name, f.path)
+	}
+	return json.Marshal(secret)
+}
+
+// DirSecrets reads secrets mounted as files, like Docker secrets or Kubernetes
+// secret volumes. Secret is either a file with JSON object or a directory in
+// which each file is a single field. Slashes in secret name can be replaced
+// by underscores in file name.
+type DirSecrets struct {
+	dir string
+}
+
+func (d DirSecrets) GetSecret(name string) ([]byte, error) {
+	for _, candidate := range []string{name, strings.ReplaceAll(name, "/", "_")} {
+		path := filepath.Join(d.dir, filepath.FromSlash(candidate))
+		info, sErr := os.Stat(path)
+		if errors.Is(sErr, os.ErrNotExist) {
+			continue
+		}
+		if sErr != nil {
+			return nil, sErr
+		}
+		if !info.IsDir() {
+			return os.ReadFile(path)
+		}
+		return readSecretFields(path)
+	}
+	return nil, fmt.Errorf("%w: %s in %s", ErrSecretNotFound, name, d.dir)
+}
+
+func readSecretFields(dir string) ([]byte, error) {
+	entries, rErr := os.ReadDir(dir)
+	if rErr != nil {
+		return nil, rErr
+	}
+	fields := make(map[string]string)
+	for _, entry := range entries {
+		// Kubernetes keeps actual files in hidden ..data directory.
+		if entry.IsDir() || strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+		value, err := os.ReadFile(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+		fields[entry.Name()] = strings.TrimRight(string(value), "\r\n")
+	}
+	return json.Marshal(fields)
+}
+
+// AWSSecrets reads secrets from AWS Secrets Manager.
+type AWSSecrets struct {
+	region string
+}
+
+func NewAWSSecrets(region string) *AWSSecrets {
+	return &AWSSecrets{region: region}
+}
+
+func (a *AWSSecrets) GetSecret(name string) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), awsSecretTimeout)
+	defer cancel()
+	cfg, err := config.LoadDefaultConfig(ctx, config.WithRegion(a.region))
+	if err != nil {
+		return nil, err
+	}
+	svc := secretsmanager.NewFromConfig(cfg)
+	result, err := svc.GetSecretValue(ctx, &secretsmanager.GetSecretValueInput{
+		SecretId: aws.String(name),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve secret: %w", err)
+	}
+	if result.SecretString == nil {
+		return nil, fmt.Errorf("secret string is nil")
+	}
+	return []byte(*result.SecretString), nil
+}
+
+// CachedSecrets caches secrets of underlying provider for given TTL. When
+// refresh fails, the last known value is returned, so temporary outage of
+// secrets backend doesn't break running application.
+type CachedSecrets struct {
+	provider SecretsProvider
+	ttl      time.Duration
+
+	sync.Mutex
+	entries map[string]cachedSecret
+}
+
+type cachedSecret struct {
+	value     []byte
+	fetchedAt time.Time
+}
+
+func NewCachedSecrets(provider SecretsProvider, ttl time.Duration) *CachedSecrets {
+	return &CachedSecrets{provider: provider, ttl: ttl,
+		entries: make(map[string]cachedSecret)}
+}
+
+func (c *CachedSecrets) GetSecret(name string) ([]byte, error) {
+	c.Lock()
+	defer c.Unlock()
+	entry, cached := c.entries[name]
+	if cached && time.Since(entry.fetchedAt) < c.ttl {
+		return entry.value, nil
+	}
+	value, err := c.provider.GetSecret(name)
+	if err != nil {
+		if cached {
+			// Don't hit failing backend on every call.
+			c.entries[name] = cachedSecret{value: entry.value,
+				fetchedAt: time.Now()}
+			return entry.value, nil
+		}
+		return nil, err
+	}
+	c.entries[name] = cachedSecret{value: value, fetchedAt: time.Now()}
+	return value, nil
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestSecretsProviders(t *testing.T) {
+	dir := t.TempDir()
+	expected := telegramSecrets{BotToken: "token", ChannelId: "-100"}
+
+	t.Setenv("PPACER_FF_SECRET_TELEGRAM_HOMEAPPDEV",
+		`{"botToken":"token","channelId":"-100"}`)
+
+	jsonFile := filepath.Join(dir, "secrets.json")
+	os.WriteFile(jsonFile, []byte(
+		`{"telegram/homeAppDev": {"botToken": "token", "channelId": "-100"}}`),
+		0o600)
+	yamlFile := filepath.Join(dir, "secrets.yaml")
+	os.WriteFile(yamlFile, []byte(
+		"telegram/homeAppDev:\n  botToken: token\n  channelId: \"-100\"\n"),
+		0o600)
+
+	// Docker style: single file with JSON, slashes replaced by underscores.
+	dockerDir := filepath.Join(dir, "docker")
+	os.MkdirAll(dockerDir, 0o700)
+	os.WriteFile(filepath.Join(dockerDir, "telegram_homeAppDev"),
+		[]byte(`{"botToken":"token","channelId":"-100"}`), 0o600)
+
+	// Kubernetes style: directory with a file per field.
+	k8sDir := filepath.Join(dir, "k8s", "telegram", "homeAppDev")
+	os.MkdirAll(filepath.Join(k8sDir, "..data"), 0o700)
+	os.WriteFile(filepath.Join(k8sDir, "botToken"), []byte("token\n"), 0o600)
+	os.WriteFile(filepath.Join(k8sDir, "channelId"), []byte("-100"), 0o600)
+
+	providers := map[string]SecretsProvider{
+		"env":    EnvSecrets{},
+		"json":   FileSecrets{path: jsonFile},
+		"yaml":   FileSecrets{path: yamlFile},
+		"docker": DirSecrets{dir: dockerDir},
+		"k8s":    DirSecrets{dir: filepath.Join(dir, "k8s")},
+	}
+	for name, provider := range providers {
+		secret, err := getSecret[telegramSecrets](provider, telegramSecretName)
+		if err != nil {
+			t.Errorf("Cannot read secret from %s provider: %s", name,
+				err.Error())
+			continue
+		}
+		if secret != expected {
+			t.Errorf("Expected %+v from %s provider, got %+v", expected, name,
+				secret)
+		}
+		if _, err := provider.GetSecret("missing/secret"); !errors.Is(err, ErrSecretNotFound) {
+			t.Errorf("Expected ErrSecretNotFound from %s provider, got %v",
+				name, err)
+		}
+	}
+}
+
+type countingSecrets struct {
+	calls int
+	value string
+	err   error
+}
+
+func (c *countingSecrets) GetSecret(string) ([]byte, error) {
+	c.calls++
+	return []byte(c.value), c.err
+}
+
+func TestCachedSecrets(t *testing.T) {
+	backend := &countingSecrets{value: "v1"}
+	cached := NewCachedSecrets(backend, 50*time.Millisecond)
+	for i := 0; i < 3; i++ {
+		if v, _ := cached.GetSecret("s"); string(v) != "v1" {
+			t.Errorf("Expected v1, got %s", v)
+		}
+	}
+	if backend.calls != 1 {
+		t.Errorf("Expected single call to backend, got %d", backend.calls)
+	}
+
+	// Rotated secret is picked up after TTL.
+	backend.value = "v2"
+	time.Sleep(60 * time.Millisecond)
+	if v, _ := cached.GetSecret("s"); string(v) != "v2" {
+		t.Errorf("Expected rotated value v2, got %s", v)
+	}
+
+	// Last known value is used when backend is unavailable.
+	backend.err = errors.New("unreachable")
+	time.Sleep(60 * time.Millisecond)
+	if v, err := cached.GetSecret("s"); err != nil || string(v) != "v2" {
+		t.Errorf("Expected stale value v2, got %s, %v", v, err)
+	}
+	if _, err := cached.GetSecret("other"); err == nil {
+		t.Error("Expected error for secret which was never read")
+	}
+}
+
+func TestNewOwnerDegradedMode(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.Secrets.Backend = "env"
+	o := NewOwner(cfg, newTestDb(t), defaultLogger(), nil)
+	if _, ok := o.mailer.(disabledMailer); !ok {
+		t.Errorf("Expected disabled mailer, got %T", o.mailer)
+	}
+	if n, ok := o.notifier.(MultiNotifier); !ok || len(n) != 0 {
+		t.Errorf("Expected no notifiers, got %#v", o.notifier)
+	}
+}
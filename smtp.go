@@ -0,0 +1,274 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"net/textproto"
+	"os"
+	"sync"
+	"time"
+)
+
+const (
+	// SMTP connection security. In auto mode implicit TLS is used on port 465
+	// and STARTTLS on any other port.
+	SMTPTLSAuto     = "auto"
+	SMTPTLSStartTLS = "starttls"
+	SMTPTLSImplicit = "implicit"
+
+	smtpImplicitTLSPort = "465"
+	smtpIdleTimeout     = 30 * time.Second
+)
+
+// SMTPConfig describes connection to SMTP server.
+type SMTPConfig struct {
+	Host     string
+	Port     string
+	Username string
+	Password string
+	TLSMode  string
+
+	// RootCAs is the set of CAs trusted for server certificate. When nil,
+	// system roots are used.
+	RootCAs *x509.CertPool
+
+	// IdleTimeout is how long connection is kept open after the last message.
+	IdleTimeout time.Duration
+}
+
+// smtpConfigFromConfig builds SMTP configuration from email secrets and
+// email settings.
+func smtpConfigFromConfig(emailCfg EmailConfig, secrets emailSecret) (SMTPConfig, error) {
+	cfg := SMTPConfig{
+		Host:        secrets.Host,
+		Port:        secrets.Port,
+		Username:    secrets.Address,
+		Password:    secrets.Password,
+		TLSMode:     emailCfg.SmtpTLS,
+		IdleTimeout: smtpIdleTimeout,
+	}
+	if cfg.Username == "" {
+		cfg.Username = emailCfg.From
+	}
+	if emailCfg.SmtpCAFile != "" {
+		pool, err := loadCertPool(emailCfg.SmtpCAFile)
+		if err != nil {
+			return cfg, err
+		}
+		cfg.RootCAs = pool
+	}
+	return cfg, nil
+}
+
+// loadCertPool returns system cert pool extended by certificates from given
+// PEM file.
+func loadCertPool(path string) (*x509.CertPool, error) {
+	pem, rErr := os.ReadFile(path)
+	if rErr != nil {
+		return nil, fmt.Errorf("cannot read CA bundle: %w", rErr)
+	}
+	pool, pErr := x509.SystemCertPool()
+	if pErr != nil {
+		pool = x509.NewCertPool()
+	}
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("no certificates found in CA bundle %s", path)
+	}
+	return pool, nil
+}
+
+// SMTPMailer sends emails through SMTP server. Server certificate is always
+// verified. Connection is authenticated once and reused for following
+// messages, until it's idle for longer than IdleTimeout.
+type SMTPMailer struct {
+	cfg  SMTPConfig
+	dkim *DKIMSigner
+
+	// reload returns current configuration before connecting, when set.
+	reload func() (SMTPConfig, error)
+
+	sync.Mutex
+	conn      net.Conn
+	client    *smtp.Client
+	lastUsed  time.Time
+	idleTimer *time.Timer
+}
+
+func NewSMTPMailer(cfg SMTPConfig) *SMTPMailer {
+	if cfg.IdleTimeout == 0 {
+		cfg.IdleTimeout = smtpIdleTimeout
+	}
+	return &SMTPMailer{cfg: cfg}
+}
+
+func (m *SMTPMailer) Send(msg EmailMessage) error {
+	message, bErr := buildSignedMessage(msg, m.dkim)
+	if bErr != nil {
+		return bErr
+	}
+	// BuildMessage has already validated the recipient.
+	to, _ := mail.ParseAddress(msg.To)
+
+	m.Lock()
+	defer m.Unlock()
+	if m.idleTimer != nil {
+		m.idleTimer.Stop()
+	}
+	reused := m.client != nil
+	err := m.send(to.Address, message)
+	if err != nil && reused && !isSMTPRejection(err) {
+		// Server might have closed idle connection on its side.
+		err = m.send(to.Address, message)
+	}
+	m.lastUsed = time.Now()
+	if m.client != nil {
+		m.idleTimer = time.AfterFunc(m.cfg.IdleTimeout, m.closeIdle)
+	}
+	return err
+}
+
+// Close ends SMTP session, if there's one open.
+func (m *SMTPMailer) Close() error {
+	m.Lock()
+	defer m.Unlock()
+	if m.idleTimer != nil {
+		m.idleTimer.Stop()
+	}
+	if m.client == nil {
+		return nil
+	}
+	err := m.client.Quit()
+	m.drop()
+	return err
+}
+
+func (m *SMTPMailer) send(to string, message []byte) error {
+	if m.client == nil {
+		if err := m.connect(); err != nil {
+			return err
+		}
+	} else if err := m.client.Reset(); err != nil {
+		m.drop()
+		return err
+	}
+	m.conn.SetDeadline(time.Now().Add(mailerTimeout))
+
+	err := m.transaction(to, message)
+	if err != nil && !isSMTPRejection(err) {
+		m.drop()
+	}
+	return err
+}
+
+func (m *SMTPMailer) transaction(to string, message []byte) error {
+	if err := m.client.Mail(from); err != nil {
+		return err
+	}
+	if err := m.client.Rcpt(to); err != nil {
+		return err
+	}
+	writer, err := m.client.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := writer.Write(message); err != nil {
+		return err
+	}
+	return writer.Close()
+}
+
+func (m *SMTPMailer) connect() error {
+	if m.reload != nil {
+		cfg, err := m.reload()
+		if err != nil {
+			return fmt.Errorf("cannot reload SMTP configuration: %w", err)
+		}
+		cfg.IdleTimeout = m.cfg.IdleTimeout
+		m.cfg = cfg
+	}
+	addr := net.JoinHostPort(m.cfg.Host, m.cfg.Port)
+	tlsConfig := &tls.Config{
+		ServerName: m.cfg.Host,
+		RootCAs:    m.cfg.RootCAs,
+		MinVersion: tls.VersionTLS12,
+	}
+	dialer := &net.Dialer{Timeout: mailerTimeout, KeepAlive: mailerTimeout}
+
+	mode := m.cfg.TLSMode
+	if mode == "" || mode == SMTPTLSAuto {
+		mode = SMTPTLSStartTLS
+		if m.cfg.Port == smtpImplicitTLSPort {
+			mode = SMTPTLSImplicit
+		}
+	}
+	var conn net.Conn
+	var dErr error
+	switch mode {
+	case SMTPTLSImplicit:
+		conn, dErr = tls.DialWithDialer(dialer, "tcp", addr, tlsConfig)
+	case SMTPTLSStartTLS:
+		conn, dErr = dialer.Dial("tcp", addr)
+	default:
+		return fmt.Errorf("unknown SMTP TLS mode %q, expected auto, starttls or implicit",
+			m.cfg.TLSMode)
+	}
+	if dErr != nil {
+		return fmt.Errorf("cannot connect to SMTP server %s: %w", addr, dErr)
+	}
+	conn.SetDeadline(time.Now().Add(mailerTimeout))
+
+	client, err := smtp.NewClient(conn, m.cfg.Host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	if mode == SMTPTLSStartTLS {
+		// Never fall back to plain text, credentials would be sent in clear.
+		if ok, _ := client.Extension("STARTTLS"); !ok {
+			client.Close()
+			return errors.New("SMTP server does not support STARTTLS")
+		}
+		if err := client.StartTLS(tlsConfig); err != nil {
+			client.Close()
+			return fmt.Errorf("STARTTLS failed: %w", err)
+		}
+	}
+	auth := smtp.PlainAuth("", m.cfg.Username, m.cfg.Password, m.cfg.Host)
+	if err := client.Auth(auth); err != nil {
+		client.Close()
+		return fmt.Errorf("SMTP authentication failed: %w", err)
+	}
+	m.conn = conn
+	m.client = client
+	return nil
+}
+
+func (m *SMTPMailer) closeIdle() {
+	m.Lock()
+	defer m.Unlock()
+	// Timer might have fired while another message was being sent.
+	if m.client != nil && time.Since(m.lastUsed) >= m.cfg.IdleTimeout {
+		m.client.Quit()
+		m.drop()
+	}
+}
+
+func (m *SMTPMailer) drop() {
+	if m.client != nil {
+		m.client.Close()
+	}
+	m.client = nil
+	m.conn = nil
+}
+
+// isSMTPRejection tells whether error is a response from SMTP server, which
+// leaves the session usable, rather than broken connection.
+func isSMTPRejection(err error) bool {
+	var protoErr *textproto.Error
+	return errors.As(err, &protoErr)
+}
@@ -0,0 +1,246 @@
+package main
+
+import (
+	"bufio"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeSMTPServer is a minimal SMTP server accepting every message. It supports
+// STARTTLS or implicit TLS and AUTH PLAIN.
+type fakeSMTPServer struct {
+	listener  net.Listener
+	tlsConfig *tls.Config
+	implicit  bool
+
+	sync.Mutex
+	connections int
+	auths       int
+	messages    []string
+	rejectRcpt  string
+}
+
+func newFakeSMTPServer(t *testing.T, implicit bool) (*fakeSMTPServer, *x509.CertPool) {
+	t.Helper()
+	cert, pool := selfSignedCert(t)
+	tlsConfig := &tls.Config{Certificates: []tls.Certificate{cert}}
+	var listener net.Listener
+	var lErr error
+	if implicit {
+		listener, lErr = tls.Listen("tcp", "127.0.0.1:0", tlsConfig)
+	} else {
+		listener, lErr = net.Listen("tcp", "127.0.0.1:0")
+	}
+	if lErr != nil {
+		t.Fatalf("Cannot listen: %s", lErr.Error())
+	}
+	s := &fakeSMTPServer{listener: listener, tlsConfig: tlsConfig,
+		implicit: implicit}
+	t.Cleanup(func() { listener.Close() })
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			s.Lock()
+			s.connections++
+			s.Unlock()
+			go s.serve(conn)
+		}
+	}()
+	return s, pool
+}
+
+func (s *fakeSMTPServer) config(pool *x509.CertPool) SMTPConfig {
+	_, port, _ := net.SplitHostPort(s.listener.Addr().String())
+	mode := SMTPTLSStartTLS
+	if s.implicit {
+		mode = SMTPTLSImplicit
+	}
+	return SMTPConfig{Host: "127.0.0.1", Port: port, Username: from,
+		Password: "secret", TLSMode: mode, RootCAs: pool}
+}
+
+func (s *fakeSMTPServer) serve(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	reply := func(line string) { conn.Write([]byte(line + "\r\n")) }
+	_, secure := conn.(*tls.Conn)
+	reply("220 fake ESMTP")
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		cmd := strings.ToUpper(strings.TrimSpace(line))
+		switch {
+		case strings.HasPrefix(cmd, "EHLO"):
+			if !secure {
+				reply("250-fake")
+				reply("250 STARTTLS")
+			} else {
+				reply("250-fake")
+				reply("250 AUTH PLAIN")
+			}
+		case cmd == "STARTTLS":
+			reply("220 ready")
+			tlsConn := tls.Server(conn, s.tlsConfig)
+			if tlsConn.Handshake() != nil {
+				return
+			}
+			conn, r, secure = tlsConn, bufio.NewReader(tlsConn), true
+		case strings.HasPrefix(cmd, "AUTH PLAIN"):
+			s.Lock()
+			s.auths++
+			s.Unlock()
+			reply("235 ok")
+		case strings.HasPrefix(cmd, "RCPT TO:"):
+			s.Lock()
+			reject := s.rejectRcpt != "" && strings.Contains(cmd,
+				strings.ToUpper(s.rejectRcpt))
+			s.Unlock()
+			if reject {
+				reply("550 no such user")
+			} else {
+				reply("250 ok")
+			}
+		case cmd == "DATA":
+			reply("354 go ahead")
+			var data strings.Builder
+			for {
+				l, err := r.ReadString('\n')
+				if err != nil {
+					return
+				}
+				if l == ".\r\n" {
+					break
+				}
+				data.WriteString(l)
+			}
+			s.Lock()
+			s.messages = append(s.messages, data.String())
+			s.Unlock()
+			reply("250 queued")
+		case cmd == "QUIT":
+			reply("221 bye")
+			return
+		default:
+			reply("250 ok")
+		}
+	}
+}
+
+func (s *fakeSMTPServer) stats() (int, int, int) {
+	s.Lock()
+	defer s.Unlock()
+	return s.connections, s.auths, len(s.messages)
+}
+
+func selfSignedCert(t *testing.T) (tls.Certificate, *x509.CertPool) {
+	t.Helper()
+	key, kErr := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if kErr != nil {
+		t.Fatalf("Cannot generate key: %s", kErr.Error())
+	}
+	template := x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "fake smtp"},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		IsCA:         true,
+
+		BasicConstraintsValid: true,
+	}
+	der, cErr := x509.CreateCertificate(rand.Reader, &template, &template,
+		&key.PublicKey, key)
+	if cErr != nil {
+		t.Fatalf("Cannot create certificate: %s", cErr.Error())
+	}
+	parsed, _ := x509.ParseCertificate(der)
+	pool := x509.NewCertPool()
+	pool.AddCert(parsed)
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}, pool
+}
+
+func TestSMTPMailerReusesConnection(t *testing.T) {
+	for _, implicit := range []bool{false, true} {
+		server, pool := newFakeSMTPServer(t, implicit)
+		mailer := NewSMTPMailer(server.config(pool))
+		for _, to := range []string{"a@x.com", "b@x.com", "c@x.com"} {
+			msg := EmailMessage{To: to, Subject: "Hi", Body: "Hello"}
+			if err := mailer.Send(msg); err != nil {
+				t.Fatalf("Cannot send email (implicit=%v): %s", implicit,
+					err.Error())
+			}
+		}
+		if err := mailer.Close(); err != nil {
+			t.Errorf("Cannot close SMTP session: %s", err.Error())
+		}
+		conns, auths, messages := server.stats()
+		if conns != 1 || auths != 1 || messages != 3 {
+			t.Errorf("Expected 1 connection, 1 AUTH and 3 messages (implicit=%v), got %d, %d, %d",
+				implicit, conns, auths, messages)
+		}
+	}
+}
+
+func TestSMTPMailerVerifiesCertificate(t *testing.T) {
+	server, _ := newFakeSMTPServer(t, false)
+	cfg := server.config(x509.NewCertPool())
+	err := NewSMTPMailer(cfg).Send(EmailMessage{To: "a@x.com", Body: "Hi"})
+	if err == nil || !strings.Contains(err.Error(), "certificate") {
+		t.Errorf("Expected certificate verification error, got: %v", err)
+	}
+	if _, auths, _ := server.stats(); auths != 0 {
+		t.Error("Expected no AUTH over unverified connection")
+	}
+}
+
+func TestSMTPMailerRejectionKeepsSession(t *testing.T) {
+	server, pool := newFakeSMTPServer(t, false)
+	server.rejectRcpt = "bad@x.com"
+	mailer := NewSMTPMailer(server.config(pool))
+	defer mailer.Close()
+	if err := mailer.Send(EmailMessage{To: "bad@x.com", Body: "Hi"}); err == nil {
+		t.Error("Expected rejected recipient error")
+	}
+	if err := mailer.Send(EmailMessage{To: "ok@x.com", Body: "Hi"}); err != nil {
+		t.Fatalf("Cannot send email: %s", err.Error())
+	}
+	if conns, _, messages := server.stats(); conns != 1 || messages != 1 {
+		t.Errorf("Expected single connection and message, got %d, %d", conns,
+			messages)
+	}
+}
+
+func TestSMTPMailerReconnectsAfterIdle(t *testing.T) {
+	server, pool := newFakeSMTPServer(t, true)
+	cfg := server.config(pool)
+	cfg.IdleTimeout = 20 * time.Millisecond
+	mailer := NewSMTPMailer(cfg)
+	defer mailer.Close()
+	for i := 0; i < 2; i++ {
+		if err := mailer.Send(EmailMessage{To: "a@x.com", Body: "Hi"}); err != nil {
+			t.Fatalf("Cannot send email: %s", err.Error())
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	if conns, auths, _ := server.stats(); conns != 2 || auths != 2 {
+		t.Errorf("Expected new session after idle timeout, got %d connections",
+			conns)
+	}
+}
@@ -3,15 +3,14 @@ package main
 import (
 	"context"
 	"fmt"
-	"log"
 	"net/http"
 	"net/url"
 	"strconv"
-	"time"
 )
 
 const (
 	telegramSecretName = "telegram/homeAppDev"
+	telegramApiUrl     = "https://api.telegram.org"
 )
 
 type telegramSecrets struct {
@@ -20,31 +19,44 @@ type telegramSecrets struct {
 }
 
 type Telegram struct {
+	apiUrl     string
+	secretName string
 	botToken   string
 	channelId  int64
 	httpClient *http.Client
+
+	// secrets are read again before each message, so rotated bot token is
+	// picked up once cached secret expires. Values read for a message are
+	// kept local to Send, so concurrent messages don't race on the fields
+	// above, which are only set on creation.
+	secrets SecretsProvider
 }
 
-func NewTelegram() *Telegram {
-	secret, sErr := getTelegramSecret()
-	if sErr != nil {
-		log.Panicf("Cannot get Telegram secrets from AWS: %s", sErr.Error())
-	}
-	channelId, castErr := strconv.ParseInt(secret.ChannelId, 10, 64)
-	if castErr != nil {
-		log.Panicf("Cannot cast channelId (%s) to int64: %s",
-			secret.ChannelId, castErr.Error())
+func NewTelegram(apiUrl, secretName string, secrets SecretsProvider) (*Telegram, error) {
+	t := &Telegram{
+		apiUrl:     apiUrl,
+		secretName: secretName,
+		httpClient: &http.Client{Timeout: notifierTimeout},
+		secrets:    secrets,
 	}
-	return &Telegram{
-		botToken:   secret.BotToken,
-		channelId:  channelId,
-		httpClient: &http.Client{Timeout: 30 * time.Second},
+	botToken, channelId, err := t.loadSecrets()
+	if err != nil {
+		return nil, err
 	}
+	t.botToken, t.channelId = botToken, channelId
+	return t, nil
 }
 
 func (t *Telegram) Send(msg string) error {
-	url := t.sendMessageUrl(msg)
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	botToken, channelId := t.botToken, t.channelId
+	if t.secrets != nil {
+		var err error
+		if botToken, channelId, err = t.loadSecrets(); err != nil {
+			return err
+		}
+	}
+	url := t.sendMessageUrl(botToken, channelId, msg)
+	ctx, cancel := context.WithTimeout(context.Background(), notifierTimeout)
 	defer cancel()
 	req, rErr := http.NewRequestWithContext(ctx, "GET", url, nil)
 	if rErr != nil {
@@ -54,6 +66,7 @@ func (t *Telegram) Send(msg string) error {
 	if err != nil {
 		return err
 	}
+	defer resp.Body.Close()
 	if resp.StatusCode != http.StatusOK {
 		return fmt.Errorf("expected status %d, got: %d", http.StatusOK,
 			resp.StatusCode)
@@ -61,12 +74,21 @@ func (t *Telegram) Send(msg string) error {
 	return nil
 }
 
-func getTelegramSecret() (telegramSecrets, error) {
-	return getSecretFromAWS[telegramSecrets](telegramSecretName)
+func (t *Telegram) loadSecrets() (string, int64, error) {
+	secret, sErr := getSecret[telegramSecrets](t.secrets, t.secretName)
+	if sErr != nil {
+		return "", 0, fmt.Errorf("cannot get Telegram secrets: %w", sErr)
+	}
+	channelId, castErr := strconv.ParseInt(secret.ChannelId, 10, 64)
+	if castErr != nil {
+		return "", 0, fmt.Errorf("cannot cast channelId (%s) to int64: %w",
+			secret.ChannelId, castErr)
+	}
+	return secret.BotToken, channelId, nil
 }
 
-func (t *Telegram) sendMessageUrl(text string) string {
-	const urlTmpl = "https://api.telegram.org/bot%s/sendMessage?chat_id=%d&text=%s"
+func (t *Telegram) sendMessageUrl(botToken string, channelId int64, text string) string {
+	const urlTmpl = "%s/bot%s/sendMessage?chat_id=%d&text=%s"
 	encodedText := url.QueryEscape(text)
-	return fmt.Sprintf(urlTmpl, t.botToken, t.channelId, encodedText)
+	return fmt.Sprintf(urlTmpl, t.apiUrl, botToken, channelId, encodedText)
 }
@@ -1,11 +1,58 @@
 package main
 
-import "testing"
+import (
+	"net/http"
+	"testing"
+)
+
+// memorySecrets keeps secrets in memory, so notifiers can be tested without
+// external secrets store.
+type memorySecrets map[string]string
+
+func (m memorySecrets) GetSecret(name string) ([]byte, error) {
+	value, ok := m[name]
+	if !ok {
+		return nil, ErrSecretNotFound
+	}
+	return []byte(value), nil
+}
 
 func TestTelegram(t *testing.T) {
-	telegram := NewTelegram()
-	err := telegram.Send("test from ppacerFF")
-	if err != nil {
+	srv, requests := newRecordingServer(t, http.StatusOK)
+	secrets := memorySecrets{
+		telegramSecretName: `{"botToken": "token1", "channelId": "42"}`,
+	}
+	telegram, tErr := NewTelegram(srv.URL, telegramSecretName, secrets)
+	if tErr != nil {
+		t.Fatalf("Cannot create Telegram notifier: %s", tErr.Error())
+	}
+	if err := telegram.Send("test from ppacerFF"); err != nil {
 		t.Errorf("Error while sending Telegram message: %s", err.Error())
 	}
+
+	// Rotated bot token is used for the next message.
+	secrets[telegramSecretName] = `{"botToken": "token2", "channelId": "43"}`
+	if err := telegram.Send("hello"); err != nil {
+		t.Errorf("Error while sending Telegram message: %s", err.Error())
+	}
+	if len(*requests) != 2 {
+		t.Fatalf("Expected 2 requests, got %d", len(*requests))
+	}
+	reqs := *requests
+	if reqs[0].Path != "/bottoken1/sendMessage" ||
+		reqs[0].Query != "chat_id=42&text=test+from+ppacerFF" {
+		t.Errorf("Unexpected first Telegram request: %+v", reqs[0])
+	}
+	if reqs[1].Path != "/bottoken2/sendMessage" ||
+		reqs[1].Query != "chat_id=43&text=hello" {
+		t.Errorf("Unexpected second Telegram request: %+v", reqs[1])
+	}
+
+	if _, err := NewTelegram(srv.URL, "missing/secret", secrets); err == nil {
+		t.Error("Expected error for missing Telegram secret")
+	}
+	secrets[telegramSecretName] = `{"botToken": "token3", "channelId": "abc"}`
+	if _, err := NewTelegram(srv.URL, telegramSecretName, secrets); err == nil {
+		t.Error("Expected error for non-numeric channelId")
+	}
 }
@@ -11,6 +11,9 @@ import (
 )
 
 const (
+	// Timestamp format for time.Time serialization and deserialization.
+	TimestampFormat = "2006-01-02T15:04:05.999999MST-07:00"
+
 	// Date format for time.Time serialization and deserialization.
 	DateFormat = "2006-01-02"
 
@@ -0,0 +1,315 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+const (
+	// Token in the link which confirms email address.
+	TokenConfirm = "confirm"
+	// Token in link to claim offered spot. Calendar links sent before
+	// TokenCalendar was introduced use it as well.
+	TokenManage = "manage"
+	// Token in link to private calendar feed of an attendee. It belongs to
+	// the person rather than to single registration, never expires and is
+	// only revoked by RevokeCalendarTokens.
+	TokenCalendar = "calendar"
+	// Token in the link which cancels registration.
+	TokenCancel = "cancel"
+
+	registrationTokenBytes = 16
+
+	// How long confirmation link is valid.
+	confirmTokenTTL = 7 * 24 * time.Hour
+
+	// At most confirmResendLimit confirmation links, including the one sent
+	// on registration, are sent to single address within confirmResendWindow.
+	confirmResendLimit  = 3
+	confirmResendWindow = time.Hour
+
+	// How long manage and cancel links stay valid after the event ends, so
+	// calendar subscriptions don't break right after the event.
+	tokenGracePeriod = 30 * 24 * time.Hour
+
+	// How long links sent before random tokens were introduced keep working.
+	legacyTokenWindow = 30 * 24 * time.Hour
+
+	// How often expired tokens are removed from the database.
+	tokenCleanupInterval = time.Hour
+)
+
+var (
+	ErrTokenNotFound = errors.New("token not found")
+	ErrTokenExpired  = errors.New("token has expired")
+)
+
+// RegistrationToken gives access to single registration for single purpose.
+type RegistrationToken struct {
+	EventSlug string
+	Email     string
+	Purpose   string
+	ExpiresAt time.Time
+}
+
+// IssueToken creates random token of given purpose for the registration. Only
+// SHA-256 hash of the token is stored, so tokens cannot be read from the
+// database.
+func IssueToken(db *SqliteDB, eventSlug, email, purpose string, expires time.Time) (string, error) {
+	token, tErr := randomToken(registrationTokenBytes)
+	if tErr != nil {
+		return "", tErr
+	}
+	_, iErr := db.Exec(insertRegistrationTokenQuery(), hashToken(token),
+		purpose, eventSlug, email, ToString(time.Now()), expires.Unix())
+	if iErr != nil {
+		return "", fmt.Errorf("cannot insert %s token for %s: %w", purpose,
+			email, iErr)
+	}
+	return token, nil
+}
+
+// IssueCalendarToken creates token for private calendar feed of the person
+// using given email. The token isn't tied to any event and doesn't expire, so
+// calendar subscriptions keep working for future events.
+func IssueCalendarToken(db *SqliteDB, email string) (string, error) {
+	token, tErr := randomToken(registrationTokenBytes)
+	if tErr != nil {
+		return "", tErr
+	}
+	_, iErr := db.Exec(insertRegistrationTokenQuery(), hashToken(token),
+		TokenCalendar, "", EmailKey(email), ToString(time.Now()), 0)
+	if iErr != nil {
+		return "", fmt.Errorf("cannot insert calendar token for %s: %w",
+			email, iErr)
+	}
+	return token, nil
+}
+
+// RevokeCalendarTokens revokes all calendar feed tokens of the person using
+// given email.
+func RevokeCalendarTokens(db *SqliteDB, email string) (int64, error) {
+	res, dErr := db.Exec(deleteCalendarTokensQuery(), TokenCalendar,
+		EmailKey(email))
+	if dErr != nil {
+		return 0, fmt.Errorf("cannot revoke calendar tokens: %w", dErr)
+	}
+	return res.RowsAffected()
+}
+
+// LookupToken returns registration token of given purpose. For expired token
+// ErrTokenExpired is returned together with the token. Tokens without expiry
+// have zero ExpiresAt.
+func LookupToken(db *SqliteDB, token, purpose string, now time.Time) (RegistrationToken, error) {
+	t := RegistrationToken{Purpose: purpose}
+	var expiresAt int64
+	scanErr := db.QueryRow(readRegistrationTokenQuery(), hashToken(token),
+		purpose).Scan(&t.EventSlug, &t.Email, &expiresAt)
+	if scanErr == sql.ErrNoRows {
+		return t, ErrTokenNotFound
+	}
+	if scanErr != nil {
+		return t, fmt.Errorf("cannot read token: %w", scanErr)
+	}
+	if expiresAt == 0 {
+		return t, nil
+	}
+	t.ExpiresAt = time.Unix(expiresAt, 0)
+	if !now.Before(t.ExpiresAt) {
+		return t, ErrTokenExpired
+	}
+	return t, nil
+}
+
+// UserByToken returns registration for the event identified by valid token of
+// given purpose. Token issued for another event is not accepted.
+func UserByToken(db *SqliteDB, eventSlug, token, purpose string, now time.Time) (UserRow, error) {
+	t, tErr := LookupToken(db, token, purpose, now)
+	if tErr != nil {
+		return UserRow{}, tErr
+	}
+	if t.EventSlug != eventSlug {
+		return UserRow{}, ErrTokenNotFound
+	}
+	user, uErr := UserByEmail(db, eventSlug, t.Email)
+	if uErr == ErrUserNotFound {
+		return UserRow{}, ErrTokenNotFound
+	}
+	return user, uErr
+}
+
+// CountTokensIssuedSince returns number of tokens of given purpose issued for
+// the registration at or after given time.
+func CountTokensIssuedSince(db *SqliteDB, eventSlug, email, purpose string, since time.Time) (int, error) {
+	rows, qErr := db.Query(readTokensCreatedTsQuery(), eventSlug, email, purpose)
+	if qErr != nil {
+		return 0, fmt.Errorf("cannot query tokens: %w", qErr)
+	}
+	defer rows.Close()
+	count := 0
+	for rows.Next() {
+		var createdTs string
+		if err := rows.Scan(&createdTs); err != nil {
+			return 0, fmt.Errorf("cannot scan token: %w", err)
+		}
+		created, pErr := FromString(createdTs)
+		if pErr != nil {
+			return 0, pErr
+		}
+		if !created.Before(since) {
+			count++
+		}
+	}
+	return count, rows.Err()
+}
+
+// DeleteExpiredTokens removes tokens which expired before given time.
+func DeleteExpiredTokens(db *SqliteDB, now time.Time) (int64, error) {
+	res, dErr := db.Exec(deleteExpiredTokensQuery(), now.Unix())
+	if dErr != nil {
+		return 0, fmt.Errorf("cannot delete expired tokens: %w", dErr)
+	}
+	return res.RowsAffected()
+}
+
+// tokenExpiry returns expiry of token of given purpose issued at given time.
+func tokenExpiry(event EventRow, purpose string, now time.Time) time.Time {
+	if purpose == TokenConfirm {
+		return now.Add(confirmTokenTTL)
+	}
+	return event.End().Add(tokenGracePeriod)
+}
+
+// issueToken creates token of given purpose for registration to the event.
+func (o *Owner) issueToken(event EventRow, email, purpose string) (string, error) {
+	token, err := IssueToken(o.db, event.Slug, email, purpose,
+		tokenExpiry(event, purpose, time.Now()))
+	if err != nil {
+		o.logger.Error("Cannot issue token", "event", event.Slug, "email",
+			email, "purpose", purpose, "err", err.Error())
+	}
+	return token, err
+}
+
+// issueCalendarToken creates calendar feed token for the person using given
+// email. Errors are logged.
+func (o *Owner) issueCalendarToken(email string) (string, error) {
+	token, err := IssueCalendarToken(o.db, email)
+	if err != nil {
+		o.logger.Error("Cannot issue token", "email", email, "purpose",
+			TokenCalendar, "err", err.Error())
+	}
+	return token, err
+}
+
+// RunTokenCleanupWorker periodically removes expired registration tokens. It
+// blocks until given context is done.
+func (o *Owner) RunTokenCleanupWorker(ctx context.Context) {
+	ticker := time.NewTicker(tokenCleanupInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			deleted, dErr := DeleteExpiredTokens(o.db, time.Now())
+			if dErr != nil {
+				o.logger.Error("Cannot delete expired tokens", "err",
+					dErr.Error())
+				continue
+			}
+			if deleted > 0 {
+				o.logger.Info("Expired tokens deleted", "count", deleted)
+			}
+		}
+	}
+}
+
+func insertRegistrationTokenQuery() string {
+	return `
+	INSERT INTO registration_tokens(TokenHash, Purpose, EventSlug, Email, CreatedTs, ExpiresAt)
+	VALUES (?,?,?,?,?,?)
+`
+}
+
+func readRegistrationTokenQuery() string {
+	return `
+	SELECT
+		EventSlug,
+		Email,
+		ExpiresAt
+	FROM
+		registration_tokens
+	WHERE
+			TokenHash = ?
+		AND Purpose = ?
+`
+}
+
+func readTokensCreatedTsQuery() string {
+	return `
+	SELECT
+		CreatedTs
+	FROM
+		registration_tokens
+	WHERE
+			EventSlug = ?
+		AND Email = ?
+		AND Purpose = ?
+`
+}
+
+func deleteRegistrationTokensQuery() string {
+	return `
+	DELETE FROM
+		registration_tokens
+	WHERE
+			EventSlug = ?
+		AND Email = ?
+`
+}
+
+func deleteCalendarTokensQuery() string {
+	return `
+	DELETE FROM
+		registration_tokens
+	WHERE
+			Purpose = ?
+		AND Email = ?
+`
+}
+
+// Tokens with ExpiresAt 0 don't expire.
+func deleteExpiredTokensQuery() string {
+	return `
+	DELETE FROM
+		registration_tokens
+	WHERE
+			ExpiresAt > 0
+		AND ExpiresAt <= ?
+`
+}
+
+func sqliteCreateRegistrationTokensTable() string {
+	return `
+		CREATE TABLE IF NOT EXISTS registration_tokens (
+			TokenHash TEXT NOT NULL,
+			Purpose   TEXT NOT NULL,
+			EventSlug TEXT NOT NULL,
+			Email     TEXT NOT NULL,
+			CreatedTs TEXT NOT NULL,
+			ExpiresAt INT NOT NULL,
+			PRIMARY KEY (TokenHash, Purpose)
+		);
+`
+}
+
+func sqliteCreateRegistrationTokensIndex() string {
+	return `
+		CREATE INDEX IF NOT EXISTS registration_tokens_user
+		ON registration_tokens (EventSlug, Email);
+`
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestIssueAndLookupToken(t *testing.T) {
+	db := newTestDb(t)
+	now := time.Now()
+	token, iErr := IssueToken(db, defaultEventSlug, "ala@x.com", TokenConfirm,
+		now.Add(time.Hour))
+	if iErr != nil {
+		t.Fatalf("Cannot issue token: %s", iErr.Error())
+	}
+	if len(token) != 2*registrationTokenBytes {
+		t.Errorf("Expected %d hex characters, got %s", 2*registrationTokenBytes,
+			token)
+	}
+	other, _ := IssueToken(db, defaultEventSlug, "ala@x.com", TokenConfirm,
+		now.Add(time.Hour))
+	if other == token {
+		t.Error("Expected different tokens for the same registration")
+	}
+
+	rt, lErr := LookupToken(db, token, TokenConfirm, now)
+	if lErr != nil {
+		t.Fatalf("Cannot lookup token: %s", lErr.Error())
+	}
+	if rt.EventSlug != defaultEventSlug || rt.Email != "ala@x.com" {
+		t.Errorf("Unexpected token: %+v", rt)
+	}
+	if _, err := LookupToken(db, token, TokenCancel, now); err != ErrTokenNotFound {
+		t.Errorf("Expected ErrTokenNotFound for another purpose, got: %v", err)
+	}
+	if _, err := LookupToken(db, token, TokenConfirm, now.Add(2*time.Hour)); err != ErrTokenExpired {
+		t.Errorf("Expected ErrTokenExpired, got: %v", err)
+	}
+
+	var stored string
+	db.QueryRow("SELECT TokenHash FROM registration_tokens LIMIT 1").Scan(&stored)
+	if stored == "" || strings.Contains(stored, token) || strings.Contains(stored, other) {
+		t.Errorf("Expected only token hash to be stored, got %q", stored)
+	}
+
+	deleted, dErr := DeleteExpiredTokens(db, now.Add(2*time.Hour))
+	if dErr != nil || deleted != 2 {
+		t.Errorf("Expected 2 expired tokens to be deleted, got %d (%v)",
+			deleted, dErr)
+	}
+	if _, err := LookupToken(db, token, TokenConfirm, now); err != ErrTokenNotFound {
+		t.Errorf("Expected ErrTokenNotFound after cleanup, got: %v", err)
+	}
+}
@@ -0,0 +1,704 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"database/sql"
+	"encoding/base32"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"html/template"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"rsc.io/qr"
+)
+
+const (
+	totpIssuer = "ppacerFF"
+	totpPeriod = 30
+	totpDigits = 6
+
+	// Number of time steps before and after the current one which are
+	// accepted to tolerate clock drift.
+	totpSkew = 1
+
+	totpChallengeCookieName = "ppacerff_2fa"
+	totpChallengeTTL        = 5 * time.Minute
+	totpMaxAttempts         = 5
+	recoveryCodesCount      = 10
+
+	// Number of failed 2FA attempts across login challenges after which the
+	// account is locked until its 2FA is reset with the admin reset-2fa
+	// command.
+	totpMaxAccountFailures = 20
+)
+
+var totpBase32 = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+type twoFactorPage struct {
+	Admin           AdminRow
+	Enabled         bool
+	ProvisioningUri string
+	QrCode          template.URL
+	RecoveryCodes   []string
+	InfoMsg         string
+	ErrorMsg        string
+}
+
+// NewTotpSecret generates random 160-bit TOTP secret encoded in base32, as
+// expected by authenticator apps.
+func NewTotpSecret() (string, error) {
+	key := make([]byte, 20)
+	if _, err := rand.Read(key); err != nil {
+		return "", fmt.Errorf("cannot generate TOTP secret: %w", err)
+	}
+	return totpBase32.EncodeToString(key), nil
+}
+
+// TotpProvisioningUri returns otpauth:// URI which can be imported into
+// authenticator app, usually via QR code.
+func TotpProvisioningUri(username, secret string) string {
+	v := url.Values{}
+	v.Set("secret", secret)
+	v.Set("issuer", totpIssuer)
+	v.Set("algorithm", "SHA1")
+	v.Set("digits", fmt.Sprint(totpDigits))
+	v.Set("period", fmt.Sprint(totpPeriod))
+	label := url.PathEscape(totpIssuer + ":" + username)
+	return fmt.Sprintf("otpauth://totp/%s?%s", label, v.Encode())
+}
+
+// ValidateTotp checks given code against the secret (RFC 6238) at given time.
+// Codes from time steps not greater than lastStep are rejected, so a single
+// code cannot be used twice. On success matched time step is returned.
+func ValidateTotp(secret, code string, now time.Time, lastStep int64) (int64, bool) {
+	key, dErr := totpBase32.DecodeString(strings.ToUpper(secret))
+	if dErr != nil || len(code) != totpDigits {
+		return 0, false
+	}
+	current := now.Unix() / totpPeriod
+	for step := current - totpSkew; step <= current+totpSkew; step++ {
+		if step <= lastStep {
+			continue
+		}
+		expected := hotp(key, uint64(step), totpDigits)
+		if hmac.Equal([]byte(expected), []byte(code)) {
+			return step, true
+		}
+	}
+	return 0, false
+}
+
+// hotp computes HMAC-based one-time password according to RFC 4226.
+func hotp(key []byte, counter uint64, digits int) string {
+	var msg [8]byte
+	binary.BigEndian.PutUint64(msg[:], counter)
+	mac := hmac.New(sha1.New, key)
+	mac.Write(msg[:])
+	sum := mac.Sum(nil)
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+	mod := uint32(1)
+	for i := 0; i < digits; i++ {
+		mod *= 10
+	}
+	return fmt.Sprintf("%0*d", digits, value%mod)
+}
+
+// SetPendingTotpSecret stores TOTP secret which is not yet enabled. It
+// becomes active after the admin proves it was added to authenticator app.
+func SetPendingTotpSecret(db *SqliteDB, username, secret string) error {
+	return execOnAdmin(db, setTotpQuery(), secret, 0, 0, username)
+}
+
+func EnableTotp(db *SqliteDB, username string, step int64) error {
+	return execOnAdmin(db, enableTotpQuery(), step, username)
+}
+
+// UpdateTotpLastStep marks TOTP time step as used. It returns false when the
+// same or later step has been already used, so each code is accepted at most
+// once even if it's sent in parallel requests.
+func UpdateTotpLastStep(db *SqliteDB, username string, step int64) (bool, error) {
+	res, uErr := db.Exec(updateTotpLastStepQuery(), step, username, step)
+	if uErr != nil {
+		return false, uErr
+	}
+	rows, rErr := res.RowsAffected()
+	if rErr != nil {
+		return false, fmt.Errorf("cannot get number of rows affected: %w", rErr)
+	}
+	return rows == 1, nil
+}
+
+// DisableTotp turns off two-factor authentication for given admin and removes
+// their recovery codes.
+func DisableTotp(db *SqliteDB, username string) error {
+	if err := execOnAdmin(db, setTotpQuery(), "", 0, 0, username); err != nil {
+		return err
+	}
+	_, dErr := db.Exec(deleteRecoveryCodesQuery(), username)
+	return dErr
+}
+
+// ResetTotp disables two-factor authentication and logs the admin out of all
+// sessions. It's meant for the case when someone loses their phone.
+func ResetTotp(db *SqliteDB, username string) error {
+	if err := DisableTotp(db, username); err != nil {
+		return err
+	}
+	if _, dErr := db.Exec(deleteAdminSessionsQuery(), username); dErr != nil {
+		return dErr
+	}
+	_, dErr := db.Exec(deleteAdminChallengesQuery(), username)
+	return dErr
+}
+
+// NewRecoveryCodes replaces recovery codes of given admin with new ones. Only
+// hashes are stored, plain codes are returned to be shown once.
+func NewRecoveryCodes(db *SqliteDB, username string) ([]string, error) {
+	if _, dErr := db.Exec(deleteRecoveryCodesQuery(), username); dErr != nil {
+		return nil, dErr
+	}
+	codes := make([]string, recoveryCodesCount)
+	for idx := range codes {
+		raw := make([]byte, 5)
+		if _, err := rand.Read(raw); err != nil {
+			return nil, fmt.Errorf("cannot generate recovery code: %w", err)
+		}
+		code := strings.ToLower(totpBase32.EncodeToString(raw))
+		codes[idx] = code[:4] + "-" + code[4:]
+		_, iErr := db.Exec(insertRecoveryCodeQuery(), username,
+			hashToken(normalizeRecoveryCode(code)))
+		if iErr != nil {
+			return nil, fmt.Errorf("cannot insert recovery code: %w", iErr)
+		}
+	}
+	return codes, nil
+}
+
+// UseRecoveryCode marks matching unused recovery code as used. It returns
+// false when there's no such code.
+func UseRecoveryCode(db *SqliteDB, username, code string) (bool, error) {
+	res, uErr := db.Exec(useRecoveryCodeQuery(), ToString(time.Now()), username,
+		hashToken(normalizeRecoveryCode(code)))
+	if uErr != nil {
+		return false, uErr
+	}
+	rows, rErr := res.RowsAffected()
+	if rErr != nil {
+		return false, fmt.Errorf("cannot get number of rows affected: %w", rErr)
+	}
+	return rows == 1, nil
+}
+
+func normalizeRecoveryCode(code string) string {
+	code = strings.ToLower(strings.TrimSpace(code))
+	return strings.ReplaceAll(code, "-", "")
+}
+
+// NewLoginChallenge creates short-lived second step of login for admin who
+// already provided correct password.
+func NewLoginChallenge(db *SqliteDB, username string) (string, error) {
+	token, tErr := randomToken(32)
+	if tErr != nil {
+		return "", tErr
+	}
+	expires := time.Now().Add(totpChallengeTTL)
+	_, iErr := db.Exec(insertChallengeQuery(), hashToken(token), username,
+		ToString(expires))
+	if iErr != nil {
+		return "", fmt.Errorf("cannot insert login challenge: %w", iErr)
+	}
+	return token, nil
+}
+
+// AdminByChallenge returns admin for given non-expired login challenge
+// together with number of failed attempts so far.
+func AdminByChallenge(db *SqliteDB, token string) (AdminRow, int, error) {
+	var username, expiresTs string
+	var attempts int
+	row := db.QueryRow(readChallengeQuery(), hashToken(token))
+	scanErr := row.Scan(&username, &expiresTs, &attempts)
+	if scanErr == sql.ErrNoRows {
+		return AdminRow{}, 0, ErrSessionNotFound
+	}
+	if scanErr != nil {
+		return AdminRow{}, 0, fmt.Errorf("cannot read login challenge: %w",
+			scanErr)
+	}
+	if !time.Now().Before(FromStringMust(expiresTs)) {
+		DeleteLoginChallenge(db, token)
+		return AdminRow{}, 0, ErrSessionNotFound
+	}
+	admin, aErr := AdminByUsername(db, username)
+	return admin, attempts, aErr
+}
+
+// IncrementChallengeAttempts counts new attempt of providing the second factor
+// and returns number of attempts including this one.
+func IncrementChallengeAttempts(db *SqliteDB, token string) (int, error) {
+	var attempts int
+	txErr := db.WithTx(func(tx *sql.Tx) error {
+		_, uErr := tx.Exec(incrementChallengeAttemptsQuery(), hashToken(token))
+		if uErr != nil {
+			return uErr
+		}
+		var expiresTs string
+		scanErr := tx.QueryRow(readChallengeQuery(), hashToken(token)).
+			Scan(new(string), &expiresTs, &attempts)
+		if scanErr == sql.ErrNoRows {
+			return ErrSessionNotFound
+		}
+		return scanErr
+	})
+	return attempts, txErr
+}
+
+// IncrementTotpFailures counts attempt of providing the second factor by
+// given admin and returns number of failed attempts including this one.
+// Unlike challenge attempts, the counter survives new login challenges and
+// it's cleared only by successful login.
+func IncrementTotpFailures(db *SqliteDB, username string) (int, error) {
+	var failures int
+	txErr := db.WithTx(func(tx *sql.Tx) error {
+		res, uErr := tx.Exec(incrementTotpFailuresQuery(), username)
+		if uErr != nil {
+			return uErr
+		}
+		rows, rErr := res.RowsAffected()
+		if rErr != nil {
+			return fmt.Errorf("cannot get number of rows affected: %w", rErr)
+		}
+		if rows == 0 {
+			return ErrAdminNotFound
+		}
+		return tx.QueryRow(readTotpFailuresQuery(), username).Scan(&failures)
+	})
+	return failures, txErr
+}
+
+func ResetTotpFailures(db *SqliteDB, username string) error {
+	return execOnAdmin(db, resetTotpFailuresQuery(), username)
+}
+
+func DeleteLoginChallenge(db *SqliteDB, token string) error {
+	_, dErr := db.Exec(deleteChallengeQuery(), hashToken(token))
+	return dErr
+}
+
+func (o *Owner) startTotpChallenge(w http.ResponseWriter, r *http.Request, admin AdminRow) {
+	token, cErr := NewLoginChallenge(o.db, admin.Username)
+	if cErr != nil {
+		o.logger.Error("Cannot create login challenge", "username",
+			admin.Username, "err", cErr.Error())
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	http.SetCookie(w, totpChallengeCookie(token,
+		int(totpChallengeTTL.Seconds())))
+	http.Redirect(w, r, "/admin/login/2fa", http.StatusSeeOther)
+}
+
+// TotpLoginHandler is the second step of login for admins with two-factor
+// authentication enabled. It accepts either current TOTP code or one of
+// recovery codes.
+func (o *Owner) TotpLoginHandler(w http.ResponseWriter, r *http.Request) {
+	cookie, cErr := r.Cookie(totpChallengeCookieName)
+	if cErr != nil {
+		http.Redirect(w, r, "/admin/login", http.StatusSeeOther)
+		return
+	}
+	admin, _, aErr := AdminByChallenge(o.db, cookie.Value)
+	if aErr != nil {
+		if aErr != ErrSessionNotFound {
+			o.logger.Error("Cannot read login challenge", "err", aErr.Error())
+		}
+		http.SetCookie(w, totpChallengeCookie("", -1))
+		http.Redirect(w, r, "/admin/login", http.StatusSeeOther)
+		return
+	}
+
+	var p adminPage
+	if r.Method == http.MethodPost {
+		// Attempt is counted before verification, so parallel requests
+		// cannot try more codes than allowed.
+		attempts, iErr := IncrementChallengeAttempts(o.db, cookie.Value)
+		if iErr != nil && iErr != ErrSessionNotFound {
+			o.logger.Error("Cannot count 2FA attempt", "username",
+				admin.Username, "err", iErr.Error())
+		}
+		if iErr != nil || attempts > totpMaxAttempts {
+			DeleteLoginChallenge(o.db, cookie.Value)
+			http.SetCookie(w, totpChallengeCookie("", -1))
+			http.Redirect(w, r, "/admin/login", http.StatusSeeOther)
+			return
+		}
+		// Failure is counted upfront as well and cleared on success, so
+		// starting new challenges doesn't give more tries.
+		failures, fErr := IncrementTotpFailures(o.db, admin.Username)
+		if fErr != nil {
+			o.logger.Error("Cannot count 2FA failure", "username",
+				admin.Username, "err", fErr.Error())
+		}
+		if fErr != nil || failures > totpMaxAccountFailures {
+			if fErr == nil {
+				o.logger.Warn("Admin 2FA locked after too many failures",
+					"username", admin.Username, "failures", failures)
+			}
+			DeleteLoginChallenge(o.db, cookie.Value)
+			http.SetCookie(w, totpChallengeCookie("", -1))
+			http.Redirect(w, r, "/admin/login", http.StatusSeeOther)
+			return
+		}
+		if o.verifySecondFactor(admin, r.FormValue("code")) {
+			if rErr := ResetTotpFailures(o.db, admin.Username); rErr != nil {
+				o.logger.Error("Cannot reset 2FA failures", "username",
+					admin.Username, "err", rErr.Error())
+			}
+			DeleteLoginChallenge(o.db, cookie.Value)
+			http.SetCookie(w, totpChallengeCookie("", -1))
+			o.startSession(w, r, admin)
+			return
+		}
+		o.logger.Warn("Failed admin 2FA", "username", admin.Username)
+		if attempts >= totpMaxAttempts {
+			DeleteLoginChallenge(o.db, cookie.Value)
+			http.SetCookie(w, totpChallengeCookie("", -1))
+			http.Redirect(w, r, "/admin/login", http.StatusSeeOther)
+			return
+		}
+		p.ErrorMsg = "Invalid code."
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	renderErr := o.tmpl.Render(w, "admin-login-2fa", p)
+	if renderErr != nil {
+		o.logger.Error("Cannot render <admin-login-2fa>", "err",
+			renderErr.Error())
+	}
+}
+
+func (o *Owner) verifySecondFactor(admin AdminRow, code string) bool {
+	code = strings.TrimSpace(code)
+	step, ok := ValidateTotp(admin.TotpSecret, code, time.Now(),
+		admin.TotpLastStep)
+	if ok {
+		fresh, uErr := UpdateTotpLastStep(o.db, admin.Username, step)
+		if uErr != nil {
+			o.logger.Error("Cannot update TOTP step", "username",
+				admin.Username, "err", uErr.Error())
+			return false
+		}
+		if !fresh {
+			o.logger.Warn("Replayed TOTP code", "username", admin.Username)
+		}
+		return fresh
+	}
+	used, uErr := UseRecoveryCode(o.db, admin.Username, code)
+	if uErr != nil {
+		o.logger.Error("Cannot check recovery code", "username",
+			admin.Username, "err", uErr.Error())
+		return false
+	}
+	if used {
+		o.logger.Warn("Admin logged in using recovery code", "username",
+			admin.Username)
+	}
+	return used
+}
+
+// TwoFactorHandler renders two-factor authentication settings of logged in
+// admin. When it's not enabled yet, new secret is generated and shown as QR
+// code.
+func (o *Owner) TwoFactorHandler(w http.ResponseWriter, r *http.Request) {
+	admin, _ := AdminFromContext(r.Context())
+	p := twoFactorPage{Admin: admin, Enabled: admin.TotpEnabled == 1}
+	if !p.Enabled {
+		o.prepareEnrollment(&p)
+	}
+	o.renderTwoFactor(w, p)
+}
+
+// TwoFactorEnableHandler enables pending TOTP secret after admin provides
+// valid code from their authenticator app. Recovery codes are shown once.
+func (o *Owner) TwoFactorEnableHandler(w http.ResponseWriter, r *http.Request) {
+	admin, _ := AdminFromContext(r.Context())
+	p := twoFactorPage{Admin: admin}
+	step, ok := ValidateTotp(admin.TotpSecret, r.FormValue("code"), time.Now(),
+		0)
+	if admin.TotpEnabled == 1 || admin.TotpSecret == "" || !ok {
+		p.ErrorMsg = "Invalid code. Please try again."
+		p.Enabled = admin.TotpEnabled == 1
+		if !p.Enabled {
+			o.prepareEnrollment(&p)
+		}
+		o.renderTwoFactor(w, p)
+		return
+	}
+	if eErr := EnableTotp(o.db, admin.Username, step); eErr != nil {
+		o.logger.Error("Cannot enable TOTP", "username", admin.Username, "err",
+			eErr.Error())
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	codes, cErr := NewRecoveryCodes(o.db, admin.Username)
+	if cErr != nil {
+		o.logger.Error("Cannot create recovery codes", "username",
+			admin.Username, "err", cErr.Error())
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	o.logger.Warn("Admin enabled 2FA", "username", admin.Username)
+	p.Enabled = true
+	p.RecoveryCodes = codes
+	p.InfoMsg = "Two-factor authentication is enabled. Store recovery codes in a safe place, they are shown only once."
+	o.renderTwoFactor(w, p)
+}
+
+// TwoFactorDisableHandler turns off two-factor authentication. Current code is
+// required, so a hijacked session alone cannot disable it.
+func (o *Owner) TwoFactorDisableHandler(w http.ResponseWriter, r *http.Request) {
+	admin, _ := AdminFromContext(r.Context())
+	p := twoFactorPage{Admin: admin, Enabled: admin.TotpEnabled == 1}
+	if !p.Enabled || !o.verifySecondFactor(admin, r.FormValue("code")) {
+		p.ErrorMsg = "Invalid code."
+		o.renderTwoFactor(w, p)
+		return
+	}
+	if dErr := DisableTotp(o.db, admin.Username); dErr != nil {
+		o.logger.Error("Cannot disable TOTP", "username", admin.Username,
+			"err", dErr.Error())
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	o.logger.Warn("Admin disabled 2FA", "username", admin.Username)
+	p.Enabled = false
+	p.InfoMsg = "Two-factor authentication is disabled."
+	o.renderTwoFactor(w, p)
+}
+
+// prepareEnrollment sets provisioning URI and QR code for pending TOTP
+// secret. New secret is generated only if there's no pending one, so
+// reloading the page doesn't invalidate already scanned code.
+func (o *Owner) prepareEnrollment(p *twoFactorPage) {
+	secret := p.Admin.TotpSecret
+	var sErr error
+	if secret == "" {
+		secret, sErr = NewTotpSecret()
+		if sErr == nil {
+			sErr = SetPendingTotpSecret(o.db, p.Admin.Username, secret)
+		}
+	}
+	if sErr != nil {
+		o.logger.Error("Cannot prepare TOTP secret", "username",
+			p.Admin.Username, "err", sErr.Error())
+		p.ErrorMsg = "Cannot prepare two-factor authentication."
+		return
+	}
+	p.ProvisioningUri = TotpProvisioningUri(p.Admin.Username, secret)
+	code, qErr := qr.Encode(p.ProvisioningUri, qr.M)
+	if qErr != nil {
+		o.logger.Error("Cannot encode QR code", "err", qErr.Error())
+		return
+	}
+	p.QrCode = template.URL("data:image/png;base64," +
+		base64.StdEncoding.EncodeToString(code.PNG()))
+}
+
+func (o *Owner) renderTwoFactor(w http.ResponseWriter, p twoFactorPage) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	renderErr := o.tmpl.Render(w, "admin-2fa", p)
+	if renderErr != nil {
+		o.logger.Error("Cannot render <admin-2fa>", "err", renderErr.Error())
+	}
+}
+
+func totpChallengeCookie(token string, maxAge int) *http.Cookie {
+	return &http.Cookie{
+		Name:     totpChallengeCookieName,
+		Value:    token,
+		Path:     "/admin/login",
+		MaxAge:   maxAge,
+		Secure:   true,
+		HttpOnly: true,
+		SameSite: http.SameSiteStrictMode,
+	}
+}
+
+func setTotpQuery() string {
+	return `
+	UPDATE
+		admins
+	SET
+		TotpSecret = ?,
+		TotpEnabled = ?,
+		TotpLastStep = ?,
+		TotpFailures = 0
+	WHERE
+		Username = ?
+`
+}
+
+func enableTotpQuery() string {
+	return `
+	UPDATE
+		admins
+	SET
+		TotpEnabled = 1,
+		TotpLastStep = ?
+	WHERE
+		Username = ?
+`
+}
+
+func updateTotpLastStepQuery() string {
+	return `
+	UPDATE
+		admins
+	SET
+		TotpLastStep = ?
+	WHERE
+			Username = ?
+		AND TotpLastStep < ?
+`
+}
+
+func incrementTotpFailuresQuery() string {
+	return `
+	UPDATE
+		admins
+	SET
+		TotpFailures = TotpFailures + 1
+	WHERE
+		Username = ?
+`
+}
+
+func readTotpFailuresQuery() string {
+	return `
+	SELECT
+		TotpFailures
+	FROM
+		admins
+	WHERE
+		Username = ?
+`
+}
+
+func resetTotpFailuresQuery() string {
+	return `
+	UPDATE
+		admins
+	SET
+		TotpFailures = 0
+	WHERE
+		Username = ?
+`
+}
+
+func insertRecoveryCodeQuery() string {
+	return `
+	INSERT INTO admin_recovery_codes(Username, CodeHash, UsedTs)
+	VALUES (?,?,'')
+	`
+}
+
+func useRecoveryCodeQuery() string {
+	return `
+	UPDATE
+		admin_recovery_codes
+	SET
+		UsedTs = ?
+	WHERE
+			Username = ?
+		AND CodeHash = ?
+		AND UsedTs = ''
+`
+}
+
+func deleteRecoveryCodesQuery() string {
+	return `
+	DELETE FROM
+		admin_recovery_codes
+	WHERE
+		Username = ?
+`
+}
+
+func insertChallengeQuery() string {
+	return `
+	INSERT INTO admin_login_challenges(TokenHash, Username, ExpiresTs, Attempts)
+	VALUES (?,?,?,0)
+	`
+}
+
+func readChallengeQuery() string {
+	return `
+	SELECT
+		Username,
+		ExpiresTs,
+		Attempts
+	FROM
+		admin_login_challenges
+	WHERE
+		TokenHash = ?
+`
+}
+
+func incrementChallengeAttemptsQuery() string {
+	return `
+	UPDATE
+		admin_login_challenges
+	SET
+		Attempts = Attempts + 1
+	WHERE
+		TokenHash = ?
+`
+}
+
+func deleteChallengeQuery() string {
+	return `
+	DELETE FROM
+		admin_login_challenges
+	WHERE
+		TokenHash = ?
+`
+}
+
+func deleteAdminChallengesQuery() string {
+	return `
+	DELETE FROM
+		admin_login_challenges
+	WHERE
+		Username = ?
+`
+}
+
+func sqliteCreateRecoveryCodesTable() string {
+	return `
+		CREATE TABLE IF NOT EXISTS admin_recovery_codes (
+			Username TEXT NOT NULL,
+			CodeHash TEXT NOT NULL,
+			UsedTs   TEXT NOT NULL,
+
+			PRIMARY KEY (Username, CodeHash)
+		);
+`
+}
+
+func sqliteCreateLoginChallengesTable() string {
+	return `
+		CREATE TABLE IF NOT EXISTS admin_login_challenges (
+			TokenHash TEXT NOT NULL,
+			Username  TEXT NOT NULL,
+			ExpiresTs TEXT NOT NULL,
+			Attempts  INT NOT NULL,
+
+			PRIMARY KEY (TokenHash)
+		);
+`
+}
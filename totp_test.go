@@ -0,0 +1,191 @@
+package main
+
+import (
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHotpRfc6238Vectors(t *testing.T) {
+	// Test vectors from RFC 6238, Appendix B (SHA1).
+	key := []byte("12345678901234567890")
+	data := []struct {
+		unix     int64
+		expected string
+	}{
+		{59, "94287082"},
+		{1111111109, "07081804"},
+		{1111111111, "14050471"},
+		{1234567890, "89005924"},
+		{2000000000, "69279037"},
+		{20000000000, "65353130"},
+	}
+	for _, d := range data {
+		code := hotp(key, uint64(d.unix/totpPeriod), 8)
+		if code != d.expected {
+			t.Errorf("Expected TOTP %s for T=%d, got %s", d.expected, d.unix,
+				code)
+		}
+	}
+}
+
+func TestValidateTotp(t *testing.T) {
+	secret := totpBase32.EncodeToString([]byte("12345678901234567890"))
+	now := time.Unix(1111111109, 0)
+	code := hotp([]byte("12345678901234567890"), uint64(now.Unix()/totpPeriod),
+		totpDigits)
+
+	step, ok := ValidateTotp(secret, code, now, 0)
+	if !ok {
+		t.Fatal("Expected valid TOTP code")
+	}
+	if _, ok := ValidateTotp(secret, code, now.Add(totpPeriod*time.Second), 0); !ok {
+		t.Error("Expected code from previous step to be accepted")
+	}
+	if _, ok := ValidateTotp(secret, code, now.Add(5*time.Minute), 0); ok {
+		t.Error("Expected old code to be rejected")
+	}
+	if _, ok := ValidateTotp(secret, code, now, step); ok {
+		t.Error("Expected already used code to be rejected")
+	}
+	if _, ok := ValidateTotp(secret, "000000", now, 0); ok {
+		t.Error("Expected incorrect code to be rejected")
+	}
+}
+
+func TestRecoveryCodesAreSingleUse(t *testing.T) {
+	db := newTestDb(t)
+	if cErr := CreateAdmin(db, "owner", "owner password", RoleOwner); cErr != nil {
+		t.Fatalf("Cannot create admin: %s", cErr.Error())
+	}
+	codes, cErr := NewRecoveryCodes(db, "owner")
+	if cErr != nil {
+		t.Fatalf("Cannot create recovery codes: %s", cErr.Error())
+	}
+	if len(codes) != recoveryCodesCount {
+		t.Fatalf("Expected %d recovery codes, got %d", recoveryCodesCount,
+			len(codes))
+	}
+	used, _ := UseRecoveryCode(db, "owner", " "+codes[0]+" ")
+	if !used {
+		t.Error("Expected recovery code to be accepted")
+	}
+	used, _ = UseRecoveryCode(db, "owner", codes[0])
+	if used {
+		t.Error("Expected recovery code to be rejected on second use")
+	}
+
+	if rErr := ResetTotp(db, "owner"); rErr != nil {
+		t.Fatalf("Cannot reset 2FA: %s", rErr.Error())
+	}
+	used, _ = UseRecoveryCode(db, "owner", codes[1])
+	if used {
+		t.Error("Expected recovery codes to be removed after 2FA reset")
+	}
+}
+
+func TestTotpStepAndAttemptsAreCountedOnce(t *testing.T) {
+	db := newTestDb(t)
+	if cErr := CreateAdmin(db, "owner", "owner password", RoleOwner); cErr != nil {
+		t.Fatalf("Cannot create admin: %s", cErr.Error())
+	}
+	if eErr := EnableTotp(db, "owner", 10); eErr != nil {
+		t.Fatalf("Cannot enable 2FA: %s", eErr.Error())
+	}
+	for _, step := range []int64{10, 9} {
+		if fresh, _ := UpdateTotpLastStep(db, "owner", step); fresh {
+			t.Errorf("Expected step %d to be rejected as already used", step)
+		}
+	}
+	if fresh, uErr := UpdateTotpLastStep(db, "owner", 11); uErr != nil || !fresh {
+		t.Errorf("Expected step 11 to be accepted, got %v, %v", fresh, uErr)
+	}
+
+	token, cErr := NewLoginChallenge(db, "owner")
+	if cErr != nil {
+		t.Fatalf("Cannot create login challenge: %s", cErr.Error())
+	}
+	for expected := 1; expected <= 3; expected++ {
+		attempts, iErr := IncrementChallengeAttempts(db, token)
+		if iErr != nil || attempts != expected {
+			t.Errorf("Expected %d attempts, got %d, %v", expected, attempts,
+				iErr)
+		}
+	}
+	if _, iErr := IncrementChallengeAttempts(db, "unknown"); iErr != ErrSessionNotFound {
+		t.Errorf("Expected ErrSessionNotFound for unknown challenge, got %v",
+			iErr)
+	}
+}
+
+func TestTotpLoginLocksAccountAfterFailures(t *testing.T) {
+	db := newTestDb(t)
+	if cErr := CreateAdmin(db, "owner", "owner password", RoleOwner); cErr != nil {
+		t.Fatalf("Cannot create admin: %s", cErr.Error())
+	}
+	secret, _ := NewTotpSecret()
+	if sErr := SetPendingTotpSecret(db, "owner", secret); sErr != nil {
+		t.Fatalf("Cannot set 2FA secret: %s", sErr.Error())
+	}
+	if eErr := EnableTotp(db, "owner", 0); eErr != nil {
+		t.Fatalf("Cannot enable 2FA: %s", eErr.Error())
+	}
+	key, _ := totpBase32.DecodeString(secret)
+	validCode := func() string {
+		return hotp(key, uint64(time.Now().Unix()/totpPeriod), totpDigits)
+	}
+	o := &Owner{db: db, logger: defaultLogger(), tmpl: newTemplates()}
+	login := func(code string) *httptest.ResponseRecorder {
+		token, cErr := NewLoginChallenge(db, "owner")
+		if cErr != nil {
+			t.Fatalf("Cannot create login challenge: %s", cErr.Error())
+		}
+		form := url.Values{"code": {code}}
+		r := httptest.NewRequest("POST", "/admin/login/2fa",
+			strings.NewReader(form.Encode()))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		r.AddCookie(totpChallengeCookie(token, 60))
+		w := httptest.NewRecorder()
+		o.TotpLoginHandler(w, r)
+		return w
+	}
+	loggedIn := func(w *httptest.ResponseRecorder) bool {
+		return w.Header().Get("Location") == "/admin"
+	}
+
+	// Successful login clears failures from previous challenges.
+	for i := 0; i < totpMaxAccountFailures-1; i++ {
+		login("000000")
+	}
+	if w := login(validCode()); !loggedIn(w) {
+		t.Fatalf("Expected login with valid code, got %d %s", w.Code,
+			w.Header().Get("Location"))
+	}
+
+	// Failures count across challenges, so new challenges don't give more
+	// tries. Step of the code used above is already taken, hence recovery
+	// code is used to prove the account is locked even with valid factor.
+	codes, rErr := NewRecoveryCodes(db, "owner")
+	if rErr != nil {
+		t.Fatalf("Cannot create recovery codes: %s", rErr.Error())
+	}
+	for i := 0; i < totpMaxAccountFailures; i++ {
+		if w := login("000000"); loggedIn(w) {
+			t.Fatalf("Unexpected login with invalid code")
+		}
+	}
+	if w := login(codes[0]); loggedIn(w) {
+		t.Errorf("Expected locked account to reject valid recovery code")
+	}
+
+	// Resetting 2FA unlocks the account.
+	if rErr := ResetTotp(db, "owner"); rErr != nil {
+		t.Fatalf("Cannot reset 2FA: %s", rErr.Error())
+	}
+	if failures, _ := IncrementTotpFailures(db, "owner"); failures != 1 {
+		t.Errorf("Expected failures counted from zero after reset, got %d",
+			failures)
+	}
+}
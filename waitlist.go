@@ -0,0 +1,389 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+const (
+	// Registration holds a spot at the event.
+	SpotAttendee = "attendee"
+
+	// Registration is waiting for a free spot.
+	SpotWaitlist = "waitlist"
+
+	// Spot was offered to waitlisted person who can claim it until
+	// OfferExpiresTs.
+	SpotOffered = "offered"
+
+	// Offered spot wasn't claimed on time.
+	SpotLapsed = "lapsed"
+
+	// How long waitlisted person has to claim offered spot.
+	waitlistOfferTTL = 48 * time.Hour
+
+	// How often expired offers are checked.
+	waitlistCheckInterval = time.Minute
+)
+
+// Capacity thresholds (in percent) on which organizers are notified.
+var capacityAlertThresholds = []int{80, 100}
+
+// TakenSpots returns number of registrations holding a spot at the event,
+// including spots offered to people from the waitlist.
+//
+// Unconfirmed attendees keep their spot on purpose and it's never released
+// automatically. Imported registrations may stay unconfirmed by design, and
+// people who missed the email get confirmation reminders. Organizers see the
+// number of unconfirmed registrations in the daily summary and free the spot
+// by deleting the registration, which promotes the next person from the
+// waitlist.
+func TakenSpots(db sqlQueryer, eventSlug string) (int, error) {
+	var taken int
+	qErr := db.QueryRow(takenSpotsQuery(), eventSlug).Scan(&taken)
+	if qErr != nil {
+		return 0, fmt.Errorf("cannot count taken spots for %s: %w", eventSlug,
+			qErr)
+	}
+	return taken, nil
+}
+
+// NextWaitlistPos returns position for a new waitlist entry.
+func NextWaitlistPos(db sqlQueryer, eventSlug string) (int, error) {
+	var maxPos int
+	qErr := db.QueryRow(maxWaitlistPosQuery(), eventSlug).Scan(&maxPos)
+	if qErr != nil {
+		return 0, fmt.Errorf("cannot read waitlist position for %s: %w",
+			eventSlug, qErr)
+	}
+	return maxPos + 1, nil
+}
+
+// WaitlistRank returns 1-based place in the waitlist queue of given user.
+func WaitlistRank(db *SqliteDB, user UserRow) (int, error) {
+	var ahead int
+	qErr := db.QueryRow(waitlistAheadQuery(), user.EventSlug,
+		user.WaitlistPos).Scan(&ahead)
+	if qErr != nil {
+		return 0, fmt.Errorf("cannot read waitlist rank for %s: %w",
+			user.Email, qErr)
+	}
+	return ahead + 1, nil
+}
+
+// NextWaitlisted returns the first confirmed person from the waitlist of
+// given event. ErrUserNotFound is returned when the waitlist is empty.
+func NextWaitlisted(db sqlQueryer, eventSlug string) (UserRow, error) {
+	row := db.QueryRow(nextWaitlistedQuery(), eventSlug, SpotWaitlist)
+	user, scanErr := parseUserRow(row)
+	if scanErr == sql.ErrNoRows {
+		return UserRow{}, ErrUserNotFound
+	}
+	if scanErr != nil {
+		return UserRow{}, fmt.Errorf("cannot read next waitlisted user: %w",
+			scanErr)
+	}
+	return user, nil
+}
+
+// UsersWithSpot returns all registrations, across events, in given spot
+// state.
+func UsersWithSpot(db *SqliteDB, spot string) ([]UserRow, error) {
+	rows, qErr := db.Query(selectUsersQuery("Spot = ?"), spot)
+	if qErr != nil {
+		return nil, fmt.Errorf("cannot query users by spot: %w", qErr)
+	}
+	defer rows.Close()
+	users := make([]UserRow, 0)
+	for rows.Next() {
+		user, scanErr := parseUserRow(rows)
+		if scanErr != nil {
+			return nil, fmt.Errorf("error while scanning userRow: %w",
+				scanErr)
+		}
+		users = append(users, user)
+	}
+	return users, rows.Err()
+}
+
+// OfferNextSpot offers free spot at the event to the next confirmed person
+// from the waitlist. Counting taken spots, picking the person and updating
+// their spot happen in single transaction, so the event is never overbooked.
+// ErrUserNotFound is returned when there's no free spot or nobody is
+// waiting.
+func OfferNextSpot(db *SqliteDB, event EventRow, expires time.Time) (UserRow, error) {
+	var next UserRow
+	txErr := db.WithTx(func(tx *sql.Tx) error {
+		taken, tErr := TakenSpots(tx, event.Slug)
+		if tErr != nil {
+			return tErr
+		}
+		if taken >= event.Capacity {
+			return ErrUserNotFound
+		}
+		var nErr error
+		next, nErr = NextWaitlisted(tx, event.Slug)
+		if nErr != nil {
+			return nErr
+		}
+		_, uErr := tx.Exec(changeUserSpotQuery(), SpotOffered,
+			ToString(expires), event.Slug, next.Email, SpotWaitlist,
+			next.OfferExpiresTs)
+		return uErr
+	})
+	return next, txErr
+}
+
+// ChangeUserSpot moves registration from spot state given in user to the new
+// one. Nothing is changed and false is returned when spot state or offer
+// expiration has been changed in the meantime, for example offer lapsed
+// while it was being claimed.
+func ChangeUserSpot(db sqlExecer, user UserRow, spot, offerExpiresTs string) (bool, error) {
+	res, uErr := db.Exec(changeUserSpotQuery(), spot, offerExpiresTs,
+		user.EventSlug, user.Email, user.Spot, user.OfferExpiresTs)
+	if uErr != nil {
+		return false, uErr
+	}
+	rows, rErr := res.RowsAffected()
+	if rErr != nil {
+		return false, fmt.Errorf("cannot get number of rows affected: %w", rErr)
+	}
+	return rows > 0, nil
+}
+
+// DeleteUser removes registration for given event together with its tokens
+// and record of confirmation reminders, so registering again starts from
+// scratch and links from old emails stop working. When the
+// registration had near-duplicates, the first of them takes over its
+// EmailKey.
+func DeleteUser(db *SqliteDB, eventSlug, email string) error {
+	return db.WithTx(func(tx *sql.Tx) error {
+		res, dErr := tx.Exec(deleteUserQuery(), eventSlug, email)
+		if dErr != nil {
+			return dErr
+		}
+		rows, rErr := res.RowsAffected()
+		if rErr != nil {
+			return fmt.Errorf("cannot get number of rows affected: %w", rErr)
+		}
+		if rows == 0 {
+			return ErrUserNotFound
+		}
+		if _, rmErr := tx.Exec(deleteRemindersQuery(), eventSlug, email); rmErr != nil {
+			return rmErr
+		}
+		_, tErr := tx.Exec(deleteRegistrationTokensQuery(), eventSlug, email)
+		if tErr != nil {
+			return fmt.Errorf("cannot delete registration tokens: %w", tErr)
+		}
+		return restoreEmailKey(tx, eventSlug, email)
+	})
+}
+
+// newRegistrationSpot decides whether new registration for the event gets a
+// spot or lands on the waitlist. It returns spot state and waitlist position.
+func newRegistrationSpot(db sqlQueryer, event EventRow) (string, int, error) {
+	if !event.HasCapacityLimit() {
+		return SpotAttendee, 0, nil
+	}
+	taken, tErr := TakenSpots(db, event.Slug)
+	if tErr != nil {
+		return "", 0, tErr
+	}
+	if taken < event.Capacity {
+		return SpotAttendee, 0, nil
+	}
+	pos, pErr := NextWaitlistPos(db, event.Slug)
+	if pErr != nil {
+		return "", 0, pErr
+	}
+	return SpotWaitlist, pos, nil
+}
+
+// notifyCapacity sends Telegram message to organizers when the number of
+// taken spots has just crossed one of capacityAlertThresholds. Parameter
+// added is number of spots taken by the change which has just happened.
+func (o *Owner) notifyCapacity(event EventRow, added int) {
+	if !event.HasCapacityLimit() || added <= 0 {
+		return
+	}
+	taken, tErr := TakenSpots(o.db, event.Slug)
+	if tErr != nil {
+		o.logger.Error("Cannot count taken spots", "event", event.Slug, "err",
+			tErr.Error())
+		return
+	}
+	for _, threshold := range crossedThresholds(event.Capacity, taken-added,
+		taken) {
+		o.notifier.Send(
+			fmt.Sprintf("[ppacerFF] Event [%s] reached %d%% of capacity (%d/%d)",
+				event.Slug, threshold, taken, event.Capacity),
+		)
+	}
+}
+
+// crossedThresholds returns capacityAlertThresholds which were crossed when
+// number of taken spots went from before to after.
+func crossedThresholds(capacity, before, after int) []int {
+	var crossed []int
+	for _, threshold := range capacityAlertThresholds {
+		limit := (capacity*threshold + 99) / 100
+		if before < limit && limit <= after {
+			crossed = append(crossed, threshold)
+		}
+	}
+	return crossed
+}
+
+// promoteFromWaitlist offers a spot which has just been freed to the next
+// confirmed person from the waitlist. The offer is sent via email and has to
+// be claimed within waitlistOfferTTL.
+func (o *Owner) promoteFromWaitlist(event EventRow) {
+	if !event.HasCapacityLimit() {
+		return
+	}
+	expires := time.Now().Add(waitlistOfferTTL)
+	next, nErr := OfferNextSpot(o.db, event, expires)
+	if nErr == ErrUserNotFound {
+		return
+	}
+	if nErr != nil {
+		o.logger.Error("Cannot offer spot", "event", event.Slug, "err",
+			nErr.Error())
+		return
+	}
+	o.logger.Info("Spot offered from waitlist", "event", event.Slug, "email",
+		next.Email)
+	token, tErr := IssueToken(o.db, event.Slug, next.Email, TokenManage, expires)
+	if tErr != nil {
+		o.logger.Error("Cannot issue claim token", "event", event.Slug,
+			"email", next.Email, "err", tErr.Error())
+		return
+	}
+	o.queueTemplatedEmail(next.Email, emailSpotOffer, emailData{
+		Event: event,
+		ClaimUrl: fmt.Sprintf("%s/events/%s/claim/%s", appBaseUrl, event.Slug,
+			token),
+		OfferExpires: expires.In(CurrentTz()).Format(UiTimestampFormat),
+	})
+}
+
+// RunWaitlistWorker periodically releases offers which were not claimed on
+// time and passes them on to the next person from the waitlist. It blocks
+// until given context is done.
+func (o *Owner) RunWaitlistWorker(ctx context.Context) {
+	ticker := time.NewTicker(waitlistCheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			o.lapseExpiredOffers()
+		}
+	}
+}
+
+func (o *Owner) lapseExpiredOffers() {
+	offered, oErr := UsersWithSpot(o.db, SpotOffered)
+	if oErr != nil {
+		o.logger.Error("Cannot read offered spots", "err", oErr.Error())
+		return
+	}
+	now := time.Now()
+	for _, user := range offered {
+		if now.Before(FromStringMust(user.OfferExpiresTs)) {
+			continue
+		}
+		lapsed, uErr := ChangeUserSpot(o.db, user, SpotLapsed, "")
+		if uErr != nil {
+			o.logger.Error("Cannot lapse offered spot", "event",
+				user.EventSlug, "email", user.Email, "err", uErr.Error())
+			continue
+		}
+		if !lapsed {
+			// Offer was claimed in the meantime.
+			continue
+		}
+		o.logger.Info("Waitlist offer lapsed", "event", user.EventSlug,
+			"email", user.Email)
+		event, eErr := EventBySlug(o.db, user.EventSlug)
+		if eErr != nil {
+			o.logger.Error("Cannot read event", "slug", user.EventSlug, "err",
+				eErr.Error())
+			continue
+		}
+		o.promoteFromWaitlist(event)
+	}
+}
+
+// Unconfirmed attendees are counted as well, see TakenSpots.
+func takenSpotsQuery() string {
+	return `
+	SELECT
+		COUNT(*)
+	FROM
+		users
+	WHERE
+			EventSlug = ?
+		AND Spot IN ('attendee', 'offered')
+`
+}
+
+func maxWaitlistPosQuery() string {
+	return `
+	SELECT
+		COALESCE(MAX(WaitlistPos), 0)
+	FROM
+		users
+	WHERE
+		EventSlug = ?
+`
+}
+
+func waitlistAheadQuery() string {
+	return `
+	SELECT
+		COUNT(*)
+	FROM
+		users
+	WHERE
+			EventSlug = ?
+		AND Spot IN ('waitlist', 'offered')
+		AND WaitlistPos < ?
+`
+}
+
+func nextWaitlistedQuery() string {
+	return selectUsersQuery(`EventSlug = ? AND Spot = ? AND Confirmed = 1
+	ORDER BY
+		WaitlistPos
+	LIMIT 1`)
+}
+
+func changeUserSpotQuery() string {
+	return `
+	UPDATE
+		users
+	SET
+		Spot = ?,
+		OfferExpiresTs = ?
+	WHERE
+			EventSlug = ?
+		AND Email = ?
+		AND Spot = ?
+		AND OfferExpiresTs = ?
+`
+}
+
+func deleteUserQuery() string {
+	return `
+	DELETE FROM
+		users
+	WHERE
+			EventSlug = ?
+		AND Email = ?
+`
+}
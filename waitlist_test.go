@@ -0,0 +1,155 @@
+package main
+
+import (
+	"slices"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestNewRegistrationSpotWaitlist(t *testing.T) {
+	db := newTestDb(t)
+	event := EventRow{
+		Slug: "workshop", Title: "Workshop", Status: EventStatusPublished,
+		StartTs: ToString(time.Now().Add(time.Hour)), EndTs: ToString(time.Now()),
+		Capacity: 2,
+	}
+	if iErr := InsertEvent(db, event); iErr != nil {
+		t.Fatalf("Cannot insert event: %s", iErr.Error())
+	}
+
+	emails := []string{"a@x.com", "b@x.com", "c@x.com", "d@x.com"}
+	expectedSpots := []string{SpotAttendee, SpotAttendee, SpotWaitlist,
+		SpotWaitlist}
+	for idx, email := range emails {
+		spot, pos, sErr := newRegistrationSpot(db, event)
+		if sErr != nil {
+			t.Fatalf("Cannot determine spot: %s", sErr.Error())
+		}
+		if spot != expectedSpots[idx] {
+			t.Errorf("Expected %s to get spot %s, got %s", email,
+				expectedSpots[idx], spot)
+		}
+		user := User{
+			EventSlug: event.Slug, Email: email, Spot: spot,
+			WaitlistPos: pos, Confirmed: email != "c@x.com",
+		}
+		if iErr := InsertNewUser(db, user); iErr != nil {
+			t.Fatalf("Cannot insert user: %s", iErr.Error())
+		}
+	}
+
+	last, _ := UserByEmail(db, event.Slug, "d@x.com")
+	rank, rErr := WaitlistRank(db, last)
+	if rErr != nil {
+		t.Fatalf("Cannot read waitlist rank: %s", rErr.Error())
+	}
+	if rank != 2 {
+		t.Errorf("Expected d@x.com to be second on the waitlist, got %d", rank)
+	}
+
+	// Unconfirmed c@x.com is skipped when promoting from the waitlist
+	next, nErr := NextWaitlisted(db, event.Slug)
+	if nErr != nil {
+		t.Fatalf("Cannot read next waitlisted user: %s", nErr.Error())
+	}
+	if next.Email != "d@x.com" {
+		t.Errorf("Expected d@x.com to be promoted next, got %s", next.Email)
+	}
+}
+
+func TestOfferNextSpotConcurrently(t *testing.T) {
+	db := newTestDb(t)
+	event := EventRow{
+		Slug: "workshop", Title: "Workshop", Status: EventStatusPublished,
+		StartTs: ToString(time.Now().Add(time.Hour)), EndTs: ToString(time.Now()),
+		Capacity: 2,
+	}
+	if iErr := InsertEvent(db, event); iErr != nil {
+		t.Fatalf("Cannot insert event: %s", iErr.Error())
+	}
+	users := []User{
+		{EventSlug: event.Slug, Email: "a@x.com", Spot: SpotAttendee},
+		{EventSlug: event.Slug, Email: "b@x.com", Spot: SpotWaitlist,
+			WaitlistPos: 1, Confirmed: true},
+		{EventSlug: event.Slug, Email: "c@x.com", Spot: SpotWaitlist,
+			WaitlistPos: 2, Confirmed: true},
+		{EventSlug: event.Slug, Email: "d@x.com", Spot: SpotWaitlist,
+			WaitlistPos: 3, Confirmed: true},
+	}
+	for _, user := range users {
+		if iErr := InsertNewUser(db, user); iErr != nil {
+			t.Fatalf("Cannot insert user: %s", iErr.Error())
+		}
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			OfferNextSpot(db, event, time.Now().Add(time.Hour))
+		}()
+	}
+	wg.Wait()
+
+	taken, _ := TakenSpots(db, event.Slug)
+	if taken != event.Capacity {
+		t.Errorf("Expected %d taken spots, got %d", event.Capacity, taken)
+	}
+	if b, _ := UserByEmail(db, event.Slug, "b@x.com"); b.Spot != SpotOffered {
+		t.Errorf("Expected spot to be offered to b@x.com, got %s", b.Spot)
+	}
+	if _, oErr := OfferNextSpot(db, event, time.Now()); oErr != ErrUserNotFound {
+		t.Errorf("Expected no spot to offer, got %v", oErr)
+	}
+}
+
+func TestChangeUserSpotAfterLapse(t *testing.T) {
+	db := newTestDb(t)
+	event := defaultEvent()
+	event.Capacity = 1
+	user := User{EventSlug: event.Slug, Email: "a@x.com", Spot: SpotWaitlist,
+		WaitlistPos: 1, Confirmed: true}
+	if iErr := InsertNewUser(db, user); iErr != nil {
+		t.Fatalf("Cannot insert user: %s", iErr.Error())
+	}
+	offered, oErr := OfferNextSpot(db, event, time.Now())
+	if oErr != nil {
+		t.Fatalf("Cannot offer spot: %s", oErr.Error())
+	}
+	offered, _ = UserByEmail(db, event.Slug, offered.Email)
+
+	lapsed, lErr := ChangeUserSpot(db, offered, SpotLapsed, "")
+	if lErr != nil || !lapsed {
+		t.Fatalf("Expected offer to lapse, got %v, %v", lapsed, lErr)
+	}
+	claimed, cErr := ChangeUserSpot(db, offered, SpotAttendee, "")
+	if cErr != nil {
+		t.Fatalf("Cannot claim spot: %s", cErr.Error())
+	}
+	if claimed {
+		t.Error("Expected lapsed offer not to be claimed")
+	}
+}
+
+func TestCrossedThresholds(t *testing.T) {
+	data := []struct {
+		before, after int
+		expected      []int
+	}{
+		{0, 7, nil},
+		{7, 8, []int{80}},
+		{8, 9, nil},
+		{3, 10, []int{80, 100}},
+		{9, 12, []int{100}},
+		{10, 11, nil},
+	}
+	for _, d := range data {
+		crossed := crossedThresholds(10, d.before, d.after)
+		if !slices.Equal(crossed, d.expected) {
+			t.Errorf("Expected %v for %d -> %d, got %v", d.expected, d.before,
+				d.after, crossed)
+		}
+	}
+}